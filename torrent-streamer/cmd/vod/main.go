@@ -13,11 +13,15 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib" // database/sql driver
 	"github.com/joho/godotenv"
 
+	"torrent-streamer/internal/catalog"
 	"torrent-streamer/internal/config"
+	"torrent-streamer/internal/devices"
+	"torrent-streamer/internal/feeds"
 	"torrent-streamer/internal/httpapi"
 	"torrent-streamer/internal/janitor"
 	"torrent-streamer/internal/middleware"
 	"torrent-streamer/internal/scoring"
+	"torrent-streamer/internal/subtitles"
 	"torrent-streamer/internal/torrentx"
 	"torrent-streamer/internal/watch"
 )
@@ -25,7 +29,7 @@ import (
 var (
 	db         *sql.DB
 	pickRepo   *torrentx.Repo
-	searchCli  *torrentx.TorznabClient
+	searchCli  *torrentx.MultiSearcher
 	progressDB *watch.Store
 )
 
@@ -56,14 +60,59 @@ func main() {
 	pickRepo = &torrentx.Repo{DB: db}
 	progressDB = watch.NewStore(db)
 	httpapi.SetProgressStore(progressDB) // Enable server-side progress tracking for VLC
-	searchCli = &torrentx.TorznabClient{
-		BaseURL: os.Getenv("INDEXER_URL"),
-		APIKey:  os.Getenv("INDEXER_API_KEY"),
-		HTTP:    &http.Client{Timeout: 20 * time.Second},
+	httpapi.SetSubtitleSyncStore(subtitles.NewSyncStore(db))
+	httpapi.SetSubtitleProviders(subtitles.NewRegistryFrom(subtitles.ProviderConfig{
+		Names:            config.SubProviders(),
+		Timeout:          config.SubProviderTimeout(),
+		SubdlAPIURL:      config.SubdlAPIURL(),
+		SubdlDownloadURL: config.SubdlDownloadURL(),
+		OpenSubAPIURL:    config.OpenSubAPIURL(),
+		OpenSubAPIKey:    config.OpenSubAPIKey(),
+		JikanAPIURL:      config.JikanAPIURL(),
+	}))
+	if path := config.ScoringProfile(); path != "" {
+		if p, err := scoring.LoadProfileFile(path); err != nil {
+			log.Printf("[init] scoring profile: %v (using built-in rules)", err)
+		} else {
+			scoring.SetProfile(p)
+			log.Printf("[init] scoring profile %s from %s", p.Version, path)
+		}
+	}
+	episodes := catalog.New(catalog.NewStore(db), config.CatalogRefresh(),
+		&catalog.JikanProvider{APIURL: config.JikanAPIURL()})
+	if key := config.TMDbAPIKey(); key != "" {
+		episodes.Providers["tmdb"] = &catalog.TMDbProvider{APIURL: config.TMDbAPIURL(), APIKey: key}
+	}
+	if dir := config.CatalogFixtures(); dir != "" {
+		episodes.Fixtures = &catalog.FixtureProvider{Dir: dir}
+		log.Printf("[init] catalog fixtures from %s", dir)
+	}
+	searchCli = torrentx.NewMultiSearcher()
+	watchlist := feeds.NewStore(db)
+	caps := scoring.DefaultCaps
+	feedWatcher := feeds.NewWatcher(watchlist, torrentx.EnsureDeps{Repo: pickRepo, Search: searchCli}, caps, config.FeedPrefetchPct())
+	feedWatcher.Catalog = episodes
+	deviceStore := devices.NewStore(db)
+	feedWatcher.Devices = deviceStore
+	for _, ix := range config.Indexers() {
+		cli := &torrentx.TorznabClient{
+			BaseURL: ix.URL,
+			APIKey:  ix.APIKey,
+			HTTP:    &http.Client{Timeout: 20 * time.Second},
+		}
+		searchCli.Add(ix.Name, cli, ix.Timeout)
+		feedWatcher.Add(ix.Name, cli)
+		log.Printf("[init] indexer %s: %s", ix.Name, ix.URL)
+	}
+	if searchCli.Len() == 0 {
+		log.Printf("[init] no indexers configured (INDEXERS / INDEXER_URL)")
 	}
 
 	// prepare torrentx (root dirs, initial state)
 	torrentx.Init()
+	if err := subtitles.InitCache(config.SubCacheDir(), config.SubCacheMaxBytes(), config.SubCacheTTL()); err != nil {
+		log.Printf("[init] subtitle cache disabled: %v", err)
+	}
 
 	// http mux & routes (endpoints are IDENTICAL to your original service)
 	mux := http.NewServeMux()
@@ -76,7 +125,11 @@ func main() {
 			Search: searchCli,
 		},
 		Watch:       progressDB,
-		ProfileCaps: scoring.ProfileCaps{CodecAllow: map[string]bool{"h264": true, "hevc": true, "av1": true}},
+		ProfileCaps: caps,
+		SubChoices:  subtitles.NewChoiceStore(db),
+		Watchlist:   watchlist,
+		Devices:     deviceStore,
+		Catalog:     episodes,
 	})
 	sess.Register(mux)
 	// watch/lease manager wiring — same semantics as your main.go
@@ -128,6 +181,14 @@ func main() {
 
 	// start janitor
 	go janitor.Run(rootCtx)
+	go subtitles.RunCacheSweeper(rootCtx, config.SubCacheSweep())
+	go feedWatcher.Run(rootCtx, config.FeedPollInterval())
+	revalidator := torrentx.NewRevalidator(torrentx.EnsureDeps{Repo: pickRepo, Search: searchCli}, config.PickRecheckTTL(), mgr.Active)
+	go revalidator.Run(rootCtx, config.PickRecheckEvery())
+	go pickRepo.RunSearchCacheSweeper(rootCtx, config.SearchCacheSweep())
+	if path := config.ScoringProfile(); path != "" {
+		go scoring.WatchProfile(rootCtx, path, config.ScoringReload())
+	}
 
 	// http server with recover middleware
 	srv := &http.Server{
@@ -0,0 +1,382 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownSeries is returned when no provider knows a series and nothing is
+// stored for it, or when NextEpisode is asked past the last stored episode;
+// callers fall back to guessing (episode+1)
+var ErrUnknownSeries = errors.New("series not in catalog")
+
+// Series is a show or movie as stored in the series table. IDs are
+// "<provider>:<kind>:<id>" ("tmdb:tv:1399", "mal:anime:21").
+type Series struct {
+	ID        string            `json:"id"`
+	Title     string            `json:"title"`
+	Kind      string            `json:"kind"` // tv|anime|movie
+	External  map[string]string `json:"external,omitempty"`
+	UpdatedAt time.Time         `json:"updatedAt,omitzero"`
+}
+
+// Episode is one row of the episodes table. Season 0 holds specials.
+type Episode struct {
+	Season     int        `json:"season"`
+	Episode    int        `json:"episode"`
+	AbsoluteEp *int       `json:"absoluteEp,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	RuntimeS   *int       `json:"runtimeS,omitempty"`
+	AirDate    *time.Time `json:"airDate,omitempty"`
+}
+
+// Aired reports whether the episode has aired by now (unknown dates count)
+func (e Episode) Aired(now time.Time) bool {
+	return e.AirDate == nil || !e.AirDate.After(now)
+}
+
+// Provider is an external episode listing (TMDb, MyAnimeList, fixtures)
+type Provider interface {
+	// Name is the id prefix the provider answers for ("tmdb", "mal")
+	Name() string
+	// Fetch returns the series and all its episodes; ext is the id without
+	// the provider and kind prefix
+	Fetch(ctx context.Context, kind, ext string) (Series, []Episode, error)
+}
+
+// ParseID splits a series id into provider, kind and external id
+func ParseID(seriesID string) (provider, kind, ext string, ok bool) {
+	parts := strings.SplitN(seriesID, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// Storage keeps synced series; *Store is the database one
+type Storage interface {
+	GetSeries(ctx context.Context, id string) (Series, bool, error)
+	Episodes(ctx context.Context, seriesID string) ([]Episode, error)
+	Save(ctx context.Context, ser Series, eps []Episode) error
+}
+
+// a sync may take this long before it is given up
+const syncTimeout = 15 * time.Second
+
+// a failed sync is retried after minBackoff, doubling up to maxBackoff
+const (
+	minBackoff = time.Minute
+	maxBackoff = time.Hour
+)
+
+// a series played past its last stored episode is synced for new ones, at
+// most this often
+const lastEpisodeRecheck = time.Hour
+
+// Catalog serves episode lists from the database, syncing a series from its
+// provider when it is missing or older than Refresh
+type Catalog struct {
+	Store     Storage
+	Providers map[string]Provider
+	// Fixtures answers before the network providers when it has a file for
+	// the series (optional)
+	Fixtures *FixtureProvider
+	Refresh  time.Duration
+
+	mu      sync.Mutex
+	syncing map[string]*sync.Mutex
+	running map[string]bool    // background syncs in flight
+	failed  map[string]failure // failed syncs waiting out their backoff
+}
+
+type failure struct {
+	at time.Time
+	n  int // failures in a row
+}
+
+func New(store Storage, refresh time.Duration, providers ...Provider) *Catalog {
+	c := &Catalog{Store: store, Providers: map[string]Provider{}, Refresh: refresh}
+	for _, p := range providers {
+		c.Providers[p.Name()] = p
+	}
+	return c
+}
+
+// Episodes returns the series and its episodes in viewing order (specials
+// last). A series not stored yet, or refresh, waits for a sync (up to
+// syncTimeout, and not while an earlier failure is backing off); a stale one
+// is served as stored and synced in the background. A failed sync falls back
+// to what is stored.
+func (c *Catalog) Episodes(ctx context.Context, seriesID string, refresh bool) (Series, []Episode, error) {
+	s, ok, err := c.Store.GetSeries(ctx, seriesID)
+	if err != nil {
+		return Series{}, nil, err
+	}
+	switch {
+	case refresh || !ok && c.mayRetry(seriesID):
+		sctx, cancel := context.WithTimeout(ctx, syncTimeout)
+		synced, err := c.Sync(sctx, seriesID)
+		cancel()
+		if err == nil {
+			s, ok = synced, true
+		} else if !errors.Is(err, ErrUnknownSeries) {
+			log.Printf("[catalog] sync %s: %v", seriesID, err)
+		}
+	case ok && c.stale(s):
+		c.syncLater(seriesID)
+	}
+	return c.episodes(ctx, s, ok)
+}
+
+// stored is Episodes without waiting on a provider: anything missing or
+// stale is synced in the background, and a series not stored yet is
+// ErrUnknownSeries until then, so playback can go on guessing meanwhile
+func (c *Catalog) stored(ctx context.Context, seriesID string) (Series, []Episode, error) {
+	s, ok, err := c.Store.GetSeries(ctx, seriesID)
+	if err != nil {
+		return Series{}, nil, err
+	}
+	if !ok || c.stale(s) {
+		c.syncLater(seriesID)
+	}
+	return c.episodes(ctx, s, ok)
+}
+
+func (c *Catalog) episodes(ctx context.Context, s Series, ok bool) (Series, []Episode, error) {
+	if !ok {
+		return Series{}, nil, ErrUnknownSeries
+	}
+	eps, err := c.Store.Episodes(ctx, s.ID)
+	if err != nil {
+		return Series{}, nil, err
+	}
+	return s, eps, nil
+}
+
+func (c *Catalog) stale(s Series) bool {
+	return c.Refresh > 0 && time.Since(s.UpdatedAt) > c.Refresh
+}
+
+// syncLater starts a background sync of the series unless one is running,
+// its last one failed too recently or no provider knows it
+func (c *Catalog) syncLater(seriesID string) {
+	if _, _, _, ok := c.provider(seriesID); !ok || !c.mayRetry(seriesID) {
+		return
+	}
+	c.mu.Lock()
+	if c.running == nil {
+		c.running = map[string]bool{}
+	}
+	if c.running[seriesID] {
+		c.mu.Unlock()
+		return
+	}
+	c.running[seriesID] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.running, seriesID)
+			c.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+		defer cancel()
+		if _, err := c.Sync(ctx, seriesID); err != nil && !errors.Is(err, ErrUnknownSeries) {
+			log.Printf("[catalog] sync %s: %v", seriesID, err)
+		}
+	}()
+}
+
+// mayRetry reports whether the series' last failed sync has backed off long enough
+func (c *Catalog) mayRetry(seriesID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.failed[seriesID]
+	return !ok || time.Since(f.at) >= min(minBackoff<<(f.n-1), maxBackoff)
+}
+
+// noteSync records the outcome of a provider fetch for the backoff
+func (c *Catalog) noteSync(seriesID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		delete(c.failed, seriesID)
+		return
+	}
+	if c.failed == nil {
+		c.failed = map[string]failure{}
+	}
+	f := c.failed[seriesID]
+	c.failed[seriesID] = failure{at: time.Now(), n: min(f.n+1, 16)}
+}
+
+// Sync fetches a series from its provider and stores it
+func (c *Catalog) Sync(ctx context.Context, seriesID string) (Series, error) {
+	p, kind, ext, ok := c.provider(seriesID)
+	if !ok {
+		return Series{}, ErrUnknownSeries
+	}
+	// one fetch per series at a time; the rest wait and read its result
+	l := c.lock(seriesID)
+	l.Lock()
+	defer l.Unlock()
+	if s, ok, err := c.Store.GetSeries(ctx, seriesID); err == nil && ok && time.Since(s.UpdatedAt) < time.Minute {
+		return s, nil
+	}
+
+	s, eps, err := p.Fetch(ctx, kind, ext)
+	if err == nil {
+		s.ID = seriesID
+		if s.Kind == "" {
+			s.Kind = kind
+		}
+		numberAbsolute(eps)
+		err = c.Store.Save(ctx, s, eps)
+	}
+	c.noteSync(seriesID, err)
+	if err != nil {
+		return Series{}, err
+	}
+	s.UpdatedAt = time.Now()
+	return s, nil
+}
+
+func (c *Catalog) provider(seriesID string) (Provider, string, string, bool) {
+	name, kind, ext, ok := ParseID(seriesID)
+	if c.Fixtures != nil && c.Fixtures.Has(seriesID) {
+		return c.Fixtures, kind, seriesID, true
+	}
+	if !ok {
+		return nil, "", "", false
+	}
+	p, ok := c.Providers[name]
+	return p, kind, ext, ok
+}
+
+func (c *Catalog) lock(seriesID string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.syncing == nil {
+		c.syncing = map[string]*sync.Mutex{}
+	}
+	l, ok := c.syncing[seriesID]
+	if !ok {
+		l = &sync.Mutex{}
+		c.syncing[seriesID] = l
+	}
+	return l
+}
+
+// NextEpisode returns the episode to play after season/episode. Seasons roll
+// over to the next one and specials (season 0) are skipped unless playback
+// is already in them. An episode number beyond its season is read as anime
+// absolute numbering. ok is false when the next episode hasn't aired yet.
+// It never waits on a provider: until the series is synced it is
+// ErrUnknownSeries, and so is anything past the last stored episode, which
+// may only be missing from the catalog; that starts a sync for new episodes.
+func (c *Catalog) NextEpisode(ctx context.Context, seriesID string, season, episode int) (next Episode, ok bool, err error) {
+	s, eps, err := c.stored(ctx, seriesID)
+	if err != nil {
+		return Episode{}, false, err
+	}
+	if len(eps) == 0 {
+		return Episode{}, false, ErrUnknownSeries
+	}
+	next, ok = nextIn(eps, season, episode)
+	if !ok {
+		if time.Since(s.UpdatedAt) >= lastEpisodeRecheck {
+			c.syncLater(seriesID)
+		}
+		return Episode{}, false, ErrUnknownSeries
+	}
+	if !next.Aired(time.Now()) {
+		return next, false, nil
+	}
+	return next, true, nil
+}
+
+// Lookup returns the stored episode season/episode, also resolving anime
+// absolute numbers (see NextEpisode); like NextEpisode it doesn't wait on a sync
+func (c *Catalog) Lookup(ctx context.Context, seriesID string, season, episode int) (Episode, bool, error) {
+	_, eps, err := c.stored(ctx, seriesID)
+	if err != nil {
+		return Episode{}, false, err
+	}
+	if i := find(eps, season, episode); i >= 0 {
+		return eps[i], true, nil
+	}
+	return Episode{}, false, nil
+}
+
+// nextIn finds the successor of season/episode in eps (viewing order)
+func nextIn(eps []Episode, season, episode int) (Episode, bool) {
+	if i := find(eps, season, episode); i >= 0 {
+		for _, e := range eps[i+1:] {
+			if (e.Season == 0) == (eps[i].Season == 0) {
+				return e, true
+			}
+		}
+		return Episode{}, false
+	}
+	// not listed: the first regular episode after it
+	for _, e := range eps {
+		if e.Season > 0 && (e.Season > season || e.Season == season && e.Episode > episode) {
+			return e, true
+		}
+	}
+	return Episode{}, false
+}
+
+func find(eps []Episode, season, episode int) int {
+	for i, e := range eps {
+		if e.Season == season && e.Episode == episode {
+			return i
+		}
+	}
+	if season <= 1 {
+		// "S01E1057" for a show TMDb splits into seasons
+		for i, e := range eps {
+			if e.Season > 0 && e.AbsoluteEp != nil && *e.AbsoluteEp == episode {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// numberAbsolute sorts eps into viewing order and fills in absolute numbers
+// the provider left out by counting regular episodes
+func numberAbsolute(eps []Episode) {
+	sortEpisodes(eps)
+	n := 0
+	for i := range eps {
+		if eps[i].Season == 0 {
+			continue
+		}
+		n++
+		if eps[i].AbsoluteEp == nil {
+			abs := n
+			eps[i].AbsoluteEp = &abs
+		}
+	}
+}
+
+// sortEpisodes orders regular seasons first, specials after them
+func sortEpisodes(eps []Episode) {
+	sort.SliceStable(eps, func(i, j int) bool {
+		a, b := eps[i], eps[j]
+		if (a.Season == 0) != (b.Season == 0) {
+			return b.Season == 0
+		}
+		if a.Season != b.Season {
+			return a.Season < b.Season
+		}
+		return a.Episode < b.Episode
+	})
+}
@@ -0,0 +1,256 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is a Storage without a database
+type memStore struct {
+	mu     sync.Mutex
+	series map[string]Series
+	eps    map[string][]Episode
+}
+
+func (m *memStore) GetSeries(ctx context.Context, id string) (Series, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[id]
+	return s, ok, nil
+}
+
+func (m *memStore) Episodes(ctx context.Context, seriesID string) ([]Episode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Episode(nil), m.eps[seriesID]...), nil
+}
+
+func (m *memStore) Save(ctx context.Context, ser Series, eps []Episode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.series == nil {
+		m.series, m.eps = map[string]Series{}, map[string][]Episode{}
+	}
+	ser.UpdatedAt = time.Now()
+	m.series[ser.ID] = ser
+	m.eps[ser.ID] = append([]Episode(nil), eps...)
+	return nil
+}
+
+// two seasons, a special, an unaired finale; the anime one continues
+// absolute numbering into its second season
+var fixtures = map[string]string{
+	"tmdb_tv_100.json": `{"title": "Show", "kind": "tv", "episodes": [
+		{"season": 2, "episode": 1, "airDate": "2021-01-01T00:00:00Z"},
+		{"season": 1, "episode": 1, "airDate": "2020-01-01T00:00:00Z"},
+		{"season": 1, "episode": 2, "airDate": "2020-01-08T00:00:00Z"},
+		{"season": 1, "episode": 3, "airDate": "2020-01-15T00:00:00Z"},
+		{"season": 0, "episode": 1, "name": "Special", "airDate": "2020-06-01T00:00:00Z"},
+		{"season": 0, "episode": 2, "name": "Another special"},
+		{"season": 2, "episode": 2, "airDate": "2021-01-08T00:00:00Z"},
+		{"season": 2, "episode": 3, "airDate": "2999-01-01T00:00:00Z"}
+	]}`,
+	"tmdb_tv_200.json": `{"title": "Anime", "kind": "anime", "episodes": [
+		{"season": 1, "episode": 1, "absoluteEp": 1055},
+		{"season": 1, "episode": 2, "absoluteEp": 1056},
+		{"season": 2, "episode": 1, "absoluteEp": 1057},
+		{"season": 2, "episode": 2, "absoluteEp": 1058}
+	]}`,
+}
+
+func fixtureCatalog(t *testing.T) *Catalog {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New(&memStore{}, time.Hour)
+	c.Fixtures = &FixtureProvider{Dir: dir}
+	for _, id := range []string{"tmdb:tv:100", "tmdb:tv:200"} {
+		if _, _, err := c.Episodes(context.Background(), id, false); err != nil {
+			t.Fatalf("sync %s: %v", id, err)
+		}
+	}
+	return c
+}
+
+func TestNextEpisode(t *testing.T) {
+	c := fixtureCatalog(t)
+	tests := []struct {
+		name            string
+		series          string
+		season, episode int
+		want            [2]int
+		ok              bool
+	}{
+		{"within a season", "tmdb:tv:100", 1, 1, [2]int{1, 2}, true},
+		{"season rollover", "tmdb:tv:100", 1, 3, [2]int{2, 1}, true},
+		{"unlisted episode goes to the next regular one", "tmdb:tv:100", 1, 9, [2]int{2, 1}, true},
+		{"specials stay among specials", "tmdb:tv:100", 0, 1, [2]int{0, 2}, true},
+		{"unaired next episode", "tmdb:tv:100", 2, 2, [2]int{2, 3}, false},
+		{"absolute number in season 1", "tmdb:tv:200", 1, 1057, [2]int{2, 2}, true},
+		{"absolute number without a season", "tmdb:tv:200", 0, 1056, [2]int{2, 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok, err := c.NextEpisode(context.Background(), tt.series, tt.season, tt.episode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || (tt.want != [2]int{} && [2]int{next.Season, next.Episode} != tt.want) {
+				t.Errorf("NextEpisode(S%02dE%02d) = S%02dE%02d %v, want S%02dE%02d %v",
+					tt.season, tt.episode, next.Season, next.Episode, ok, tt.want[0], tt.want[1], tt.ok)
+			}
+		})
+	}
+}
+
+func TestNextEpisodeAfterLast(t *testing.T) {
+	p := &countingProvider{}
+	store := &memStore{}
+	c := New(store, 0, p)
+	if _, _, err := c.Episodes(context.Background(), "test:tv:1", false); err != nil {
+		t.Fatal(err)
+	}
+	// the last stored episode need not be the series' last: callers guess
+	if _, _, err := c.NextEpisode(context.Background(), "test:tv:1", 1, 2); !errors.Is(err, ErrUnknownSeries) {
+		t.Fatalf("err = %v, want ErrUnknownSeries", err)
+	}
+	if n := p.count(); n != 1 {
+		t.Errorf("provider asked %d times right after a sync, want 1", n)
+	}
+
+	// a while after the last sync the provider is asked for new episodes
+	store.mu.Lock()
+	s := store.series["test:tv:1"]
+	s.UpdatedAt = time.Now().Add(-2 * lastEpisodeRecheck)
+	store.series["test:tv:1"] = s
+	store.mu.Unlock()
+	if _, _, err := c.NextEpisode(context.Background(), "test:tv:1", 1, 2); !errors.Is(err, ErrUnknownSeries) {
+		t.Fatalf("err = %v, want ErrUnknownSeries", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.count() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("provider asked %d times, want a second sync", p.count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNextEpisodeSkipsSpecials(t *testing.T) {
+	c := fixtureCatalog(t)
+	// specials sort after every regular season, so no regular episode leads into one
+	for _, ep := range [][2]int{{1, 3}, {2, 1}, {2, 2}} {
+		next, _, err := c.NextEpisode(context.Background(), "tmdb:tv:100", ep[0], ep[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.Season == 0 {
+			t.Errorf("next after S%02dE%02d is special %d", ep[0], ep[1], next.Episode)
+		}
+	}
+}
+
+func TestLookupAbsolute(t *testing.T) {
+	c := fixtureCatalog(t)
+	ep, ok, err := c.Lookup(context.Background(), "tmdb:tv:200", 1, 1057)
+	if err != nil || !ok || ep.Season != 2 || ep.Episode != 1 {
+		t.Errorf("Lookup(S01E1057) = %+v %v %v, want S02E01", ep, ok, err)
+	}
+	// a listed S01 number is not read as absolute
+	if ep, ok, _ := c.Lookup(context.Background(), "tmdb:tv:200", 1, 2); !ok || ep.Season != 1 || ep.Episode != 2 {
+		t.Errorf("Lookup(S01E02) = %+v %v", ep, ok)
+	}
+}
+
+// countingProvider fails or blocks on request
+type countingProvider struct {
+	mu      sync.Mutex
+	fetches int
+	err     error
+	release chan struct{}
+}
+
+func (p *countingProvider) Name() string { return "test" }
+
+func (p *countingProvider) Fetch(ctx context.Context, kind, ext string) (Series, []Episode, error) {
+	p.mu.Lock()
+	p.fetches++
+	p.mu.Unlock()
+	if p.release != nil {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return Series{}, nil, ctx.Err()
+		}
+	}
+	if p.err != nil {
+		return Series{}, nil, p.err
+	}
+	return Series{Title: "Test"}, []Episode{{Season: 1, Episode: 1}, {Season: 1, Episode: 2}}, nil
+}
+
+func (p *countingProvider) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetches
+}
+
+func TestFailedSyncBacksOff(t *testing.T) {
+	p := &countingProvider{err: errors.New("provider down")}
+	c := New(&memStore{}, time.Hour, p)
+	for range 3 {
+		if _, _, err := c.Episodes(context.Background(), "test:tv:1", false); !errors.Is(err, ErrUnknownSeries) {
+			t.Fatalf("err = %v, want ErrUnknownSeries", err)
+		}
+		if _, _, err := c.NextEpisode(context.Background(), "test:tv:1", 1, 1); !errors.Is(err, ErrUnknownSeries) {
+			t.Fatalf("next err = %v, want ErrUnknownSeries", err)
+		}
+	}
+	if n := p.count(); n != 1 {
+		t.Errorf("provider asked %d times, want once until the backoff ends", n)
+	}
+	// an explicit refresh doesn't wait for the backoff
+	_, _, _ = c.Episodes(context.Background(), "test:tv:1", true)
+	if n := p.count(); n != 2 {
+		t.Errorf("provider asked %d times after refresh, want 2", n)
+	}
+}
+
+func TestNextEpisodeDoesNotWaitForSync(t *testing.T) {
+	p := &countingProvider{release: make(chan struct{})}
+	c := New(&memStore{}, time.Hour, p)
+
+	start := time.Now()
+	_, _, err := c.NextEpisode(context.Background(), "test:tv:1", 1, 1)
+	if !errors.Is(err, ErrUnknownSeries) || time.Since(start) > time.Second {
+		t.Fatalf("NextEpisode = %v after %v, want ErrUnknownSeries at once", err, time.Since(start))
+	}
+	close(p.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		next, ok, err := c.NextEpisode(context.Background(), "test:tv:1", 1, 1)
+		if err == nil {
+			if !ok || next.Episode != 2 {
+				t.Errorf("NextEpisode = %+v %v", next, ok)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background sync never finished: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.count(); n != 1 {
+		t.Errorf("provider asked %d times, want 1", n)
+	}
+}
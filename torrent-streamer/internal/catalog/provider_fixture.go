@@ -0,0 +1,50 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FixtureProvider serves series from JSON files in Dir, one per series, named
+// after the id with ':' replaced by '_' ("tmdb_tv_1399.json"):
+//
+//	{"title": "...", "kind": "tv", "episodes": [{"season": 1, "episode": 1, "name": "...", "runtimeS": 3300, "airDate": "2011-04-17T00:00:00Z"}]}
+//
+// It stands in for the network providers in development and tests.
+type FixtureProvider struct {
+	Dir string
+}
+
+func (p *FixtureProvider) Name() string { return "fixture" }
+
+func (p *FixtureProvider) path(seriesID string) string {
+	return filepath.Join(p.Dir, strings.NewReplacer(":", "_", "/", "_").Replace(seriesID)+".json")
+}
+
+// Has reports whether there is a fixture for the series
+func (p *FixtureProvider) Has(seriesID string) bool {
+	if p == nil || p.Dir == "" {
+		return false
+	}
+	_, err := os.Stat(p.path(seriesID))
+	return err == nil
+}
+
+// Fetch reads the fixture; ext is the full series id
+func (p *FixtureProvider) Fetch(ctx context.Context, kind, ext string) (Series, []Episode, error) {
+	data, err := os.ReadFile(p.path(ext))
+	if err != nil {
+		return Series{}, nil, err
+	}
+	var f struct {
+		Series
+		Episodes []Episode `json:"episodes"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Series{}, nil, err
+	}
+	return f.Series, f.Episodes, nil
+}
@@ -0,0 +1,86 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+const jikanAPI = "https://api.jikan.moe/v4"
+
+// JikanProvider lists anime episodes from MyAnimeList through the Jikan API
+// (no key needed). MAL numbers episodes absolutely within one entry, so they
+// are stored as season 1 with the absolute number as episode.
+type JikanProvider struct {
+	APIURL string // "" = public API
+	HTTP   *http.Client
+}
+
+func (p *JikanProvider) Name() string { return "mal" }
+
+var reEpMinutes = regexp.MustCompile(`(\d+)\s*min`)
+
+func (p *JikanProvider) Fetch(ctx context.Context, kind, ext string) (Series, []Episode, error) {
+	var anime struct {
+		Data struct {
+			Title    string `json:"title"`
+			Type     string `json:"type"` // TV|Movie|OVA|...
+			Duration string `json:"duration"`
+		} `json:"data"`
+	}
+	if err := p.get(ctx, "/anime/"+url.PathEscape(ext), &anime); err != nil {
+		return Series{}, nil, err
+	}
+	s := Series{Title: anime.Data.Title, Kind: "anime", External: external("mal", ext)}
+	if anime.Data.Type == "Movie" {
+		s.Kind = "movie"
+		return s, nil, nil
+	}
+	var runtime *int
+	if m := reEpMinutes.FindStringSubmatch(anime.Data.Duration); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		n *= 60
+		runtime = &n
+	}
+
+	var eps []Episode
+	for page := 1; ; page++ {
+		var res struct {
+			Data []struct {
+				MalID int    `json:"mal_id"` // episode number
+				Title string `json:"title"`
+				Aired string `json:"aired"`
+			} `json:"data"`
+			Pagination struct {
+				HasNextPage bool `json:"has_next_page"`
+			} `json:"pagination"`
+		}
+		if err := p.get(ctx, fmt.Sprintf("/anime/%s/episodes?page=%d", url.PathEscape(ext), page), &res); err != nil {
+			return Series{}, nil, err
+		}
+		for _, e := range res.Data {
+			abs := e.MalID
+			eps = append(eps, Episode{Season: 1, Episode: e.MalID, AbsoluteEp: &abs, Name: e.Title,
+				RuntimeS: runtime, AirDate: parseDate(e.Aired)})
+		}
+		if !res.Pagination.HasNextPage || ctx.Err() != nil {
+			break
+		}
+	}
+	return s, eps, nil
+}
+
+func (p *JikanProvider) get(ctx context.Context, path string, out any) error {
+	base := p.APIURL
+	if base == "" {
+		base = jikanAPI
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", base+path, nil)
+	if err != nil {
+		return err
+	}
+	return getJSON(p.HTTP, req, "jikan", out)
+}
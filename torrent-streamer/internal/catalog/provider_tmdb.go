@@ -0,0 +1,139 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const tmdbAPI = "https://api.themoviedb.org/3"
+
+// TMDbProvider lists TV seasons and episodes from The Movie Database. Specials
+// come back as season 0.
+type TMDbProvider struct {
+	APIURL string // "" = public API
+	APIKey string
+	HTTP   *http.Client
+}
+
+func (p *TMDbProvider) Name() string { return "tmdb" }
+
+func (p *TMDbProvider) Fetch(ctx context.Context, kind, ext string) (Series, []Episode, error) {
+	if kind == "movie" {
+		var m struct {
+			Title  string `json:"title"`
+			IMDbID string `json:"imdb_id"`
+		}
+		if err := p.get(ctx, "/movie/"+url.PathEscape(ext), &m); err != nil {
+			return Series{}, nil, err
+		}
+		return Series{Title: m.Title, Kind: "movie", External: external("tmdb", ext, "imdb", m.IMDbID)}, nil, nil
+	}
+
+	var show struct {
+		Name        string `json:"name"`
+		ExternalIDs struct {
+			IMDbID string `json:"imdb_id"`
+			TVDbID int    `json:"tvdb_id"`
+		} `json:"external_ids"`
+		Seasons []struct {
+			SeasonNumber int `json:"season_number"`
+		} `json:"seasons"`
+	}
+	if err := p.get(ctx, "/tv/"+url.PathEscape(ext)+"?append_to_response=external_ids", &show); err != nil {
+		return Series{}, nil, err
+	}
+	var tvdb string
+	if show.ExternalIDs.TVDbID > 0 {
+		tvdb = strconv.Itoa(show.ExternalIDs.TVDbID)
+	}
+	s := Series{Title: show.Name, Kind: kind, External: external("tmdb", ext, "imdb", show.ExternalIDs.IMDbID, "tvdb", tvdb)}
+	if s.Kind == "" {
+		s.Kind = "tv"
+	}
+
+	var eps []Episode
+	for _, season := range show.Seasons {
+		var sr struct {
+			Episodes []struct {
+				EpisodeNumber int    `json:"episode_number"`
+				Name          string `json:"name"`
+				Runtime       int    `json:"runtime"` // minutes
+				AirDate       string `json:"air_date"`
+			} `json:"episodes"`
+		}
+		if err := p.get(ctx, fmt.Sprintf("/tv/%s/season/%d", url.PathEscape(ext), season.SeasonNumber), &sr); err != nil {
+			return Series{}, nil, err
+		}
+		for _, e := range sr.Episodes {
+			ep := Episode{Season: season.SeasonNumber, Episode: e.EpisodeNumber, Name: e.Name, AirDate: parseDate(e.AirDate)}
+			if e.Runtime > 0 {
+				rt := e.Runtime * 60
+				ep.RuntimeS = &rt
+			}
+			eps = append(eps, ep)
+		}
+	}
+	return s, eps, nil
+}
+
+func (p *TMDbProvider) get(ctx context.Context, path string, out any) error {
+	base := p.APIURL
+	if base == "" {
+		base = tmdbAPI
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", base+path, nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	q.Set("api_key", p.APIKey)
+	req.URL.RawQuery = q.Encode()
+	return getJSON(p.HTTP, req, "tmdb", out)
+}
+
+func getJSON(client *http.Client, req *http.Request, name string, out any) error {
+	if client == nil {
+		client = &http.Client{Timeout: 20 * time.Second}
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", name, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", name, err)
+	}
+	return nil
+}
+
+// external builds an id map from key/value pairs, skipping empty values
+func external(kv ...string) map[string]string {
+	m := map[string]string{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			m[kv[i]] = kv[i+1]
+		}
+	}
+	return m
+}
+
+func parseDate(s string) *time.Time {
+	if len(s) < 10 {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", s[:10])
+	if err != nil {
+		return nil
+	}
+	return &t
+}
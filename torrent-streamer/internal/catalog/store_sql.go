@@ -0,0 +1,117 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+type Store struct{ DB *sql.DB }
+
+func NewStore(db *sql.DB) *Store { return &Store{DB: db} }
+
+func (s *Store) GetSeries(ctx context.Context, id string) (Series, bool, error) {
+	var (
+		out Series
+		ext []byte
+	)
+	err := s.DB.QueryRowContext(ctx, `
+SELECT id, title, kind, external, updated_at FROM series WHERE id=$1`, id).
+		Scan(&out.ID, &out.Title, &out.Kind, &ext, &out.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Series{}, false, nil
+		}
+		return Series{}, false, err
+	}
+	_ = json.Unmarshal(ext, &out.External)
+	return out, true, nil
+}
+
+// Episodes lists a series' episodes in viewing order, specials last
+func (s *Store) Episodes(ctx context.Context, seriesID string) ([]Episode, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT season, episode, absolute_ep, name, runtime_s, air_date
+FROM episodes WHERE series_id=$1
+ORDER BY season=0, season, episode`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Episode
+	for rows.Next() {
+		var (
+			e    Episode
+			name sql.NullString
+			air  sql.NullTime
+		)
+		if err := rows.Scan(&e.Season, &e.Episode, &e.AbsoluteEp, &name, &e.RuntimeS, &air); err != nil {
+			return nil, err
+		}
+		e.Name = name.String
+		if air.Valid {
+			e.AirDate = &air.Time
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// Save upserts the series and its episodes in one transaction; episodes the
+// provider no longer lists are removed
+func (s *Store) Save(ctx context.Context, ser Series, eps []Episode) error {
+	ext, err := json.Marshal(ser.External)
+	if err != nil {
+		return err
+	}
+	if ser.External == nil {
+		ext = []byte("{}")
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO series (id, title, kind, external, created_at, updated_at)
+VALUES ($1,$2,$3,$4, now(), now())
+ON CONFLICT (id) DO UPDATE
+SET title=EXCLUDED.title, kind=EXCLUDED.kind, external=EXCLUDED.external, updated_at=now()`,
+		ser.ID, ser.Title, ser.Kind, ext); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO episodes (series_id, season, episode, absolute_ep, name, runtime_s, air_date, created_at, updated_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7, now(), now())
+ON CONFLICT (series_id, season, episode) DO UPDATE
+SET absolute_ep=EXCLUDED.absolute_ep, name=EXCLUDED.name, runtime_s=EXCLUDED.runtime_s,
+    air_date=EXCLUDED.air_date, updated_at=now()`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	listed := make([][2]int, 0, len(eps))
+	for _, e := range eps {
+		if _, err := stmt.ExecContext(ctx, ser.ID, e.Season, e.Episode, e.AbsoluteEp, nullString(e.Name), e.RuntimeS, e.AirDate); err != nil {
+			return err
+		}
+		listed = append(listed, [2]int{e.Season, e.Episode})
+	}
+	listedJSON, _ := json.Marshal(listed)
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM episodes
+WHERE series_id=$1
+  AND (season, episode) NOT IN (SELECT (x->>0)::int, (x->>1)::int FROM jsonb_array_elements($2::jsonb) x)`,
+		ser.ID, string(listedJSON)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -25,6 +26,52 @@ var (
 	targetPause4KSec  int64 = 120  // was 600!
 	warmReadAhead4KMB int64 = 128
 
+	subCacheMaxBytes int64 = 256 << 20 // disk cache for converted subtitles
+	subCacheTTL            = 30 * 24 * time.Hour
+	subCacheSweep          = 15 * time.Minute
+
+	// external subtitle providers, queried in parallel; order is ranking priority
+	subProviders       = "subdl,opensub"
+	subProviderTimeout = 8 * time.Second
+	subdlAPIURL        string // "" = public endpoints; override for stand-in servers
+	subdlDownloadURL   string
+	openSubAPIURL      string
+	openSubAPIKey      string
+
+	// torrent indexers, queried in parallel (see Indexers)
+	indexers       []Indexer
+	indexerTimeout = 15 * time.Second
+
+	// feed watcher: polls indexer RSS for watchlisted series (0 = off)
+	feedPollInterval = 15 * time.Minute
+	feedPrefetchPct  = 0 // default share of each new episode to pre-download
+
+	// search results are reused this long, by kind; empty results for
+	// searchMissTTL, doubling with each further miss up to searchMissMax
+	searchTTLTV    = 30 * time.Minute
+	searchTTLAnime = 30 * time.Minute
+	searchTTLMovie = 24 * time.Hour
+	searchMissTTL  = 15 * time.Minute
+	searchMissMax  = 12 * time.Hour
+	searchSweep    = 30 * time.Minute
+
+	adminAPIKey string // "" disables the /v1/admin endpoints
+
+	// episode catalog: series are re-synced from their provider once this old
+	tmdbAPIURL      string
+	tmdbAPIKey      string // "" disables TMDb ids
+	jikanAPIURL     string
+	catalogFixtures string // directory of series JSON served before the providers
+	catalogRefresh  = 24 * time.Hour
+
+	// picks of watched and next episodes are compared to a fresh search once this old
+	pickRecheckEvery = 30 * time.Minute // 0 disables revalidation
+	pickRecheckTTL   = 24 * time.Hour
+
+	// scoring profile document (JSON, "" = built-in rules), re-read when it changes
+	scoringProfile string
+	scoringReload  = 30 * time.Second
+
 	endgameDuplicate = true
 	watchDropGuard   = 10 * time.Minute
 
@@ -32,7 +79,7 @@ var (
 
 	// logging
 	logFilePath   = "debug.log"
-	logAllowRegex = `^\[(init|boot|http|add|files|prefetch|stream|watch|janitor|stats|trackers)\]`
+	logAllowRegex = `^\[(init|boot|http|add|files|prefetch|stream|watch|janitor|stats|trackers|search|subtitles|feeds|scoring|picks|catalog)\]`
 	logDenyRegex  = `FlushFileBuffers|fsync|WriteFile|The handle is invalid|Access is denied|Permission denied`
 	logDedupWin   = 3 * time.Second
 )
@@ -71,6 +118,44 @@ func Load() {
 
 	watchDropGuard = getenvDuration("WATCH_DROP_GUARD", watchDropGuard)
 
+	subCacheMaxBytes = getenvInt64("SUB_CACHE_MAX_BYTES", subCacheMaxBytes)
+	subCacheTTL = getenvDuration("SUB_CACHE_TTL", subCacheTTL)
+	subCacheSweep = getenvDuration("SUB_CACHE_SWEEP", subCacheSweep)
+
+	subProviders = strings.ToLower(getenv("SUB_PROVIDERS", subProviders))
+	subProviderTimeout = getenvDuration("SUB_PROVIDER_TIMEOUT", subProviderTimeout)
+	subdlAPIURL = getenv("SUBDL_API_URL", "")
+	subdlDownloadURL = getenv("SUBDL_DOWNLOAD_URL", "")
+	openSubAPIURL = getenv("OPENSUB_API_URL", "")
+	openSubAPIKey = getenv("OPENSUB_API_KEY", "")
+
+	indexerTimeout = getenvDuration("INDEXER_TIMEOUT", indexerTimeout)
+	indexers = loadIndexers(getenv("INDEXERS", ""))
+
+	feedPollInterval = getenvDuration("FEED_POLL_INTERVAL", feedPollInterval)
+	feedPrefetchPct = int(min(max(getenvInt64("FEED_PREFETCH_PCT", int64(feedPrefetchPct)), 0), 100))
+
+	searchTTLTV = getenvDuration("SEARCH_CACHE_TTL_TV", searchTTLTV)
+	searchTTLAnime = getenvDuration("SEARCH_CACHE_TTL_ANIME", searchTTLAnime)
+	searchTTLMovie = getenvDuration("SEARCH_CACHE_TTL_MOVIE", searchTTLMovie)
+	searchMissTTL = getenvDuration("SEARCH_MISS_TTL", searchMissTTL)
+	searchMissMax = getenvDuration("SEARCH_MISS_MAX", searchMissMax)
+	searchSweep = getenvDuration("SEARCH_CACHE_SWEEP", searchSweep)
+
+	adminAPIKey = getenv("ADMIN_API_KEY", "")
+
+	tmdbAPIURL = getenv("TMDB_API_URL", "")
+	tmdbAPIKey = getenv("TMDB_API_KEY", "")
+	jikanAPIURL = getenv("JIKAN_API_URL", "")
+	catalogFixtures = getenv("CATALOG_FIXTURES", "")
+	catalogRefresh = getenvDuration("CATALOG_REFRESH", catalogRefresh)
+
+	pickRecheckEvery = getenvDuration("PICK_RECHECK_INTERVAL", pickRecheckEvery)
+	pickRecheckTTL = getenvDuration("PICK_RECHECK_TTL", pickRecheckTTL)
+
+	scoringProfile = getenv("SCORING_PROFILE", "")
+	scoringReload = getenvDuration("SCORING_PROFILE_RELOAD", scoringReload)
+
 	endgameDuplicate = strings.ToLower(getenv("ENDGAME_DUPLICATE", "true")) != "false"
 
 	listenAddr = getenv("LISTEN", listenAddr)
@@ -98,12 +183,99 @@ func TargetPause4KSec() int64            { return targetPause4KSec }
 func WarmReadAhead4KMB() int64           { return warmReadAhead4KMB }
 func EndgameDuplicate() bool             { return endgameDuplicate }
 func WatchDropGuard() time.Duration      { return watchDropGuard }
+func SubCacheDir() string                { return filepath.Join(dataRoot, "_subtitles") }
+func MetainfoDir() string                { return filepath.Join(dataRoot, "_metainfo") }
+func SubCacheMaxBytes() int64            { return subCacheMaxBytes }
+func SubCacheTTL() time.Duration         { return subCacheTTL }
+func SubCacheSweep() time.Duration       { return subCacheSweep }
+func SubProviderTimeout() time.Duration  { return subProviderTimeout }
+func SubdlAPIURL() string                { return subdlAPIURL }
+func SubdlDownloadURL() string           { return subdlDownloadURL }
+func OpenSubAPIURL() string              { return openSubAPIURL }
+func OpenSubAPIKey() string              { return openSubAPIKey }
+func FeedPollInterval() time.Duration    { return feedPollInterval }
+func FeedPrefetchPct() int               { return feedPrefetchPct }
+func SearchMissTTL() time.Duration       { return searchMissTTL }
+func SearchMissMax() time.Duration       { return searchMissMax }
+func SearchCacheSweep() time.Duration    { return searchSweep }
+func AdminAPIKey() string                { return adminAPIKey }
+func TMDbAPIURL() string                 { return tmdbAPIURL }
+func TMDbAPIKey() string                 { return tmdbAPIKey }
+func JikanAPIURL() string                { return jikanAPIURL }
+func CatalogFixtures() string            { return catalogFixtures }
+func CatalogRefresh() time.Duration      { return catalogRefresh }
+func PickRecheckEvery() time.Duration    { return pickRecheckEvery }
+func PickRecheckTTL() time.Duration      { return pickRecheckTTL }
+func ScoringProfile() string             { return scoringProfile }
+func ScoringReload() time.Duration       { return scoringReload }
 func ListenAddr() string                 { return listenAddr }
 func LogFilePath() string                { return logFilePath }
 func LogAllowRegex() string              { return logAllowRegex }
 func LogDenyRegex() string               { return logDenyRegex }
 func LogDedupWindow() time.Duration      { return logDedupWin }
 
+// SearchCacheTTL is how long search results for kind (movie|tv|anime) are reused
+func SearchCacheTTL(kind string) time.Duration {
+	switch kind {
+	case "movie":
+		return searchTTLMovie
+	case "anime":
+		return searchTTLAnime
+	default:
+		return searchTTLTV
+	}
+}
+
+// SubProviders lists the enabled subtitle providers in priority order
+func SubProviders() []string {
+	var out []string
+	for _, p := range strings.Split(subProviders, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Indexer is one Torznab endpoint to search
+type Indexer struct {
+	Name    string
+	URL     string // Prowlarr root or full Torznab API URL
+	APIKey  string
+	Timeout time.Duration
+}
+
+// Indexers lists the configured indexers
+func Indexers() []Indexer { return indexers }
+
+// loadIndexers parses INDEXERS="prowlarr=http://prowlarr:9696,jackett=http://jackett:9117/api/v2.0/indexers/all/results/torznab/api".
+// Each indexer's key and timeout come from INDEXER_<NAME>_API_KEY and
+// INDEXER_<NAME>_TIMEOUT. The single INDEXER_URL / INDEXER_API_KEY pair is
+// still honoured as an indexer named "default".
+func loadIndexers(spec string) []Indexer {
+	var out []Indexer
+	add := func(name, u, key string) {
+		env := "INDEXER_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+		out = append(out, Indexer{
+			Name:    name,
+			URL:     u,
+			APIKey:  getenv(env+"_API_KEY", key),
+			Timeout: getenvDuration(env+"_TIMEOUT", indexerTimeout),
+		})
+	}
+	if u := getenv("INDEXER_URL", ""); u != "" {
+		add("default", u, getenv("INDEXER_API_KEY", ""))
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		name, u, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(u) == "" {
+			continue
+		}
+		add(strings.TrimSpace(name), strings.TrimSpace(u), "")
+	}
+	return out
+}
+
 // helpers
 func getenv(k, def string) string {
 	if v := os.Getenv(k); v != "" {
@@ -0,0 +1,68 @@
+package devices
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"torrent-streamer/internal/scoring"
+)
+
+// Device is a registered player and what it can play
+type Device struct {
+	ID          string              `json:"id"`
+	Caps        scoring.ProfileCaps `json:"capabilities"`
+	UserAgent   string              `json:"userAgent,omitempty"`
+	ProfileHash string              `json:"profileHash"` // derived from Caps, not stored
+	CreatedAt   time.Time           `json:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt"`
+}
+
+type Store struct{ DB *sql.DB }
+
+func NewStore(db *sql.DB) *Store { return &Store{DB: db} }
+
+func (s *Store) Get(ctx context.Context, id string) (Device, bool, error) {
+	var (
+		d    Device
+		caps []byte
+		ua   sql.NullString
+	)
+	err := s.DB.QueryRowContext(ctx, `
+SELECT id, capabilities, user_agent, created_at, updated_at FROM devices WHERE id=$1`, id).
+		Scan(&d.ID, &caps, &ua, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Device{}, false, nil
+		}
+		return Device{}, false, err
+	}
+	if err := json.Unmarshal(caps, &d.Caps); err != nil {
+		return Device{}, false, err
+	}
+	d.UserAgent = ua.String
+	d.Caps = d.Caps.Normalized()
+	d.ProfileHash = scoring.ProfileHash(d.Caps)
+	return d, true, nil
+}
+
+// Save registers d or replaces its capabilities and user agent
+func (s *Store) Save(ctx context.Context, d Device) error {
+	caps, err := json.Marshal(d.Caps.Normalized())
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+INSERT INTO devices (id, capabilities, user_agent, created_at, updated_at)
+VALUES ($1,$2,$3, now(), now())
+ON CONFLICT (id) DO UPDATE
+SET capabilities=EXCLUDED.capabilities, user_agent=EXCLUDED.user_agent, updated_at=now()`,
+		d.ID, caps, sql.NullString{String: d.UserAgent, Valid: d.UserAgent != ""})
+	return err
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM devices WHERE id=$1`, id)
+	return err
+}
@@ -0,0 +1,96 @@
+package feeds
+
+import (
+	"context"
+	"database/sql"
+)
+
+// WatchEntry is one series a subject follows
+type WatchEntry struct {
+	SubjectID     string `json:"subjectId"`
+	SeriesID      string `json:"seriesId"`
+	SeriesTitle   string `json:"seriesTitle"`
+	Kind          string `json:"kind"`
+	ProfileHash   string `json:"profileHash"`
+	DeviceID      string `json:"deviceId,omitempty"` // caps to pick with; "" = the default caps
+	IMDbID        string `json:"imdbId,omitempty"`
+	TVDbID        string `json:"tvdbId,omitempty"`
+	EstRuntimeMin int    `json:"estRuntimeMin,omitempty"`
+	PrefetchPct   *int   `json:"prefetchPct,omitempty"` // nil = FEED_PREFETCH_PCT
+}
+
+type Store struct{ DB *sql.DB }
+
+func NewStore(db *sql.DB) *Store { return &Store{DB: db} }
+
+const watchCols = `subject_id, series_id, series_title, kind, profile_hash, imdb_id, tvdb_id, est_runtime_min, prefetch_pct, device_id`
+
+func scanWatch(rows *sql.Rows) ([]WatchEntry, error) {
+	defer rows.Close()
+	var out []WatchEntry
+	for rows.Next() {
+		var e WatchEntry
+		if err := rows.Scan(&e.SubjectID, &e.SeriesID, &e.SeriesTitle, &e.Kind, &e.ProfileHash,
+			&e.IMDbID, &e.TVDbID, &e.EstRuntimeMin, &e.PrefetchPct, &e.DeviceID); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// ListWatch returns every subject's watchlist
+func (s *Store) ListWatch(ctx context.Context) ([]WatchEntry, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+watchCols+` FROM watchlist ORDER BY subject_id, series_id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanWatch(rows)
+}
+
+func (s *Store) ListWatchFor(ctx context.Context, subjectID string) ([]WatchEntry, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+watchCols+` FROM watchlist WHERE subject_id=$1 ORDER BY series_title`, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	return scanWatch(rows)
+}
+
+func (s *Store) SaveWatch(ctx context.Context, e WatchEntry) error {
+	_, err := s.DB.ExecContext(ctx, `
+INSERT INTO watchlist (`+watchCols+`, created_at, updated_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10, now(), now())
+ON CONFLICT (subject_id, series_id) DO UPDATE
+SET series_title=EXCLUDED.series_title, kind=EXCLUDED.kind, profile_hash=EXCLUDED.profile_hash,
+    imdb_id=EXCLUDED.imdb_id, tvdb_id=EXCLUDED.tvdb_id, est_runtime_min=EXCLUDED.est_runtime_min,
+    prefetch_pct=EXCLUDED.prefetch_pct, device_id=EXCLUDED.device_id, updated_at=now()`,
+		e.SubjectID, e.SeriesID, e.SeriesTitle, e.Kind, e.ProfileHash, e.IMDbID, e.TVDbID, e.EstRuntimeMin, e.PrefetchPct,
+		e.DeviceID)
+	return err
+}
+
+func (s *Store) DeleteWatch(ctx context.Context, subjectID, seriesID string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM watchlist WHERE subject_id=$1 AND series_id=$2`, subjectID, seriesID)
+	return err
+}
+
+// Checkpoint returns the newest GUID already processed for a feed
+func (s *Store) Checkpoint(ctx context.Context, feed string) (string, bool, error) {
+	var guid string
+	err := s.DB.QueryRowContext(ctx, `SELECT last_guid FROM feed_checkpoints WHERE feed=$1`, feed).Scan(&guid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return guid, true, nil
+}
+
+func (s *Store) SaveCheckpoint(ctx context.Context, feed, guid string) error {
+	_, err := s.DB.ExecContext(ctx, `
+INSERT INTO feed_checkpoints (feed, last_guid, created_at, updated_at)
+VALUES ($1,$2, now(), now())
+ON CONFLICT (feed) DO UPDATE SET last_guid=EXCLUDED.last_guid, updated_at=now()`, feed, guid)
+	return err
+}
@@ -0,0 +1,340 @@
+// Package feeds polls indexer RSS feeds and grabs new episodes of the
+// series on subjects' watchlists before anyone asks for them.
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"torrent-streamer/internal/catalog"
+	"torrent-streamer/internal/devices"
+	"torrent-streamer/internal/releaseparse"
+	"torrent-streamer/internal/scoring"
+	"torrent-streamer/internal/torrentx"
+	"torrent-streamer/pkg/types"
+)
+
+// Feed is a source of recently published releases, newest first
+type Feed interface {
+	Recent(ctx context.Context) ([]torrentx.FeedItem, error)
+}
+
+type namedFeed struct {
+	name string
+	f    Feed
+}
+
+// Watcher matches new feed items against the watchlist, picks a release for
+// each new episode through EnsurePick and optionally starts downloading it
+type Watcher struct {
+	Store *Store
+	Picks torrentx.EnsureDeps
+	// Caps are used for entries without a device; Devices resolves the rest
+	Caps        scoring.ProfileCaps
+	Devices     *devices.Store
+	PrefetchPct int // share of each new episode to pre-download; entries may override
+	// Catalog maps absolute anime numbers onto the series' seasons (optional)
+	Catalog *catalog.Catalog
+
+	feeds    []namedFeed
+	attempts map[string]int // feed|GUID -> failed polls of items being retried
+}
+
+// an item whose grabs keep failing (unresolvable, no seeders) is given up
+// after this many polls, so it doesn't hold the checkpoint back for good
+const maxGrabAttempts = 3
+
+func NewWatcher(store *Store, picks torrentx.EnsureDeps, caps scoring.ProfileCaps, prefetchPct int) *Watcher {
+	return &Watcher{Store: store, Picks: picks, Caps: caps, PrefetchPct: prefetchPct}
+}
+
+// Add registers a feed; name keys its checkpoint, so keep it stable
+func (w *Watcher) Add(name string, f Feed) { w.feeds = append(w.feeds, namedFeed{name, f}) }
+
+// Run polls every interval until ctx ends; interval <= 0 disables polling
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || len(w.feeds) == 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		w.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Poll reads each feed once and handles everything published since its
+// checkpoint. The checkpoint only moves past items that were handled: after
+// a failed grab it stays just before that item, so the next poll retries it
+// (episodes picked meanwhile are skipped then), up to maxGrabAttempts polls.
+// Poll is not safe for concurrent use.
+func (w *Watcher) Poll(ctx context.Context) {
+	entries, err := w.Store.ListWatch(ctx)
+	if err != nil {
+		log.Printf("[feeds] watchlist: %v", err)
+		return
+	}
+	targets := w.targets(ctx, entries)
+	if len(targets) == 0 {
+		return
+	}
+	grabbed := map[string]bool{}
+	for _, nf := range w.feeds {
+		items, err := nf.f.Recent(ctx)
+		if err != nil {
+			log.Printf("[feeds] %s: %v", nf.name, err)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		last, ok, err := w.Store.Checkpoint(ctx, nf.name)
+		if err != nil {
+			log.Printf("[feeds] %s checkpoint: %v", nf.name, err)
+			continue
+		}
+		if !ok {
+			// a feed seen for the first time starts from now, not from its backlog
+			log.Printf("[feeds] %s: first poll, starting after %q", nf.name, items[0].Candidate.Title)
+			_ = w.Store.SaveCheckpoint(ctx, nf.name, items[0].GUID)
+			continue
+		}
+		var fresh []torrentx.FeedItem
+		for _, it := range items {
+			if it.GUID == last {
+				break
+			}
+			fresh = append(fresh, it)
+		}
+		// oldest first, so episodes are grabbed in airing order
+		next, failed := last, false
+		for i := len(fresh) - 1; i >= 0; i-- {
+			if w.handle(ctx, fresh[i], targets, grabbed) {
+				delete(w.attempts, nf.name+"|"+fresh[i].GUID)
+			} else if w.retry(nf.name, fresh[i]) {
+				failed = true
+			}
+			if !failed {
+				next = fresh[i].GUID
+			}
+		}
+		if next == last {
+			continue
+		}
+		if err := w.Store.SaveCheckpoint(ctx, nf.name, next); err != nil {
+			log.Printf("[feeds] %s checkpoint: %v", nf.name, err)
+		}
+	}
+}
+
+// retry counts a failed poll of an item and reports whether it has
+// attempts left; items out of attempts are passed over
+func (w *Watcher) retry(feed string, it torrentx.FeedItem) bool {
+	if w.attempts == nil {
+		w.attempts = map[string]int{}
+	}
+	key := feed + "|" + it.GUID
+	w.attempts[key]++
+	if w.attempts[key] < maxGrabAttempts {
+		return true
+	}
+	delete(w.attempts, key)
+	log.Printf("[feeds] %s: giving up on %q after %d attempts", feed, it.Candidate.Title, maxGrabAttempts)
+	return false
+}
+
+// target is a watchlist entry with the caps its picks are made with
+type target struct {
+	WatchEntry
+	caps scoring.ProfileCaps
+}
+
+// targets resolves each entry's caps: its device's, or the default caps for
+// entries without one. Entries whose caps can't be told are skipped rather
+// than picked for with caps their device may not play.
+func (w *Watcher) targets(ctx context.Context, entries []WatchEntry) []target {
+	out := make([]target, 0, len(entries))
+	for _, e := range entries {
+		if e.DeviceID == "" {
+			if e.ProfileHash != scoring.ProfileHash(w.Caps) {
+				log.Printf("[feeds] %s %s: profile %s has no device, skipping", e.SubjectID, e.SeriesID, e.ProfileHash)
+				continue
+			}
+			out = append(out, target{e, w.Caps})
+			continue
+		}
+		if w.Devices == nil {
+			continue
+		}
+		d, ok, err := w.Devices.Get(ctx, e.DeviceID)
+		if err != nil || !ok {
+			log.Printf("[feeds] %s %s: device %s: %v (found=%v), skipping", e.SubjectID, e.SeriesID, e.DeviceID, err, ok)
+			continue
+		}
+		// the device's caps may have changed since the entry was saved
+		e.ProfileHash = d.ProfileHash
+		out = append(out, target{e, d.Caps})
+	}
+	return out
+}
+
+// handle grabs the episode an item carries for every watchlist entry it
+// matches; false when a grab failed and the item should be retried
+func (w *Watcher) handle(ctx context.Context, it torrentx.FeedItem, entries []target, grabbed map[string]bool) bool {
+	c := it.Candidate
+	rel := releaseparse.Parse(c.Title)
+	// only single new episodes; packs and batches are older material
+	if rel.SeasonPack || len(rel.Episodes) > 1 || len(rel.AbsEpisodes) > 1 {
+		return true
+	}
+	season, episode := rel.Season, rel.Episode
+	var abs *int
+	if episode == 0 {
+		if rel.AbsEpisode == 0 {
+			return true
+		}
+		// absolute-numbered anime is kept under season 1
+		n := rel.AbsEpisode
+		season, episode, abs = max(season, 1), n, &n
+	}
+
+	ok := true
+	for _, e := range entries {
+		if !matches(e.WatchEntry, rel, c) {
+			continue
+		}
+		season, episode := w.episodeFor(ctx, e.SeriesID, season, episode, abs)
+		key := fmt.Sprintf("%s|%d|%d|%s", e.SeriesID, season, episode, e.ProfileHash)
+		if grabbed[key] {
+			continue
+		}
+		if sb := scoring.Score(c, e.caps, runtimeFor(e.WatchEntry), scoring.History{}, nil); sb.Total < 0 {
+			log.Printf("[feeds] %s S%02dE%02d: skipping %q (%s)", e.SeriesID, season, episode, c.Title, sb.HardReject)
+			continue
+		}
+		if !w.grab(ctx, e, season, episode, abs) {
+			ok = false
+			continue
+		}
+		grabbed[key] = true
+	}
+	return ok
+}
+
+// episodeFor places an absolute-numbered release in the series' seasons
+// when the catalog lists them
+func (w *Watcher) episodeFor(ctx context.Context, seriesID string, season, episode int, abs *int) (int, int) {
+	if w.Catalog == nil || abs == nil {
+		return season, episode
+	}
+	ep, ok, err := w.Catalog.Lookup(ctx, seriesID, season, *abs)
+	if err != nil || !ok {
+		return season, episode
+	}
+	return ep.Season, ep.Episode
+}
+
+// grab picks (and prefetches) an episode unless it already has a pick;
+// false when no pick could be made
+func (w *Watcher) grab(ctx context.Context, e target, season, episode int, abs *int) bool {
+	_, ok, err := w.Picks.Repo.GetPick(ctx, e.SeriesID, season, episode, scoring.ProfileKey(e.ProfileHash))
+	if err != nil {
+		log.Printf("[feeds] %s S%02dE%02d: %v", e.SeriesID, season, episode, err)
+		return false
+	}
+	if ok {
+		return true
+	}
+	pctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	p, err := torrentx.EnsurePick(pctx, w.Picks, torrentx.EnsureInput{
+		SeriesID: e.SeriesID, SeriesTitle: e.SeriesTitle, Kind: e.Kind,
+		Season: season, Episode: episode, AbsEpisode: abs,
+		IMDbID: e.IMDbID, TVDbID: e.TVDbID,
+		ProfileHash: e.ProfileHash, ProfileCaps: e.caps,
+		EstRuntimeMin: runtimeFor(e.WatchEntry),
+		// a miss cached before the release came out must not hide it
+		IgnoreMiss: true,
+	})
+	if err != nil {
+		log.Printf("[feeds] %s S%02dE%02d: pick failed: %v", e.SeriesID, season, episode, err)
+		return false
+	}
+	log.Printf("[feeds] %s S%02dE%02d: picked %s (%s %s)", e.SeriesID, season, episode, p.InfoHash, p.Resolution, p.Codec)
+
+	pct := w.PrefetchPct
+	if e.PrefetchPct != nil {
+		pct = *e.PrefetchPct
+	}
+	if pct > 0 {
+		if err := prefetch(ctx, e.Kind, p, pct); err != nil {
+			log.Printf("[feeds] %s S%02dE%02d: prefetch: %v", e.SeriesID, season, episode, err)
+		}
+	}
+	return true
+}
+
+// prefetch gets the picked episode file ready the way /prefetch does, and
+// queues its first pct percent; the download continues in the background
+func prefetch(ctx context.Context, cat string, p torrentx.PickRow, pct int) error {
+	idx := -1
+	if p.FileIndex != nil {
+		idx = *p.FileIndex
+	}
+	res, err := torrentx.Prefetch(ctx, cat, p.Magnet, idx, pct)
+	if err != nil {
+		return err
+	}
+	if res.File == nil {
+		return fmt.Errorf("no playable file")
+	}
+	log.Printf("[feeds] prefetching %d%% of %s file=%d", pct, res.Torrent.InfoHash().HexString(), res.FileIndex)
+	return nil
+}
+
+// matches reports whether a release belongs to a watchlist entry: by TVDB id
+// when the indexer gives one, else by title
+func matches(e WatchEntry, rel releaseparse.Release, c types.Candidate) bool {
+	if e.Kind == "movie" {
+		return false
+	}
+	if e.TVDbID != "" && c.TVDbID != "" {
+		return e.TVDbID == c.TVDbID
+	}
+	want := titleKey(e.SeriesTitle)
+	if want == "" {
+		return false
+	}
+	got := titleKey(rel.Title)
+	return got == want || rel.Year > 0 && titleKey(fmt.Sprintf("%s %d", rel.Title, rel.Year)) == want
+}
+
+// titleKey folds case and punctuation: "Marvel's Agents of S.H.I.E.L.D." → "marvelsagentsofshield"
+func titleKey(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func runtimeFor(e WatchEntry) float64 {
+	if e.EstRuntimeMin > 0 {
+		return float64(e.EstRuntimeMin)
+	}
+	if e.Kind == "anime" {
+		return 24
+	}
+	return 42
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"torrent-streamer/internal/config"
+)
+
+// adminOnly requires the ADMIN_API_KEY in an X-Api-Key header or as a
+// bearer token. Without a configured key the admin API is off.
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := config.AdminAPIKey()
+		if key == "" {
+			http.Error(w, "admin API disabled", http.StatusNotFound)
+			return
+		}
+		got := r.Header.Get("X-Api-Key")
+		if got == "" {
+			got = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// PurgeSearchCache drops a series' cached searches, hits and misses alike,
+// so the next pick searches the indexers again.
+// DELETE /v1/admin/search-cache?seriesId=...
+func (h *SessionHandlers) PurgeSearchCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	series := strings.TrimSpace(r.URL.Query().Get("seriesId"))
+	if series == "" {
+		http.Error(w, "seriesId required", http.StatusBadRequest)
+		return
+	}
+	n, err := h.d.Picks.Repo.PurgeSearchCache(r.Context(), series)
+	if err != nil {
+		log.Printf("[search] purge cache %s: %v", series, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[search] purged %d cached searches for %s", n, series)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"seriesId": series, "purged": n})
+}
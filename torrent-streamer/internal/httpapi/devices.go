@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"torrent-streamer/internal/devices"
+	"torrent-streamer/internal/scoring"
+)
+
+var errUnknownDevice = errors.New("unknown device")
+
+// Devices registers players and their capabilities.
+// GET    /v1/devices?id=...
+// POST   /v1/devices {["id"],"capabilities":{"codecs":{"h264":true,...},"preferHdr","maxBitrate","allowHi10p","maxResolution"},["userAgent"]}
+// DELETE /v1/devices?id=...
+// POST without an id registers a new device; the response carries its id and
+// profileHash.
+func (h *SessionHandlers) Devices(w http.ResponseWriter, r *http.Request) {
+	if h.d.Devices == nil {
+		http.Error(w, "devices not available", http.StatusNotFound)
+		return
+	}
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			http.Error(w, "id required", http.StatusBadRequest)
+			return
+		}
+		d, ok, err := h.d.Devices.Get(r.Context(), id)
+		if err != nil {
+			log.Printf("[http] device %s: %v", id, err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "unknown device", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d)
+
+	case http.MethodPost:
+		var in devices.Device
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		in.ID = strings.TrimSpace(in.ID)
+		if in.ID == "" {
+			in.ID = newDeviceID()
+		}
+		if in.UserAgent == "" {
+			in.UserAgent = r.UserAgent()
+		}
+		if len(in.Caps.Normalized().CodecAllow) == 0 {
+			// nothing allowed would reject every release
+			in.Caps.CodecAllow = h.d.ProfileCaps.CodecAllow
+		}
+		if in.Caps.MaxBitrate < 0 {
+			http.Error(w, "maxBitrate must be >= 0", http.StatusBadRequest)
+			return
+		}
+		if err := h.d.Devices.Save(r.Context(), in); err != nil {
+			log.Printf("[http] save device %s: %v", in.ID, err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		d, _, err := h.d.Devices.Get(r.Context(), in.ID)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d)
+
+	case http.MethodDelete:
+		if id == "" {
+			http.Error(w, "id required", http.StatusBadRequest)
+			return
+		}
+		if err := h.d.Devices.Delete(r.Context(), id); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// deviceProfile returns the caps and profile hash to pick with: a registered
+// device's own, else the default caps with the client's profileHash (or the
+// default caps' hash when it sent none)
+func (h *SessionHandlers) deviceProfile(ctx context.Context, deviceID, profileHash string) (scoring.ProfileCaps, string, error) {
+	if deviceID = strings.TrimSpace(deviceID); deviceID != "" && h.d.Devices != nil {
+		d, ok, err := h.d.Devices.Get(ctx, deviceID)
+		if err != nil {
+			return scoring.ProfileCaps{}, "", err
+		}
+		if !ok {
+			return scoring.ProfileCaps{}, "", errUnknownDevice
+		}
+		return d.Caps, d.ProfileHash, nil
+	}
+	if profileHash == "" {
+		profileHash = scoring.ProfileHash(h.d.ProfileCaps)
+	}
+	return h.d.ProfileCaps, profileHash, nil
+}
+
+// deviceError reports a deviceProfile failure
+func deviceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnknownDevice) {
+		http.Error(w, "unknown deviceId", http.StatusNotFound)
+		return
+	}
+	log.Printf("[http] device lookup: %v", err)
+	http.Error(w, "db error", http.StatusInternalServerError)
+}
+
+func newDeviceID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"torrent-streamer/internal/catalog"
+	"torrent-streamer/internal/watch"
+)
+
+// Episodes lists a series' episodes from the catalog, syncing it from its
+// provider when it is not stored yet (stale ones refresh in the background).
+// GET /v1/episodes?seriesId=tmdb:tv:1399[&refresh=1]
+func (h *SessionHandlers) Episodes(w http.ResponseWriter, r *http.Request) {
+	if h.d.Catalog == nil {
+		http.Error(w, "catalog not available", http.StatusNotFound)
+		return
+	}
+	series := strings.TrimSpace(r.URL.Query().Get("seriesId"))
+	if series == "" {
+		http.Error(w, "seriesId required", http.StatusBadRequest)
+		return
+	}
+	s, eps, err := h.d.Catalog.Episodes(r.Context(), series, r.URL.Query().Get("refresh") == "1")
+	if errors.Is(err, catalog.ErrUnknownSeries) {
+		http.Error(w, "unknown series", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[catalog] episodes %s: %v", series, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if eps == nil {
+		eps = []catalog.Episode{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"series": s, "episodes": eps})
+}
+
+// nextEpisode is the episode after season/episode. Series the catalog does
+// not know, hasn't synced yet or has no later episode of fall back to the
+// next number in the same season; ok is false when the catalog's next
+// episode hasn't aired yet.
+func (h *SessionHandlers) nextEpisode(ctx context.Context, seriesID string, season, episode int) (catalog.Episode, bool) {
+	guess := catalog.Episode{Season: season, Episode: episode + 1}
+	if h.d.Catalog == nil {
+		return guess, true
+	}
+	next, ok, err := h.d.Catalog.NextEpisode(ctx, seriesID, season, episode)
+	if err != nil {
+		if !errors.Is(err, catalog.ErrUnknownSeries) {
+			log.Printf("[catalog] next after %s S%02dE%02d: %v", seriesID, season, episode, err)
+		}
+		return guess, true
+	}
+	return next, ok
+}
+
+// resumeEpisode moves resume state on to the next episode once the one it
+// points at was watched to the end (≥95%, as Heartbeat marks it completed)
+func (h *SessionHandlers) resumeEpisode(ctx context.Context, res *watch.Resume) {
+	if res.Percent < 95 {
+		return
+	}
+	next, ok := h.nextEpisode(ctx, res.SeriesID, res.Season, res.Episode)
+	if !ok {
+		return
+	}
+	res.Season, res.Episode = next.Season, next.Episode
+	res.Position, res.Duration, res.Percent = 0, 0, 0
+	if next.RuntimeS != nil {
+		res.Duration = *next.RuntimeS
+	}
+}
+
+// runtimeMin is the catalog runtime of an episode in minutes, 0 if unknown
+func runtimeMin(e catalog.Episode) float64 {
+	if e.RuntimeS == nil {
+		return 0
+	}
+	return float64(*e.RuntimeS) / 60
+}
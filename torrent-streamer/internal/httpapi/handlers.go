@@ -22,6 +22,7 @@ import (
 	"torrent-streamer/internal/buffer"
 	"torrent-streamer/internal/config"
 	"torrent-streamer/internal/middleware"
+	"torrent-streamer/internal/subtitles"
 	"torrent-streamer/internal/torrentx"
 	"torrent-streamer/internal/watch"
 )
@@ -46,9 +47,10 @@ func getProgressStore() *watch.Store {
 }
 
 type fileEntry struct {
-	Index  int    `json:"index"`
-	Name   string `json:"name"`
-	Length int64  `json:"length"`
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	Length    int64  `json:"length"`
+	MovieHash string `json:"movieHash,omitempty"` // OpenSubtitles hash, once computed
 }
 type addResp struct {
 	InfoHash string      `json:"infoHash"`
@@ -88,13 +90,14 @@ type categoryStats struct {
 	Torrents []torrentStat `json:"torrents"`
 }
 type statsResp struct {
-	UptimeSeconds   int64           `json:"uptimeSeconds"`
-	DataRoot        string          `json:"dataRoot"`
-	TotalCacheBytes int64           `json:"totalCacheBytes"`
-	CacheMaxBytes   int64           `json:"cacheMaxBytes"`
-	EvictTTL        string          `json:"evictTTL"`
-	TrackersMode    string          `json:"trackersMode"`
-	Categories      []categoryStats `json:"categories"`
+	UptimeSeconds   int64                `json:"uptimeSeconds"`
+	DataRoot        string               `json:"dataRoot"`
+	TotalCacheBytes int64                `json:"totalCacheBytes"`
+	CacheMaxBytes   int64                `json:"cacheMaxBytes"`
+	EvictTTL        string               `json:"evictTTL"`
+	TrackersMode    string               `json:"trackersMode"`
+	SubtitleCache   subtitles.CacheStats `json:"subtitleCache"`
+	Categories      []categoryStats      `json:"categories"`
 }
 
 func RegisterRoutes(mux *http.ServeMux) {
@@ -211,6 +214,15 @@ func handleFiles(w http.ResponseWriter, r *http.Request) {
 	for i, f := range t.Files() {
 		files = append(files, fileEntry{Index: i, Name: f.Path(), Length: f.Length()})
 	}
+	// the hash needs both ends of the file; compute it in the background and
+	// report it once known rather than holding up the listing
+	if bf, bestIdx := torrentx.ChooseBestVideoFile(t); bf != nil {
+		if h, ok := torrentx.CachedMovieHash(t, bestIdx); ok {
+			files[bestIdx].MovieHash = h
+		} else {
+			torrentx.WarmMovieHash(t, bestIdx, 2*time.Minute)
+		}
+	}
 	log.Printf("[files] cat=%s ih=%s name=%q files=%d", cat, t.InfoHash().HexString(), t.Name(), len(files))
 	_ = json.NewEncoder(w).Encode(files)
 }
@@ -218,72 +230,38 @@ func handleFiles(w http.ResponseWriter, r *http.Request) {
 func handlePrefetch(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCORS(w)
 	cat := parseCat(r.URL.Query())
-	cl := torrentx.GetClientFor(cat)
 
 	src, err := torrentx.ParseSrc(r.URL.Query())
 	if err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	t, err := torrentx.AddOrGetTorrent(cl, src)
-	if err != nil {
-		http.Error(w, "add torrent: "+err.Error(), 400)
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), config.WaitMetadata())
-	defer cancel()
-	metaStart := time.Now()
-	if err := torrentx.WaitForInfo(ctx, t); err != nil {
-		log.Printf("[prefetch] cat=%s name=%q metadata TIMEOUT after %s", cat, t.Name(), time.Since(metaStart))
+	p, err := torrentx.Prefetch(r.Context(), cat, src, -1, 0)
+	if errors.Is(err, torrentx.ErrMetadataTimeout) {
 		_ = json.NewEncoder(w).Encode(prefetchResp{
-			InfoHash:   t.InfoHash().HexString(),
-			Name:       t.Name(),
-			MetadataMs: time.Since(metaStart).Milliseconds(),
+			InfoHash:   p.Torrent.InfoHash().HexString(),
+			Name:       p.Torrent.Name(),
+			MetadataMs: p.MetadataMs,
 			Note:       "metadata-timeout",
 		})
 		return
 	}
-	metaMs := time.Since(metaStart).Milliseconds()
-	torrentx.SetLastTouch(cat, t.InfoHash())
-
-	// Find and prebuffer subtitle files first (they're small, typically <500KB)
-	subtitleFiles := torrentx.FindSubtitleFiles(t)
-	for _, sub := range subtitleFiles {
-		if sub.Index >= 0 && sub.Index < len(t.Files()) {
-			subFile := t.Files()[sub.Index]
-			// Only prebuffer subtitles up to 2MB
-			if subFile.Length() <= 2<<20 {
-				subRd := subFile.NewReader()
-				subRd.SetResponsive()
-				got := torrentx.Prebuffer(subRd, subFile.Length(), 10*time.Second)
-				subRd.Close()
-				log.Printf("[prefetch] subtitle %s (%s) prebuffered %d/%d bytes",
-					sub.Name, sub.Lang, got, subFile.Length())
-			}
-		}
+	if err != nil {
+		http.Error(w, "add torrent: "+err.Error(), 400)
+		return
 	}
-
-	f, fidx := torrentx.ChooseBestVideoFile(t)
-	if f == nil {
+	t := p.Torrent
+	if p.File == nil {
 		_ = json.NewEncoder(w).Encode(prefetchResp{
 			InfoHash:   t.InfoHash().HexString(),
 			Name:       t.Name(),
-			MetadataMs: metaMs,
+			MetadataMs: p.MetadataMs,
 			Note:       "no-playable-file",
-			Subtitles:  subtitleFiles,
+			Subtitles:  p.Subtitles,
 		})
 		return
 	}
 
-	rd := f.NewReader()
-	defer rd.Close()
-	_, _ = rd.Seek(0, io.SeekStart)
-	readStart := time.Now()
-	got := torrentx.Prebuffer(rd, min64(config.PrebufferBytes(), 512<<10), config.PrebufferTimeout())
-	log.Printf("[prefetch] cat=%s ih=%s file=%d bytes=%d in %s",
-		cat, t.InfoHash().HexString(), fidx, got, time.Since(readStart))
-
 	var files []fileEntry
 	for i, ff := range t.Files() {
 		files = append(files, fileEntry{Index: i, Name: ff.Path(), Length: ff.Length()})
@@ -292,15 +270,15 @@ func handlePrefetch(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(prefetchResp{
 		InfoHash:       t.InfoHash().HexString(),
 		Name:           t.Name(),
-		FileIndex:      fidx,
-		FileName:       f.Path(),
-		FileLength:     f.Length(),
-		MetadataMs:     metaMs,
-		PrebufferBytes: got,
-		PrebufferMs:    time.Since(readStart).Milliseconds(),
+		FileIndex:      p.FileIndex,
+		FileName:       p.File.Path(),
+		FileLength:     p.File.Length(),
+		MetadataMs:     p.MetadataMs,
+		PrebufferBytes: p.PrebufferBytes,
+		PrebufferMs:    p.PrebufferMs,
 		Note:           "ok",
 		Files:          files,
-		Subtitles:      subtitleFiles,
+		Subtitles:      p.Subtitles,
 	})
 }
 
@@ -598,6 +576,7 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 		CacheMaxBytes:   config.CacheMaxBytes(),
 		EvictTTL:        config.EvictTTL().String(),
 		TrackersMode:    strings.ToLower(config.TrackersMode()),
+		SubtitleCache:   subtitles.GetCacheStats(),
 	}
 
 	var cats []categoryStats
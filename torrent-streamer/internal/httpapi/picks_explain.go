@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"torrent-streamer/internal/scoring"
+	"torrent-streamer/internal/torrentx"
+)
+
+// ExplainPick shows why an episode's pick won: every candidate with its
+// component scores or reject reason, and the weights in effect.
+// GET /v1/picks/explain?seriesId=...&season=1&episode=2&(profileHash=...|deviceId=...)[&rescore=1][&estRuntimeMin=42]
+// rescore=1 scores the cached candidates again with the current rules
+// instead of returning what was recorded at pick time.
+func (h *SessionHandlers) ExplainPick(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	series := strings.TrimSpace(q.Get("seriesId"))
+	season, errS := strconv.Atoi(q.Get("season"))
+	episode, errE := strconv.Atoi(q.Get("episode"))
+	if series == "" || errS != nil || errE != nil {
+		http.Error(w, "seriesId, season & episode required", http.StatusBadRequest)
+		return
+	}
+	caps, profileHash, err := h.deviceProfile(r.Context(), q.Get("deviceId"), strings.TrimSpace(q.Get("profileHash")))
+	if err != nil {
+		deviceError(w, err)
+		return
+	}
+	// a hash that already names a scoring version explains picks made under it
+	key := profileHash
+	if !strings.Contains(key, "|sp=") {
+		key = scoring.ProfileKey(key)
+	}
+
+	repo := h.d.Picks.Repo
+	pick, hasPick, err := repo.GetPick(r.Context(), series, season, episode, key)
+	if err != nil {
+		log.Printf("[search] explain %s S%02dE%02d: %v", series, season, episode, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	var recorded *torrentx.Explanation
+	if hasPick {
+		if ex, ok, err := repo.GetExplanation(r.Context(), pick.ID); err != nil {
+			log.Printf("[search] explain pick %d: %v", pick.ID, err)
+		} else if ok {
+			recorded = &ex
+		}
+	}
+
+	out := map[string]any{"profileHash": key, "pick": nil, "explanation": recorded, "rescored": false}
+	if hasPick {
+		out["pick"] = pick
+	}
+
+	if q.Get("rescore") == "1" {
+		// same inputs as the pick was made with, where they were recorded
+		est, _ := strconv.ParseFloat(q.Get("estRuntimeMin"), 64)
+		var hist scoring.History
+		if recorded != nil {
+			caps, hist = recorded.Caps, recorded.History
+			if est <= 0 {
+				est = recorded.EstRuntimeMin
+			}
+		} else {
+			hist = torrentx.LoadHistory(r.Context(), repo, series, season, episode, key)
+		}
+		ex, ok, err := torrentx.Rescore(r.Context(), repo, series, season, episode, key, caps, est, hist)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "no cached candidates for this episode and profile", http.StatusNotFound)
+			return
+		}
+		out["explanation"], out["rescored"] = ex, true
+	} else if !hasPick {
+		http.Error(w, "no pick for this episode and profile", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -9,16 +10,24 @@ import (
 	"strconv"
 	"strings"
 
+	"torrent-streamer/internal/catalog"
+	"torrent-streamer/internal/devices"
+	"torrent-streamer/internal/feeds"
 	"torrent-streamer/internal/middleware"
 	"torrent-streamer/internal/scoring"
+	"torrent-streamer/internal/subtitles"
 	"torrent-streamer/internal/torrentx"
 	"torrent-streamer/internal/watch"
 )
 
 type SessionDeps struct {
-	Picks       torrentx.EnsureDeps // Repo + Search
-	Watch       *watch.Store        // progress store (database/sql)
-	ProfileCaps scoring.ProfileCaps // default device capabilities for scoring
+	Picks       torrentx.EnsureDeps    // Repo + Search
+	Watch       *watch.Store           // progress store (database/sql)
+	ProfileCaps scoring.ProfileCaps    // capabilities for clients without a registered device
+	Devices     *devices.Store         // registered devices and their capabilities (optional)
+	SubChoices  *subtitles.ChoiceStore // remembered subtitle per episode (optional)
+	Watchlist   *feeds.Store           // series followed by the feed watcher (optional)
+	Catalog     *catalog.Catalog       // series episode lists; without it the next episode is guessed (optional)
 }
 
 type SessionHandlers struct {
@@ -36,6 +45,14 @@ func (h *SessionHandlers) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/continue", cors(h.ContinueList))
 	mux.HandleFunc("/v1/continue/dismiss", cors(h.ContinueDismiss))
 	mux.HandleFunc("/v1/resume.m3u", cors(h.ResumeM3U))
+	mux.HandleFunc("/v1/subtitles/choice", cors(h.ChooseSubtitle))
+	mux.HandleFunc("/v1/indexers", cors(h.Indexers))
+	mux.HandleFunc("/v1/watchlist", cors(h.Watchlist))
+	mux.HandleFunc("/v1/devices", cors(h.Devices))
+	mux.HandleFunc("/v1/episodes", cors(h.Episodes))
+	mux.HandleFunc("/v1/picks/explain", cors(h.ExplainPick))
+	mux.HandleFunc("/v1/admin/search-cache", adminOnly(h.PurgeSearchCache))
+	mux.HandleFunc("/subtitles/", cors(h.EpisodeSubtitle))
 }
 
 func cors(next http.HandlerFunc) http.HandlerFunc {
@@ -53,19 +70,26 @@ func (h *SessionHandlers) Start(w http.ResponseWriter, r *http.Request) {
 		SeriesID, SeriesTitle, Kind string
 		Season, Episode             int
 		AbsEpisode                  *int
-		ProfileHash                 string
+		IMDbID, TVDbID              string
+		DeviceID, ProfileHash       string
 		EstRuntimeMin               float64
 	}
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
+	caps, profileHash, err := h.deviceProfile(r.Context(), in.DeviceID, in.ProfileHash)
+	if err != nil {
+		deviceError(w, err)
+		return
+	}
 
 	p, err := torrentx.EnsurePick(r.Context(), h.d.Picks, torrentx.EnsureInput{
 		SeriesID: in.SeriesID, SeriesTitle: in.SeriesTitle, Kind: in.Kind,
 		Season: in.Season, Episode: in.Episode, AbsEpisode: in.AbsEpisode,
-		ProfileHash: in.ProfileHash, EstRuntimeMin: in.EstRuntimeMin,
-		ProfileCaps: h.d.ProfileCaps, // ← important: pass caps to scoring
+		IMDbID: in.IMDbID, TVDbID: in.TVDbID,
+		ProfileHash: profileHash, EstRuntimeMin: in.EstRuntimeMin,
+		ProfileCaps: caps, // ← important: pass caps to scoring
 	})
 	if err != nil {
 		http.Error(w, "pick error: "+err.Error(), http.StatusInternalServerError)
@@ -77,12 +101,34 @@ func (h *SessionHandlers) Start(w http.ResponseWriter, r *http.Request) {
 		streamURL += "&fileIndex=" + strconv.Itoa(*p.FileIndex)
 	}
 
+	var nextHint map[string]any
+	if next, ok := h.nextEpisode(r.Context(), in.SeriesID, in.Season, in.Episode); ok {
+		nextHint = map[string]any{"seriesId": in.SeriesID, "season": next.Season, "episode": next.Episode, "ready": false}
+		if next.AbsoluteEp != nil {
+			nextHint["absEpisode"] = *next.AbsoluteEp
+		}
+	}
+
 	_ = json.NewEncoder(w).Encode(map[string]any{
 		"sessionId": "",
 		"pick":      p,
 		"streamUrl": streamURL,
-		"nextHint":  map[string]any{"seriesId": in.SeriesID, "season": in.Season, "episode": in.Episode + 1, "ready": false},
+		"nextHint":  nextHint, // null after the last aired episode
+	})
+}
+
+// Indexers reports per-indexer latency, error rate and circuit state
+// GET /v1/indexers
+func (h *SessionHandlers) Indexers(w http.ResponseWriter, r *http.Request) {
+	hs, ok := h.d.Picks.Search.(interface {
+		Health() []torrentx.IndexerHealth
 	})
+	if !ok {
+		http.Error(w, "indexer health not available", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(hs.Health())
 }
 
 func (h *SessionHandlers) Heartbeat(w http.ResponseWriter, r *http.Request) {
@@ -129,6 +175,7 @@ func (h *SessionHandlers) Resume(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(map[string]any{"found": false})
 		return
 	}
+	h.resumeEpisode(r.Context(), &res)
 	pos := res.Position
 	if pos > 10 {
 		pos -= 10
@@ -185,19 +232,39 @@ func (h *SessionHandlers) Ended(w http.ResponseWriter, r *http.Request) {
 	var in struct {
 		SeriesID, SeriesTitle, Kind string
 		Season, Episode             int
-		ProfileHash                 string
+		IMDbID, TVDbID              string
+		DeviceID, ProfileHash       string
 		EstRuntimeMin               float64
 	}
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
-	nextSeason, nextEp := in.Season, in.Episode+1
+	caps, profileHash, err := h.deviceProfile(r.Context(), in.DeviceID, in.ProfileHash)
+	if err != nil {
+		deviceError(w, err)
+		return
+	}
+	h.completedGroup(r.Context(), in.SeriesID, in.Season, in.Episode, profileHash)
+	next, ok := h.nextEpisode(r.Context(), in.SeriesID, in.Season, in.Episode)
+	if !ok {
+		_ = json.NewEncoder(w).Encode(map[string]any{"nextPick": nil, "finished": true})
+		return
+	}
+	var abs *int
+	if in.Kind == "anime" {
+		abs = next.AbsoluteEp
+	}
+	estRuntimeMin := in.EstRuntimeMin
+	if rt := runtimeMin(next); rt > 0 {
+		estRuntimeMin = rt
+	}
 	p, err := torrentx.EnsurePick(r.Context(), h.d.Picks, torrentx.EnsureInput{
 		SeriesID: in.SeriesID, SeriesTitle: in.SeriesTitle, Kind: in.Kind,
-		Season: nextSeason, Episode: nextEp,
-		ProfileHash: in.ProfileHash, EstRuntimeMin: in.EstRuntimeMin,
-		ProfileCaps: h.d.ProfileCaps,
+		Season: next.Season, Episode: next.Episode, AbsEpisode: abs,
+		IMDbID: in.IMDbID, TVDbID: in.TVDbID,
+		ProfileHash: profileHash, EstRuntimeMin: estRuntimeMin,
+		ProfileCaps: caps,
 	})
 	if err != nil {
 		http.Error(w, "pick error: "+err.Error(), http.StatusInternalServerError)
@@ -214,12 +281,30 @@ func (h *SessionHandlers) Ended(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// completedGroup credits the release group of a finished episode's pick
+// towards the series' preferred group
+func (h *SessionHandlers) completedGroup(ctx context.Context, seriesID string, season, episode int, profileHash string) {
+	repo := h.d.Picks.Repo
+	p, ok, err := repo.GetPick(ctx, seriesID, season, episode, scoring.ProfileKey(profileHash))
+	if err == nil && !ok {
+		p, ok, err = repo.LatestPick(ctx, seriesID, season, episode)
+	}
+	if err != nil || !ok || p.ReleaseGroup == nil {
+		return
+	}
+	if err := repo.ReinforceGroup(ctx, seriesID, *p.ReleaseGroup); err != nil {
+		log.Printf("[search] group preference %s: %v", seriesID, err)
+	}
+}
+
 func (h *SessionHandlers) ResumeM3U(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	subject := strings.TrimSpace(q.Get("subjectId"))
 	series := strings.TrimSpace(q.Get("seriesId"))
 	kind := strings.TrimSpace(q.Get("kind"))         // movie|tv|anime
 	title := strings.TrimSpace(q.Get("seriesTitle")) // optional, for display in players
+	imdbID := strings.TrimSpace(q.Get("imdbId"))     // optional, for id-based indexer search
+	tvdbID := strings.TrimSpace(q.Get("tvdbId"))
 	// optional hints (fallbacks if unknown)
 	estRuntimeMin := 0.0
 	if v := q.Get("estRuntimeMin"); v != "" {
@@ -227,6 +312,7 @@ func (h *SessionHandlers) ResumeM3U(w http.ResponseWriter, r *http.Request) {
 			estRuntimeMin = float64(n)
 		}
 	}
+	deviceID := strings.TrimSpace(q.Get("deviceId")) // registered device; overrides profileHash
 	profileHash := q.Get("profileHash")
 	subURL := strings.TrimSpace(q.Get("subUrl")) // optional: if you already have a subtitle URL
 
@@ -248,6 +334,10 @@ func (h *SessionHandlers) ResumeM3U(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no resume state", http.StatusNotFound)
 		return
 	}
+	h.resumeEpisode(r.Context(), &res)
+	if estRuntimeMin <= 0 && res.Duration > 0 {
+		estRuntimeMin = float64(res.Duration) / 60
+	}
 	// rewind 10s (already done in /v1/resume, but we include here too)
 	pos := res.Position
 	if pos > 10 {
@@ -265,15 +355,18 @@ func (h *SessionHandlers) ResumeM3U(w http.ResponseWriter, r *http.Request) {
 			estRuntimeMin = 42
 		}
 	}
-	if profileHash == "" {
-		profileHash = "caps:h264|v1"
+	caps, profileHash, err := h.deviceProfile(r.Context(), deviceID, profileHash)
+	if err != nil {
+		deviceError(w, err)
+		return
 	}
 
 	p, err := torrentx.EnsurePick(r.Context(), h.d.Picks, torrentx.EnsureInput{
 		SeriesID: series, SeriesTitle: title, Kind: kind,
 		Season: res.Season, Episode: res.Episode,
+		IMDbID: imdbID, TVDbID: tvdbID,
 		ProfileHash: profileHash, EstRuntimeMin: estRuntimeMin,
-		ProfileCaps: h.d.ProfileCaps,
+		ProfileCaps: caps,
 	})
 	if err != nil {
 		http.Error(w, "pick error: "+err.Error(), http.StatusInternalServerError)
@@ -287,11 +380,20 @@ func (h *SessionHandlers) ResumeM3U(w http.ResponseWriter, r *http.Request) {
 	}
 	streamURL += "&cat=" + url.QueryEscape(kind)
 
-	// 4) (optional) guess a subtitle URL if none supplied; you will implement this later
-	// expected future route: /subtitles/:episodeKey.vtt (you can change to .srt if you transcode)
+	// 4) subtitle for the episode unless the caller supplied one; the route
+	// resolves the pick above and the subject's language/choice
 	if subURL == "" {
-		// simple, deterministic key for now — adjust to your final subtitle endpoint scheme
-		subURL = fmt.Sprintf("/subtitles/%s_s%02de%02d.vtt", url.PathEscape(series), res.Season, res.Episode)
+		sq := url.Values{}
+		sq.Set("subjectId", subject)
+		sq.Set("profileHash", profileHash)
+		sq.Set("cat", kind)
+		if title != "" {
+			sq.Set("title", title)
+		}
+		if imdbID != "" {
+			sq.Set("imdbId", imdbID)
+		}
+		subURL = fmt.Sprintf("/subtitles/%s_s%02de%02d.vtt?%s", url.PathEscape(series), res.Season, res.Episode, sq.Encode())
 	}
 
 	// 5) render M3U with VLC options
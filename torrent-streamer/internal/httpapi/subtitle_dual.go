@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"torrent-streamer/internal/config"
+	"torrent-streamer/internal/middleware"
+	"torrent-streamer/internal/subtitles"
+	"torrent-streamer/internal/torrentx"
+)
+
+// handleSubtitleDual merges two subtitles into one VTT showing both
+// languages, for watching with a native and a target language at once.
+// primary/secondary are "torrent:<fileIndex>", "embedded:<track>" or
+// "<provider>:<id>"; torrent sources need magnet. Saved sync corrections for
+// subjectId apply to each source before the cues are aligned.
+// layout=below|above stacks the secondary line in the same cue, layout=top
+// shows it as its own cue at line=<percent> from the top.
+// GET /subtitles/dual?primary=torrent:2&secondary=subdl:12345&primaryLang=ja&secondaryLang=en&magnet=...&cat=anime[&layout=below&line=5&subjectId=...&infoHash=...]
+func handleSubtitleDual(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCORS(w)
+	q := r.URL.Query()
+
+	prim, err := parseDualSource(q.Get("primary"), q.Get("primaryLang"))
+	if err != nil {
+		http.Error(w, "primary: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	sec, err := parseDualSource(q.Get("secondary"), q.Get("secondaryLang"))
+	if err != nil {
+		http.Error(w, "secondary: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opt := subtitles.DualOptions{Layout: q.Get("layout")}
+	switch opt.Layout {
+	case "", subtitles.DualBelow, subtitles.DualAbove, subtitles.DualTop:
+	default:
+		http.Error(w, "layout must be below, above or top", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("line"); v != "" {
+		if opt.Line, err = strconv.Atoi(v); err != nil || opt.Line < 0 || opt.Line > 100 {
+			http.Error(w, "invalid line", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	// the torrent is only needed for torrent and embedded sources
+	var es episodeSubs
+	ih := strings.ToLower(q.Get("infoHash"))
+	if isTorrentSource(prim.Source) || isTorrentSource(sec.Source) {
+		src, err := torrentx.ParseSrc(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cat := parseCat(q)
+		t, err := torrentx.AddOrGetTorrent(torrentx.GetClientFor(cat), src)
+		if err != nil {
+			http.Error(w, "add torrent: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		mctx, mcancel := context.WithTimeout(r.Context(), config.WaitMetadata())
+		defer mcancel()
+		if err := torrentx.WaitForInfo(mctx, t); err != nil {
+			http.Error(w, "metadata timeout", http.StatusGatewayTimeout)
+			return
+		}
+		torrentx.SetLastTouch(cat, t.InfoHash())
+		ih = t.InfoHash().HexString()
+		es.t = t
+		es.video, es.videoIdx = torrentx.ChooseBestVideoFile(t)
+		if n, err := strconv.Atoi(q.Get("fileIndex")); err == nil && n >= 0 && n < len(t.Files()) {
+			es.video, es.videoIdx = t.Files()[n], n
+		}
+	}
+
+	subject := strings.TrimSpace(q.Get("subjectId"))
+	var tracks [2][]subtitles.Cue
+	complete := true
+	for i, c := range []subtitles.Choice{prim, sec} {
+		vtt, subKey, done, err := es.fetch(ctx, c)
+		if errors.Is(err, subtitles.ErrUnknownProvider) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s:%s: %v", c.Source, c.Ref, err), http.StatusBadGateway)
+			return
+		}
+		complete = complete && done
+		vtt = subtitles.Retimed(subKey, vtt, savedTransform(r.Context(), subject, ih, subKey))
+		tracks[i] = subtitles.ParseVTT(vtt)
+	}
+
+	vtt := subtitles.WriteDualVTT(subtitles.MergeDual(tracks[0], tracks[1], opt))
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	if prim.Lang != "" && sec.Lang != "" {
+		w.Header().Set("Content-Language", prim.Lang+", "+sec.Lang)
+	}
+	if complete {
+		setSubtitleCacheControl(w, r)
+	} else {
+		w.Header().Set("X-Subtitle-Complete", "false")
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	_, _ = w.Write([]byte(vtt))
+}
+
+// parseDualSource splits "torrent:2" / "subdl:12345" into a subtitle choice
+func parseDualSource(spec, lang string) (subtitles.Choice, error) {
+	source, ref, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok || source == "" || ref == "" {
+		return subtitles.Choice{}, fmt.Errorf("expected <source>:<ref>, got %q", spec)
+	}
+	return subtitles.Choice{Source: source, Ref: ref, Lang: subtitles.NormalizeLang(lang)}, nil
+}
+
+func isTorrentSource(source string) bool { return source == "torrent" || source == "embedded" }
@@ -0,0 +1,345 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+
+	"torrent-streamer/internal/config"
+	"torrent-streamer/internal/scoring"
+	"torrent-streamer/internal/subtitles"
+	"torrent-streamer/internal/torrentx"
+)
+
+var episodeKeyRe = regexp.MustCompile(`(?i)^(.+)_s(\d{1,3})e(\d{1,4})$`)
+
+// parseEpisodeKey splits "<series>_s01e05" as emitted by ResumeM3U
+func parseEpisodeKey(key string) (series string, season, episode int, ok bool) {
+	m := episodeKeyRe.FindStringSubmatch(key)
+	if m == nil {
+		return "", 0, 0, false
+	}
+	season, _ = strconv.Atoi(m[2])
+	episode, _ = strconv.Atoi(m[3])
+	return m[1], season, episode, true
+}
+
+// EpisodeSubtitle serves the sub-file that resume.m3u points players at.
+// The episode's current pick is loaded and the subject's remembered choice is
+// served if it still applies; otherwise the best subtitle in the preferred
+// languages is chosen: files in the torrent, then tracks muxed into the
+// video, then external providers. ?source=&ref= serves one explicitly for
+// this request only; choices are remembered through POST /v1/subtitles/choice,
+// since players prefetch and retry GETs.
+// GET /subtitles/<series>_s01e05.vtt?subjectId=&profileHash=&cat=tv&langs=en,es[&title=&imdbId=&tmdbId=]
+func (h *SessionHandlers) EpisodeSubtitle(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/subtitles/")
+	if !strings.HasSuffix(name, ".vtt") {
+		http.NotFound(w, r)
+		return
+	}
+	series, season, episode, ok := parseEpisodeKey(strings.TrimSuffix(name, ".vtt"))
+	if !ok {
+		http.Error(w, "bad episode key", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	subject := strings.TrimSpace(q.Get("subjectId"))
+	cat := parseCat(q)
+
+	// 1) the episode's current pick
+	var pick torrentx.PickRow
+	var err error
+	if ph := q.Get("profileHash"); ph != "" {
+		pick, ok, err = h.d.Picks.Repo.GetPick(r.Context(), series, season, episode, scoring.ProfileKey(ph))
+	}
+	if err == nil && !ok {
+		pick, ok, err = h.d.Picks.Repo.LatestPick(r.Context(), series, season, episode)
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "no pick for episode", http.StatusNotFound)
+		return
+	}
+
+	t, err := torrentx.AddOrGetTorrent(torrentx.GetClientFor(cat), pick.Magnet)
+	if err != nil {
+		http.Error(w, "add torrent: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), config.WaitMetadata())
+	defer cancel()
+	if err := torrentx.WaitForInfo(ctx, t); err != nil {
+		http.Error(w, "metadata timeout", http.StatusGatewayTimeout)
+		return
+	}
+	torrentx.SetLastTouch(cat, t.InfoHash())
+	ih := t.InfoHash().HexString()
+
+	vf, vidx := torrentx.ChooseBestVideoFile(t)
+	if pick.FileIndex != nil && *pick.FileIndex >= 0 && *pick.FileIndex < len(t.Files()) {
+		vf, vidx = t.Files()[*pick.FileIndex], *pick.FileIndex
+	}
+	es := episodeSubs{t: t, video: vf, videoIdx: vidx}
+
+	// 2) explicit choice in the URL, then the remembered one
+	var tries []subtitles.Choice
+	if src, ref := q.Get("source"), q.Get("ref"); src != "" && ref != "" {
+		tries = append(tries, subtitles.Choice{Source: src, Ref: ref, Lang: subtitles.NormalizeLang(q.Get("lang")), InfoHash: ih})
+	} else if h.d.SubChoices != nil && subject != "" {
+		c, ok, err := h.d.SubChoices.GetChoice(r.Context(), subject, series, season, episode)
+		if err != nil {
+			log.Printf("[subtitles] load choice %s %s: %v", subject, name, err)
+		}
+		// torrent refs are only meaningful for the torrent they were made against
+		if ok && (c.InfoHash == "" || strings.EqualFold(c.InfoHash, ih)) {
+			tries = append(tries, c)
+		}
+	}
+
+	// 3) automatic candidates by language preference
+	langs := h.subtitleLangs(r, subject, series)
+	sq := subtitles.Query{
+		IMDbID: strings.TrimSpace(q.Get("imdbId")),
+		TMDbID: strings.TrimSpace(q.Get("tmdbId")),
+		Title:  strings.TrimSpace(q.Get("title")),
+		Kind:   cat,
+		Season: season, Episode: episode,
+		Langs: langs,
+	}
+	if vf != nil {
+		sq.ReleaseName = filepath.Base(vf.Path())
+		if hsh, ok := torrentx.CachedMovieHash(t, vidx); ok {
+			sq.MovieHash = hsh
+		}
+	}
+	tries = append(tries, es.candidates(r.Context(), langs, sq)...)
+
+	const maxTries = 4
+	for i, c := range tries {
+		if i >= maxTries {
+			break
+		}
+		vtt, subKey, complete, err := es.fetch(r.Context(), c)
+		if err != nil {
+			log.Printf("[subtitles] %s: %s:%s failed: %v", name, c.Source, c.Ref, err)
+			continue
+		}
+		tr, err := subtitleTransform(w, r, ih, subKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vtt = subtitles.Retimed(subKey, vtt, tr)
+
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+		w.Header().Set("X-Subtitle-Source", c.Source+":"+c.Ref)
+		if c.Lang != "" {
+			w.Header().Set("Content-Language", c.Lang)
+		}
+		if complete {
+			setSubtitleCacheControl(w, r)
+		} else {
+			w.Header().Set("X-Subtitle-Complete", "false")
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		_, _ = w.Write([]byte(vtt))
+		return
+	}
+	http.Error(w, "no subtitle in preferred languages", http.StatusNotFound)
+}
+
+// ChooseSubtitle remembers the subject's subtitle for an episode; the
+// episode route serves it from then on
+// POST /v1/subtitles/choice {subjectId, seriesId, season, episode, source, ref, lang, infoHash}
+func (h *SessionHandlers) ChooseSubtitle(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		SubjectID string `json:"subjectId"`
+		SeriesID  string `json:"seriesId"`
+		Season    int    `json:"season"`
+		Episode   int    `json:"episode"`
+		subtitles.Choice
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if in.SubjectID == "" || in.SeriesID == "" || in.Source == "" || in.Ref == "" {
+		http.Error(w, "subjectId, seriesId, source & ref required", http.StatusBadRequest)
+		return
+	}
+	if h.d.SubChoices == nil {
+		http.Error(w, "subtitle choices not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	in.Lang = subtitles.NormalizeLang(in.Lang)
+	in.InfoHash = strings.ToLower(in.InfoHash)
+	if err := h.d.SubChoices.SaveChoice(r.Context(), in.SubjectID, in.SeriesID, in.Season, in.Episode, in.Choice); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// subtitleLangs resolves preferred languages: ?langs=, else the languages the
+// subject chose before for this series, else Accept-Language, else English
+func (h *SessionHandlers) subtitleLangs(r *http.Request, subject, series string) []string {
+	var raw []string
+	if v := r.URL.Query().Get("langs"); v != "" {
+		raw = strings.Split(v, ",")
+	} else if h.d.SubChoices != nil && subject != "" {
+		if recent, err := h.d.SubChoices.RecentLangs(r.Context(), subject, series); err == nil {
+			raw = recent
+		}
+	}
+	if len(raw) == 0 {
+		for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+			tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+			tag, _, _ = strings.Cut(tag, "-")
+			if tag != "" && tag != "*" {
+				raw = append(raw, tag)
+			}
+		}
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, l := range raw {
+		if l = subtitles.NormalizeLang(l); l != "" && !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	if len(out) == 0 {
+		out = []string{"en"}
+	}
+	return out
+}
+
+// episodeSubs gathers and fetches the subtitles available for a pick
+type episodeSubs struct {
+	t        *torrent.Torrent
+	video    *torrent.File
+	videoIdx int
+}
+
+// candidates lists subtitles per preferred language: torrent files, then
+// embedded tracks (forced ones last), then external providers, which are
+// only queried when the torrent has nothing in that language
+func (es episodeSubs) candidates(ctx context.Context, langs []string, sq subtitles.Query) []subtitles.Choice {
+	ih := es.t.InfoHash().HexString()
+	files := torrentx.FindSubtitleFiles(es.t)
+	var tracks []subtitles.MKVTrack
+	if es.video != nil && strings.EqualFold(filepath.Ext(es.video.Path()), ".mkv") {
+		if info, err := probeEmbedded(es.video, 5*time.Second); err == nil {
+			tracks = info.Tracks
+		}
+	}
+
+	var external []subtitles.SubResult
+	searched := false
+	var out []subtitles.Choice
+	for _, lang := range langs {
+		n := len(out)
+		for _, f := range files {
+			if f.Lang == lang {
+				out = append(out, subtitles.Choice{Source: "torrent", Ref: strconv.Itoa(f.Index), Lang: lang, InfoHash: ih})
+			}
+		}
+		for _, forced := range []bool{false, true} {
+			for _, tr := range tracks {
+				if tr.Ext != "" && tr.Lang == lang && tr.Forced == forced {
+					out = append(out, subtitles.Choice{Source: "embedded", Ref: strconv.FormatUint(tr.Number, 10), Lang: lang, InfoHash: ih})
+				}
+			}
+		}
+		if len(out) > n {
+			continue
+		}
+		if !searched {
+			searched = true
+			sctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+			external, _ = getSubtitleProviders().Search(sctx, sq)
+			cancel()
+		}
+		for _, s := range external {
+			if s.Lang == lang {
+				out = append(out, subtitles.Choice{Source: s.Source, Ref: s.ID, Lang: lang})
+			}
+		}
+	}
+	return out
+}
+
+// fetch returns c as VTT with the key its sync corrections and cache use;
+// complete is false while an embedded track is still downloading
+// (es.t may be nil when only provider subtitles are fetched)
+func (es episodeSubs) fetch(ctx context.Context, c subtitles.Choice) (vtt, subKey string, complete bool, err error) {
+	switch c.Source {
+	case "torrent":
+		idx, err := strconv.Atoi(c.Ref)
+		if err != nil || es.t == nil || idx < 0 || idx >= len(es.t.Files()) {
+			return "", "", false, fmt.Errorf("bad file index %q", c.Ref)
+		}
+		subKey = fmt.Sprintf("torrent:%s:%d", es.t.InfoHash().HexString(), idx)
+		if vtt, ok := subtitles.GetCachedVTT(subKey); ok {
+			return vtt, subKey, true, nil
+		}
+		lang := c.Lang
+		if lang == "" {
+			lang = torrentx.DetectLanguage(es.t.Files()[idx].Path())
+		}
+		vtt, enc, err := readTorrentSubtitle(es.t.Files()[idx], lang)
+		if err != nil {
+			return "", "", false, err
+		}
+		subtitles.PutCachedVTT(subKey, vtt, enc)
+		return vtt, subKey, true, nil
+
+	case "embedded":
+		track, err := strconv.ParseUint(c.Ref, 10, 64)
+		if err != nil || es.video == nil {
+			return "", "", false, fmt.Errorf("bad track %q", c.Ref)
+		}
+		subKey = fmt.Sprintf("embedded:%s:%d:%d", es.t.InfoHash().HexString(), es.videoIdx, track)
+		if vtt, ok := subtitles.GetCachedVTT(subKey); ok {
+			return vtt, subKey, true, nil
+		}
+		info, err := probeEmbedded(es.video, 10*time.Second)
+		if err != nil {
+			return "", "", false, err
+		}
+		rd := es.video.NewReader()
+		defer rd.Close()
+		vtt, complete, err := subtitles.ExtractMKVSubtitles(mkvSource(es.video, rd), info, track)
+		if err != nil {
+			return "", "", false, err
+		}
+		if complete {
+			subtitles.PutCachedVTT(subKey, vtt, "")
+		}
+		return vtt, subKey, complete, nil
+
+	default:
+		vtt, err := getSubtitleProviders().Download(ctx, c.Source, c.Ref, c.Lang)
+		if errors.Is(err, subtitles.ErrUnknownProvider) {
+			return "", "", false, fmt.Errorf("%w: %s", err, c.Source)
+		}
+		if err != nil {
+			return "", "", false, err
+		}
+		return vtt, c.Source + ":" + c.Ref, true, nil
+	}
+}
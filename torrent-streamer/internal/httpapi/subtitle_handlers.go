@@ -3,24 +3,70 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/anacrolix/torrent"
+
 	"torrent-streamer/internal/config"
 	"torrent-streamer/internal/middleware"
 	"torrent-streamer/internal/subtitles"
 	"torrent-streamer/internal/torrentx"
 )
 
-// SubtitleListResponse is the response for /subtitles/list
+// SubtitleListResponse is the response for /subtitles/list. Encoding is only
+// reported for subtitles that are already local (fully downloaded torrent
+// files, cached external downloads); the subtitle routes always send it in
+// X-Subtitle-Encoding.
 type SubtitleListResponse struct {
-	Torrent  []torrentx.SubtitleFile `json:"torrent"`
-	External []subtitles.SubResult   `json:"external"`
+	Torrent   []torrentx.SubtitleFile    `json:"torrent"`
+	Embedded  []subtitles.MKVTrack       `json:"embedded"`
+	External  []subtitles.SubResult      `json:"external"`
+	Providers []subtitles.ProviderReport `json:"providers,omitempty"`
+}
+
+var (
+	syncStore   *subtitles.SyncStore
+	syncStoreMu sync.RWMutex
+
+	subProviders   = subtitles.NewRegistry()
+	subProvidersMu sync.RWMutex
+)
+
+// SetSubtitleProviders sets the external subtitle providers used by
+// /subtitles/list and /subtitles/external
+func SetSubtitleProviders(reg *subtitles.Registry) {
+	subProvidersMu.Lock()
+	subProviders = reg
+	subProvidersMu.Unlock()
+}
+
+func getSubtitleProviders() *subtitles.Registry {
+	subProvidersMu.RLock()
+	defer subProvidersMu.RUnlock()
+	return subProviders
+}
+
+// SetSubtitleSyncStore enables persisted per-user subtitle timing corrections
+func SetSubtitleSyncStore(s *subtitles.SyncStore) {
+	syncStoreMu.Lock()
+	syncStore = s
+	syncStoreMu.Unlock()
+}
+
+func getSyncStore() *subtitles.SyncStore {
+	syncStoreMu.RLock()
+	defer syncStoreMu.RUnlock()
+	return syncStore
 }
 
 // RegisterSubtitleRoutes registers subtitle-related HTTP handlers
@@ -28,16 +74,34 @@ func RegisterSubtitleRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/subtitles/list", handleSubtitleList)
 	mux.HandleFunc("/subtitles/torrent", handleSubtitleTorrent)
 	mux.HandleFunc("/subtitles/external", handleSubtitleExternal)
+	mux.HandleFunc("/subtitles/embedded", handleSubtitleEmbedded)
+	mux.HandleFunc("/subtitles/dual", handleSubtitleDual)
+	mux.HandleFunc("/subtitles/sync", cors(handleSubtitleSync))
 }
 
 // handleSubtitleList returns available subtitles from both torrent and external sources
 // GET /subtitles/list?magnet=...&cat=movie&imdbId=tt1234567&langs=en,hi
+// Episodes: &season=1&episode=5 (anime: &absEpisode=28), ids via imdbId,
+// tmdbId or malId; &title= is the text fallback. External results are
+// filtered to the episode and ranked against the streaming file's name.
 func handleSubtitleList(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCORS(w)
 	q := r.URL.Query()
 	cat := parseCat(q)
-	imdbID := q.Get("imdbId")
 	langsStr := q.Get("langs")
+	sq := subtitles.Query{
+		IMDbID: strings.TrimSpace(q.Get("imdbId")),
+		TMDbID: strings.TrimSpace(q.Get("tmdbId")),
+		MALID:  strings.TrimSpace(q.Get("malId")),
+		Title:  strings.TrimSpace(q.Get("title")),
+		Kind:   strings.ToLower(q.Get("kind")),
+	}
+	sq.Season, _ = strconv.Atoi(q.Get("season"))
+	sq.Episode, _ = strconv.Atoi(q.Get("episode"))
+	sq.AbsEpisode, _ = strconv.Atoi(q.Get("absEpisode"))
+	if sq.Kind == "" && (cat == "movie" || cat == "tv" || cat == "anime") {
+		sq.Kind = cat
+	}
 
 	var langs []string
 	if langsStr != "" {
@@ -46,10 +110,12 @@ func handleSubtitleList(w http.ResponseWriter, r *http.Request) {
 
 	resp := SubtitleListResponse{
 		Torrent:  []torrentx.SubtitleFile{},
+		Embedded: []subtitles.MKVTrack{},
 		External: []subtitles.SubResult{},
 	}
 
 	// Try to get torrent subtitles
+	var infoHash string
 	src, err := torrentx.ParseSrc(q)
 	if err == nil && src != "" {
 		cl := torrentx.GetClientFor(cat)
@@ -59,45 +125,63 @@ func handleSubtitleList(w http.ResponseWriter, r *http.Request) {
 			defer cancel()
 			if err := torrentx.WaitForInfo(ctx, t); err == nil {
 				torrentx.SetLastTouch(cat, t.InfoHash())
+				infoHash = t.InfoHash().HexString()
 				resp.Torrent = torrentx.FindSubtitleFiles(t)
 
-				// Build URLs for torrent subtitles
+				// Build URLs for torrent subtitles; report the charset of files already downloaded
 				for i := range resp.Torrent {
 					resp.Torrent[i].Path = buildSubtitleTorrentURL(q, resp.Torrent[i].Index)
+					resp.Torrent[i].Encoding = sniffTorrentSubtitle(t.Files()[resp.Torrent[i].Index], resp.Torrent[i].Lang)
+				}
+
+				// Text tracks muxed into the video file (MKV only)
+				f, fidx := torrentx.ChooseBestVideoFile(t)
+				if f != nil {
+					sq.ReleaseName = filepath.Base(f.Path())
+					// never wait for the file ends here: a hash computed in the
+					// background serves the next listing
+					if h, ok := torrentx.CachedMovieHash(t, fidx); ok {
+						sq.MovieHash = h
+					} else {
+						torrentx.WarmMovieHash(t, fidx, 2*time.Minute)
+					}
+				}
+				if f != nil && strings.EqualFold(filepath.Ext(f.Path()), ".mkv") {
+					if info, err := probeEmbedded(f, 5*time.Second); err == nil {
+						for _, tr := range info.Tracks {
+							if tr.Ext == "" {
+								continue
+							}
+							tr.URL = buildSubtitleEmbeddedURL(q, fidx, tr.Number)
+							resp.Embedded = append(resp.Embedded, tr)
+						}
+					} else {
+						log.Printf("[subtitles] embedded probe %q: %v", f.Path(), err)
+					}
 				}
 			}
 		}
 	}
 
-	// If we have an IMDB ID, search external sources
-	if imdbID != "" {
+	// Search all external providers in parallel when we know what we're
+	// playing: an id, a title, or (anime) a release name to derive it from
+	if sq.IMDbID != "" || sq.TMDbID != "" || sq.MALID != "" || sq.Title != "" || sq.MovieHash != "" || (sq.IsEpisode() && sq.ReleaseName != "") {
 		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
 		defer cancel()
 
-		// Try Subdl first (free, no API key)
-		subdlResults, err := subtitles.FetchFromSubdl(ctx, imdbID, langs)
-		if err != nil {
-			log.Printf("[subtitles] subdl error: %v", err)
-		} else {
-			for _, sub := range subdlResults {
-				sub.URL = buildSubtitleExternalURL("subdl", sub.ID, sub.Lang)
-				resp.External = append(resp.External, sub)
+		sq.Langs = langs
+		results, reports := getSubtitleProviders().Search(ctx, sq)
+		for _, rep := range reports {
+			if rep.Error != "" {
+				log.Printf("[subtitles] %s error: %s", rep.Name, rep.Error)
 			}
 		}
-
-		// If Subdl didn't return results or we want more, try OpenSubtitles
-		openSubKey := os.Getenv("OPENSUB_API_KEY")
-		if len(resp.External) == 0 && openSubKey != "" {
-			osResults, err := subtitles.FetchFromOpenSub(ctx, imdbID, langs, openSubKey)
-			if err != nil {
-				log.Printf("[subtitles] opensub error: %v", err)
-			} else {
-				for _, sub := range osResults {
-					sub.URL = buildSubtitleExternalURL("opensub", sub.ID, sub.Lang)
-					resp.External = append(resp.External, sub)
-				}
-			}
+		for _, sub := range results {
+			sub.URL = buildSubtitleExternalURL(sub.Source, sub.ID, sub.Lang, infoHash)
+			sub.Encoding = subtitles.CachedEncoding(sub.Source, sub.ID)
+			resp.External = append(resp.External, sub)
 		}
+		resp.Providers = reports
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -105,7 +189,7 @@ func handleSubtitleList(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleSubtitleTorrent serves a subtitle file from the torrent as VTT
-// GET /subtitles/torrent?magnet=...&cat=movie&fileIndex=2
+// GET /subtitles/torrent?magnet=...&cat=movie&fileIndex=2[&offsetMs=-1500&fps=25:23.976&subjectId=...]
 func handleSubtitleTorrent(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCORS(w)
 	q := r.URL.Query()
@@ -146,92 +230,390 @@ func handleSubtitleTorrent(w http.ResponseWriter, r *http.Request) {
 
 	f := t.Files()[fileIndex]
 
-	// Verify it's a subtitle file
-	ext := strings.ToLower(strings.TrimPrefix(strings.ToLower(f.Path()[len(f.Path())-4:]), "."))
-	validExts := map[string]bool{"srt": true, "vtt": true, "ass": true, "ssa": true, "sub": true}
-	if !validExts[ext] {
-		http.Error(w, "not a subtitle file", http.StatusBadRequest)
+	vtt, enc, err := readTorrentSubtitle(f, torrentx.DetectLanguage(f.Path()))
+	if errors.Is(err, errNotSubtitle) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Read the subtitle file
-	reader := f.NewReader()
-	defer reader.Close()
-	reader.SetResponsive()
-
-	// Prebuffer the entire subtitle (they're small)
-	_ = torrentx.Prebuffer(reader, f.Length(), 30*time.Second)
-	_, _ = reader.Seek(0, io.SeekStart)
-
-	data, err := io.ReadAll(io.LimitReader(reader, 5<<20)) // 5MB limit
 	if err != nil {
 		http.Error(w, "failed to read subtitle: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	content := string(data)
-
-	// Convert to VTT if needed
-	var vtt string
-	if strings.HasPrefix(strings.TrimSpace(content), "WEBVTT") {
-		vtt = content
-	} else {
-		vtt = subtitles.SRTtoVTT(content)
+	ih := t.InfoHash().HexString()
+	subKey := fmt.Sprintf("torrent:%s:%d", ih, fileIndex)
+	tr, err := subtitleTransform(w, r, ih, subKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	vtt = subtitles.Retimed(subKey, vtt, tr)
 
 	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("X-Subtitle-Encoding", enc)
+	setSubtitleCacheControl(w, r)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	_, _ = w.Write([]byte(vtt))
 }
 
 // handleSubtitleExternal fetches and serves an external subtitle as VTT
-// GET /subtitles/external?source=subdl&id=12345&lang=en
+// GET /subtitles/external?source=subdl&id=12345&lang=en[&infoHash=...&offsetMs=800&fps=23.976:25&subjectId=...]
 func handleSubtitleExternal(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCORS(w)
 	q := r.URL.Query()
 
 	source := q.Get("source")
 	id := q.Get("id")
+	lang := q.Get("lang")
 
 	if id == "" {
 		http.Error(w, "missing id parameter", http.StatusBadRequest)
 		return
 	}
+	tr, err := subtitleTransform(w, r, strings.ToLower(q.Get("infoHash")), source+":"+id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	var vtt string
-	var err error
-
-	switch source {
-	case "subdl":
-		vtt, err = subtitles.DownloadSubdlSubtitle(ctx, id)
-	case "opensub":
-		apiKey := os.Getenv("OPENSUB_API_KEY")
-		if apiKey == "" {
-			http.Error(w, "OpenSubtitles API key not configured", http.StatusServiceUnavailable)
-			return
-		}
-		vtt, err = subtitles.DownloadOpenSubSubtitle(ctx, id, apiKey)
-	default:
+	vtt, err := getSubtitleProviders().Download(ctx, source, id, lang)
+	if errors.Is(err, subtitles.ErrUnknownProvider) {
 		http.Error(w, "unknown source: "+source, http.StatusBadRequest)
 		return
 	}
-
 	if err != nil {
 		log.Printf("[subtitles] download error (%s/%s): %v", source, id, err)
 		http.Error(w, "failed to download subtitle: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	vtt = subtitles.Retimed(source+":"+id, vtt, tr)
+
 	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("X-Subtitle-Encoding", subtitles.CachedEncoding(source, id))
+	setSubtitleCacheControl(w, r)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	_, _ = w.Write([]byte(vtt))
 }
 
+// handleSubtitleEmbedded extracts a text subtitle track from an MKV file as VTT.
+// Works on partially downloaded files: the track's blocks (or, without cue
+// positions, the clusters holding them) are raised to high priority and
+// X-Subtitle-Complete tells the client to poll again.
+// GET /subtitles/embedded?magnet=...&cat=anime&fileIndex=0&track=3
+func handleSubtitleEmbedded(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCORS(w)
+	q := r.URL.Query()
+	cat := parseCat(q)
+
+	src, err := torrentx.ParseSrc(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	track, err := strconv.ParseUint(q.Get("track"), 10, 64)
+	if err != nil || track == 0 {
+		http.Error(w, "invalid track", http.StatusBadRequest)
+		return
+	}
+
+	cl := torrentx.GetClientFor(cat)
+	t, err := torrentx.AddOrGetTorrent(cl, src)
+	if err != nil {
+		http.Error(w, "add torrent: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.WaitMetadata())
+	defer cancel()
+	if err := torrentx.WaitForInfo(ctx, t); err != nil {
+		http.Error(w, "metadata timeout", http.StatusGatewayTimeout)
+		return
+	}
+	torrentx.SetLastTouch(cat, t.InfoHash())
+
+	var f *torrent.File
+	fidx := -1
+	if idxStr := q.Get("fileIndex"); idxStr != "" {
+		if n, err := strconv.Atoi(idxStr); err == nil && n >= 0 && n < len(t.Files()) {
+			f, fidx = t.Files()[n], n
+		}
+	}
+	if f == nil {
+		f, fidx = torrentx.ChooseBestVideoFile(t)
+	}
+	if f == nil {
+		http.Error(w, "no video file in torrent", http.StatusNotFound)
+		return
+	}
+
+	info, err := probeEmbedded(f, 10*time.Second)
+	if err != nil {
+		if errors.Is(err, subtitles.ErrMKVDataMissing) {
+			http.Error(w, "file header not downloaded yet", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "probe: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	subKey := fmt.Sprintf("embedded:%s:%d:%d", t.InfoHash().HexString(), fidx, track)
+	vtt, complete := "", true
+	if cached, ok := subtitles.GetCachedVTT(subKey); ok {
+		vtt = cached
+	} else {
+		rd := f.NewReader()
+		defer rd.Close()
+		vtt, complete, err = subtitles.ExtractMKVSubtitles(mkvSource(f, rd), info, track)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if complete {
+			subtitles.PutCachedVTT(subKey, vtt, "")
+		}
+	}
+	log.Printf("[subtitles] embedded ih=%s file=%q track=%d complete=%v", t.InfoHash().HexString(), f.Path(), track, complete)
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("X-Subtitle-Complete", strconv.FormatBool(complete))
+	if complete {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = w.Write([]byte(vtt))
+}
+
+// subtitleTransform resolves the timing correction for a subtitle request.
+// Explicit offsetMs/fps parameters win for this response only; without them
+// the subject's correction saved through /subtitles/sync for this video and
+// subtitle is reused. The applied values are echoed in X-Subtitle-Offset-Ms /
+// X-Subtitle-Ratio, the key to save them under in X-Subtitle-Key.
+func subtitleTransform(w http.ResponseWriter, r *http.Request, infoHash, subKey string) (subtitles.Transform, error) {
+	q := r.URL.Query()
+	subject := strings.TrimSpace(q.Get("subjectId"))
+	offStr, fpsStr := q.Get("offsetMs"), q.Get("fps")
+
+	var tr subtitles.Transform
+	if offStr != "" || fpsStr != "" {
+		var err error
+		if tr, err = parseTransform(offStr, fpsStr); err != nil {
+			return tr, err
+		}
+	} else {
+		tr = savedTransform(r.Context(), subject, infoHash, subKey)
+	}
+
+	ratio := tr.Ratio
+	if ratio == 0 {
+		ratio = 1
+	}
+	w.Header().Set("X-Subtitle-Offset-Ms", strconv.FormatInt(tr.OffsetMs, 10))
+	w.Header().Set("X-Subtitle-Ratio", strconv.FormatFloat(ratio, 'f', -1, 64))
+	w.Header().Set("X-Subtitle-Key", subKey)
+	return tr, nil
+}
+
+// parseTransform reads an offsetMs / fps pair; either may be empty
+func parseTransform(offStr, fpsStr string) (subtitles.Transform, error) {
+	var tr subtitles.Transform
+	if offStr != "" {
+		off, err := strconv.ParseInt(offStr, 10, 64)
+		if err != nil {
+			return tr, fmt.Errorf("invalid offsetMs")
+		}
+		tr.OffsetMs = off
+	}
+	if fpsStr != "" {
+		ratio, err := subtitles.ParseFPSRatio(fpsStr)
+		if err != nil {
+			return tr, err
+		}
+		tr.Ratio = ratio
+	}
+	return tr, nil
+}
+
+// handleSubtitleSync saves a subject's timing correction for a subtitle, so
+// later requests without offsetMs/fps apply it. subKey is the X-Subtitle-Key
+// the subtitle was served with; no offsetMs and no fps clear the correction.
+// POST /subtitles/sync {"subjectId","infoHash","subKey",["offsetMs","fps"]}
+func handleSubtitleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st := getSyncStore()
+	if st == nil {
+		http.Error(w, "subtitle sync not available", http.StatusNotFound)
+		return
+	}
+	var in struct {
+		SubjectID string `json:"subjectId"`
+		InfoHash  string `json:"infoHash"`
+		SubKey    string `json:"subKey"`
+		OffsetMs  int64  `json:"offsetMs"`
+		FPS       string `json:"fps"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	subject, subKey := strings.TrimSpace(in.SubjectID), strings.TrimSpace(in.SubKey)
+	if subject == "" || subKey == "" {
+		http.Error(w, "subjectId & subKey required", http.StatusBadRequest)
+		return
+	}
+	tr, err := parseTransform(strconv.FormatInt(in.OffsetMs, 10), in.FPS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := st.SaveSync(r.Context(), subject, strings.ToLower(in.InfoHash), subKey, tr); err != nil {
+		log.Printf("[subtitles] save sync %s: %v", subKey, err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// savedTransform returns subject's saved correction for subKey on infoHash
+// (the identity when there is none)
+func savedTransform(ctx context.Context, subject, infoHash, subKey string) subtitles.Transform {
+	st := getSyncStore()
+	if st == nil || subject == "" {
+		return subtitles.Transform{}
+	}
+	saved, ok, err := st.GetSync(ctx, subject, infoHash, subKey)
+	if err != nil {
+		log.Printf("[subtitles] load sync %s: %v", subKey, err)
+	}
+	if !ok {
+		return subtitles.Transform{}
+	}
+	return saved
+}
+
+// setSubtitleCacheControl keeps per-user (synced) responses out of shared caches
+func setSubtitleCacheControl(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("subjectId") != "" {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+}
+
+var errNotSubtitle = errors.New("not a subtitle file")
+
+// readTorrentSubtitle downloads a (small) subtitle file from the torrent,
+// transcodes it to UTF-8 and converts it to VTT (SRT and ASS/SSA)
+func readTorrentSubtitle(f *torrent.File, lang string) (vtt, enc string, err error) {
+	// Verify it's a subtitle file
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(f.Path())), ".")
+	validExts := map[string]bool{"srt": true, "vtt": true, "ass": true, "ssa": true, "sub": true}
+	if !validExts[ext] {
+		return "", "", errNotSubtitle
+	}
+
+	// Read the subtitle file
+	reader := f.NewReader()
+	defer reader.Close()
+	reader.SetResponsive()
+
+	// Prebuffer the entire subtitle (they're small)
+	_ = torrentx.Prebuffer(reader, f.Length(), 30*time.Second)
+	_, _ = reader.Seek(0, io.SeekStart)
+
+	data, err := io.ReadAll(io.LimitReader(reader, 5<<20)) // 5MB limit
+	if err != nil {
+		return "", "", err
+	}
+
+	// Transcode to UTF-8, then convert to VTT if needed
+	content, enc := subtitles.DecodeSubtitle(data, lang)
+	return subtitles.ToVTT(content), enc, nil
+}
+
+// sniffTorrentSubtitle detects the charset of a subtitle file that is already
+// fully downloaded (prefetch pulls them in early); "" if not available yet
+func sniffTorrentSubtitle(f *torrent.File, lang string) string {
+	n := min64(f.Length(), 64<<10)
+	if n <= 0 || !torrentx.FileRangeComplete(f, 0, n) {
+		return ""
+	}
+	rd := f.NewReader()
+	defer rd.Close()
+	data, err := io.ReadAll(io.LimitReader(rd, n))
+	if err != nil {
+		return ""
+	}
+	return subtitles.DetectEncoding(data, lang)
+}
+
+// parsed MKV headers by infohash and file; they also remember the clusters
+// already extracted, so polling a partial track only reads what is new
+const maxEmbeddedInfos = 64
+
+var (
+	embeddedMu    sync.Mutex
+	embeddedInfos = map[string]*subtitles.MKVInfo{}
+	embeddedOrder []string
+)
+
+// probeEmbedded reads the MKV header of f, waiting up to timeout for the
+// first megabyte to arrive
+func probeEmbedded(f *torrent.File, timeout time.Duration) (*subtitles.MKVInfo, error) {
+	key := f.Torrent().InfoHash().HexString() + ":" + f.Path()
+	embeddedMu.Lock()
+	info, ok := embeddedInfos[key]
+	embeddedMu.Unlock()
+	if ok {
+		return info, nil
+	}
+
+	info, err := readEmbeddedHeader(f, timeout)
+	if err != nil {
+		return nil, err
+	}
+	embeddedMu.Lock()
+	defer embeddedMu.Unlock()
+	if cached, ok := embeddedInfos[key]; ok {
+		return cached, nil
+	}
+	if len(embeddedOrder) >= maxEmbeddedInfos {
+		delete(embeddedInfos, embeddedOrder[0])
+		embeddedOrder = embeddedOrder[1:]
+	}
+	embeddedInfos[key] = info
+	embeddedOrder = append(embeddedOrder, key)
+	return info, nil
+}
+
+func readEmbeddedHeader(f *torrent.File, timeout time.Duration) (*subtitles.MKVInfo, error) {
+	rd := f.NewReader()
+	defer rd.Close()
+	rd.SetResponsive()
+	if !torrentx.FileRangeComplete(f, 0, min64(f.Length(), 1<<20)) {
+		_ = torrentx.Prebuffer(rd, min64(f.Length(), 1<<20), timeout)
+	}
+	return subtitles.ProbeMKV(mkvSource(f, rd))
+}
+
+func mkvSource(f *torrent.File, rd torrent.Reader) subtitles.MKVSource {
+	rd.SetReadahead(0)
+	return subtitles.MKVSource{
+		R:    rd,
+		Size: f.Length(),
+		Have: func(off, n int64) bool { return torrentx.FileRangeComplete(f, off, n) },
+		Want: func(off, n int64) { torrentx.PrioritizeFileRange(f, off, n) },
+	}
+}
+
 // Helper functions
 
 func buildSubtitleTorrentURL(q map[string][]string, fileIndex int) string {
@@ -255,8 +637,24 @@ func buildSubtitleTorrentURL(q map[string][]string, fileIndex int) string {
 	return "/subtitles/torrent?" + strings.Join(params, "&")
 }
 
-func buildSubtitleExternalURL(source, id, lang string) string {
-	return "/subtitles/external?source=" + source + "&id=" + id + "&lang=" + lang
+func buildSubtitleEmbeddedURL(q map[string][]string, fileIndex int, track uint64) string {
+	v := url.Values{}
+	for _, k := range []string{"magnet", "src", "infoHash", "cat"} {
+		if s := getFirst(q, k); s != "" {
+			v.Set(k, s)
+		}
+	}
+	v.Set("fileIndex", strconv.Itoa(fileIndex))
+	v.Set("track", strconv.FormatUint(track, 10))
+	return "/subtitles/embedded?" + v.Encode()
+}
+
+func buildSubtitleExternalURL(source, id, lang, infoHash string) string {
+	u := "/subtitles/external?source=" + source + "&id=" + id + "&lang=" + lang
+	if infoHash != "" {
+		u += "&infoHash=" + infoHash
+	}
+	return u
 }
 
 func getFirst(q map[string][]string, key string) string {
@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"torrent-streamer/internal/feeds"
+)
+
+// Watchlist manages the series the feed watcher grabs new episodes for.
+// GET    /v1/watchlist?subjectId=...
+// POST   /v1/watchlist {"subjectId","seriesId","seriesTitle","kind",["deviceId","profileHash","imdbId","tvdbId","estRuntimeMin","prefetchPct"]}
+// DELETE /v1/watchlist?subjectId=...&seriesId=...
+// New episodes are picked with the device's capabilities; without a
+// deviceId the default caps are used, so profileHash must be theirs.
+func (h *SessionHandlers) Watchlist(w http.ResponseWriter, r *http.Request) {
+	if h.d.Watchlist == nil {
+		http.Error(w, "watchlist not available", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		subject := strings.TrimSpace(q.Get("subjectId"))
+		if subject == "" {
+			http.Error(w, "subjectId required", http.StatusBadRequest)
+			return
+		}
+		items, err := h.d.Watchlist.ListWatchFor(r.Context(), subject)
+		if err != nil {
+			log.Printf("[feeds] watchlist query failed: %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if items == nil {
+			items = []feeds.WatchEntry{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(items)
+
+	case http.MethodPost:
+		var e feeds.WatchEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		e.SubjectID, e.SeriesID = strings.TrimSpace(e.SubjectID), strings.TrimSpace(e.SeriesID)
+		e.SeriesTitle = strings.TrimSpace(e.SeriesTitle)
+		if e.SubjectID == "" || e.SeriesID == "" || e.SeriesTitle == "" {
+			http.Error(w, "subjectId, seriesId & seriesTitle required", http.StatusBadRequest)
+			return
+		}
+		switch e.Kind {
+		case "":
+			e.Kind = "tv"
+		case "tv", "anime":
+		default:
+			http.Error(w, "kind must be tv or anime", http.StatusBadRequest)
+			return
+		}
+		e.DeviceID = strings.TrimSpace(e.DeviceID)
+		_, hash, err := h.deviceProfile(r.Context(), e.DeviceID, "")
+		if err != nil {
+			deviceError(w, err)
+			return
+		}
+		switch {
+		case e.DeviceID != "" || e.ProfileHash == "":
+			e.ProfileHash = hash
+		case e.ProfileHash != hash:
+			// the feed watcher could only pick with caps that don't fit it
+			http.Error(w, "profileHash of another device needs its deviceId", http.StatusBadRequest)
+			return
+		}
+		if e.PrefetchPct != nil && (*e.PrefetchPct < 0 || *e.PrefetchPct > 100) {
+			http.Error(w, "prefetchPct must be 0..100", http.StatusBadRequest)
+			return
+		}
+		if err := h.d.Watchlist.SaveWatch(r.Context(), e); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(e)
+
+	case http.MethodDelete:
+		subject, series := strings.TrimSpace(q.Get("subjectId")), strings.TrimSpace(q.Get("seriesId"))
+		if subject == "" || series == "" {
+			http.Error(w, "subjectId & seriesId required", http.StatusBadRequest)
+			return
+		}
+		if err := h.d.Watchlist.DeleteWatch(r.Context(), subject, series); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,553 @@
+// Package releaseparse reads what a torrent or file name says about its
+// content: title, year, season/episode numbering, video, audio, languages
+// and release group. Both scene names ("Show.S01E02.1080p.WEB-DL.DDP5.1.H.264-GRP")
+// and anime fansub names ("[Group] Show - 05 (1080p) [ABCD1234].mkv") are handled.
+// Anything the name doesn't state is left at its zero value.
+package releaseparse
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Release is a parsed release name
+type Release struct {
+	Title string
+	Year  int
+
+	Season   int   // first (or only) season
+	Seasons  []int // every season covered: "S01-S03" → 1,2,3
+	Episode  int   // first episode within Season
+	Episodes []int // multi-episode releases: "S01E01E02", "S01E01-E03"
+	// anime absolute numbering: "Show - 1057"; batches "Show 01-12" fill AbsEpisodes
+	AbsEpisode  int
+	AbsEpisodes []int
+	SeasonPack  bool // whole season(s) or a batch rather than single episodes
+
+	Resolution string   // "2160p","1440p","1080p","720p","576p","540p","480p","360p"
+	Source     string   // "REMUX","BluRay","BDRip","WEB-DL","WEBRip","WEB","HDTV","DVDRip","DVD","CAM","TS","TC","SCR"
+	Codec      string   // "h264","hevc","av1","vp9","xvid","mpeg2"
+	BitDepth   int      // 8, 10, 12
+	HDR        []string // "DV","HDR10+","HDR10","HDR","HLG"
+
+	AudioCodec    string // "TrueHD","DTS-HD MA","DTS-X","DTS","EAC3","AC3","AAC","FLAC","Opus","MP3","PCM"
+	AudioChannels string // "2.0","5.1","7.1"
+	Atmos         bool
+
+	Languages    []string // audio, ISO 639-1, in the order named
+	DualAudio    bool
+	Multi        bool     // "MULTi": several audio languages, not listed
+	SubLanguages []string // subtitles named: "ENG SUBS", "VOSTFR", "ESub"
+	MultiSubs    bool
+
+	Group    string
+	Fansub   bool   // group given in leading brackets, anime style
+	Checksum string // CRC32 tag of fansub releases
+	Proper   bool
+	Repack   bool
+	Version  int // fansub revision: "05v2" → 2
+}
+
+// HasHDR reports whether any HDR format, Dolby Vision included, is present
+func (r Release) HasHDR() bool { return len(r.HDR) > 0 }
+
+// DolbyVision reports whether the release carries a Dolby Vision layer
+func (r Release) DolbyVision() bool { return contains(r.HDR, "DV") }
+
+var knownExts = map[string]bool{
+	".mkv": true, ".mp4": true, ".avi": true, ".m4v": true, ".mov": true, ".webm": true, ".ts": true, ".wmv": true,
+	".srt": true, ".ass": true, ".ssa": true, ".vtt": true, ".sub": true, ".idx": true, ".torrent": true, ".nfo": true,
+}
+
+var (
+	reLeadTag = regexp.MustCompile(`^\s*(?:\[([^\]]+)\]|【([^】]+)】)\s*`)
+	reTag     = regexp.MustCompile(`\[([^\]]*)\]|\(([^)]*)\)|【([^】]*)】`)
+	reCRC     = regexp.MustCompile(`^[0-9A-Fa-f]{8}$`)
+	reNumber  = regexp.MustCompile(`^\d{1,4}$`)
+
+	reSxE = regexp.MustCompile(`(?i)\bS(\d{1,2}) ?E(\d{1,4})((?: ?-? ?E\d{1,4}| ?- ?\d{1,4}\b)*)(?:v(\d))?\b`)
+	// the continuation of a multi-episode tag: "E02", "-E03", "-03"
+	reMoreEp = regexp.MustCompile(`(?i)(-)? ?E?(\d{1,4})`)
+	reNxN    = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	// "S01-S03", "S01-03", "Seasons 1 to 3"; "S2 - 05" is an episode of season 2
+	reSeasonRg = regexp.MustCompile(`(?i)\bS(\d{1,2})(?: ?(?:-|~|to) ?S|[-~])(\d{1,2})\b|\bSeasons? ?(\d{1,2}) ?(?:-|~|to) ?(?:Season ?)?(\d{1,2})\b`)
+	reSeason   = regexp.MustCompile(`(?i)\b(?:S|Season ?)(\d{1,2})\b`)
+	// "S1+S2", "Season 1 & Season 3"
+	reSeasonList = regexp.MustCompile(`(?i)\b(?:S|Season ?)\d{1,2}(?: ?[+&,] ?(?:S|Season ?)\d{1,2})+\b`)
+	reAbsRange   = regexp.MustCompile(` (\d{1,4}) ?[-~] ?(\d{1,4})(?: |$)`)
+	reAbsEp      = regexp.MustCompile(`(?i)(?: - | #|\bEp? ?|\bEpisode )(\d{1,4})(?:v(\d))?(?: |$)`)
+	reYear       = regexp.MustCompile(`\b(19[2-9]\d|20\d{2})\b`)
+	reComplete   = regexp.MustCompile(`(?i)\b(complete|batch|integrale)\b`)
+
+	reRes      = regexp.MustCompile(`(?i)\b(2160|1440|1080|720|576|540|480|360)[pi]\b`)
+	reResDim   = regexp.MustCompile(`(?i)\b\d{3,4}x(2160|1080|720|576|480)\b`)
+	reRes4K    = regexp.MustCompile(`(?i)\b(4k|uhd)\b`)
+	reBitDepth = regexp.MustCompile(`(?i)\b(8|10|12) ?-?bits?\b`)
+	reHi10     = regexp.MustCompile(`(?i)\bhi10p?\b`)
+	reAtmos    = regexp.MustCompile(`(?i)\batmos\b`)
+	reChannels = regexp.MustCompile(`(?:^|[^\d.])([124578])\.([01])(?:[^\d.]|$)`)
+	reChanN    = regexp.MustCompile(`(?i)\b([268])ch\b`)
+	reDual     = regexp.MustCompile(`(?i)\bdual(?: ?-?audio)?\b`)
+	reMulti    = regexp.MustCompile(`(?i)\bmulti(?: ?-?(?:audio|lang))?\b`)
+	reMultiSub = regexp.MustCompile(`(?i)\bmulti ?-?subs?\b`)
+	reSubWord  = regexp.MustCompile(`(?i)^(subs?|subbed|subtitles?)$`)
+	reProper   = regexp.MustCompile(`(?i)\bproper\b`)
+	reRepack   = regexp.MustCompile(`(?i)\b(repack\d?|rerip)\b`)
+	reGroup    = regexp.MustCompile(`-([A-Za-z0-9][A-Za-z0-9_]{0,30}(?:-[A-Za-z0-9][A-Za-z0-9_]{0,30})*)$`)
+	reWord     = regexp.MustCompile(`[A-Za-z]+`)
+)
+
+type pattern struct {
+	re    *regexp.Regexp
+	value string
+	// weak tokens are also ordinary words ("Cam", "TS") and never end the title
+	weak bool
+}
+
+// checked in order; the first match wins
+var sourcePatterns = []pattern{
+	{regexp.MustCompile(`(?i)\b(bd|uhd)?remux\b`), "REMUX", false},
+	{regexp.MustCompile(`(?i)\b(hdcam|camrip|cam-?rip)\b`), "CAM", false},
+	{regexp.MustCompile(`(?i)\bcam\b`), "CAM", true},
+	{regexp.MustCompile(`(?i)\b(telesync|hdts|hd-ts)\b`), "TS", false},
+	{regexp.MustCompile(`(?i)\bts\b`), "TS", true},
+	{regexp.MustCompile(`(?i)\b(telecine|hdtc)\b`), "TC", false},
+	{regexp.MustCompile(`(?i)\btc\b`), "TC", true},
+	{regexp.MustCompile(`(?i)\b(dvdscr|screener|bdscr)\b`), "SCR", false},
+	{regexp.MustCompile(`(?i)\b(bdrip|brrip|bd-rip|br-rip)\b`), "BDRip", false},
+	{regexp.MustCompile(`(?i)\b(blu-?ray|bd25|bd50|bdmv)\b`), "BluRay", false},
+	{regexp.MustCompile(`(?i)\bbd\b`), "BluRay", true},
+	{regexp.MustCompile(`(?i)\bweb ?-?dl\b`), "WEB-DL", false},
+	{regexp.MustCompile(`(?i)\bweb ?-?rip\b`), "WEBRip", false},
+	{regexp.MustCompile(`(?i)\bweb\b`), "WEB", true},
+	{regexp.MustCompile(`(?i)\b(hdtv|pdtv|sdtv|dsr|tvrip)\b`), "HDTV", false},
+	{regexp.MustCompile(`(?i)\bdvd-?rip\b`), "DVDRip", false},
+	{regexp.MustCompile(`(?i)\b(dvd[59]?|dvdr)\b`), "DVD", false},
+}
+
+var codecPatterns = []pattern{
+	{regexp.MustCompile(`(?i)\b(x265|h ?265|hevc)\b`), "hevc", false},
+	{regexp.MustCompile(`(?i)\b(x264|h ?264|hi10p?)\b`), "h264", false},
+	{regexp.MustCompile(`(?i)\bavc\b`), "h264", true},
+	{regexp.MustCompile(`(?i)\bav1\b`), "av1", false},
+	{regexp.MustCompile(`(?i)\bvp9\b`), "vp9", false},
+	{regexp.MustCompile(`(?i)\b(xvid|divx)\b`), "xvid", false},
+	{regexp.MustCompile(`(?i)\bmpeg-?2\b`), "mpeg2", false},
+}
+
+// every match is kept, except the plainer names implied by HDR10+/HDR10
+var hdrPatterns = []pattern{
+	{regexp.MustCompile(`(?i)\b(dv|dovi|dolby ?vision)\b`), "DV", true},
+	{regexp.MustCompile(`(?i)\bhdr10(\+|plus\b)`), "HDR10+", false},
+	{regexp.MustCompile(`(?i)\bhdr10\b`), "HDR10", false},
+	{regexp.MustCompile(`(?i)\bhdr\b`), "HDR", false},
+	{regexp.MustCompile(`(?i)\bhlg\b`), "HLG", false},
+}
+
+var audioPatterns = []pattern{
+	{regexp.MustCompile(`(?i)\btrue-?hd`), "TrueHD", false},
+	{regexp.MustCompile(`(?i)\bdts-?hd[ -]?ma\b|\bdts-?ma\b`), "DTS-HD MA", false},
+	{regexp.MustCompile(`(?i)\bdts[ -]?x\b`), "DTS-X", false},
+	{regexp.MustCompile(`(?i)\bdts`), "DTS", false},
+	{regexp.MustCompile(`(?i)\b(ddp|dd\+|e-?ac-?3)`), "EAC3", false},
+	{regexp.MustCompile(`(?i)\b(dd|ac-?3)(\d|\b)|\bdolby digital\b`), "AC3", false},
+	{regexp.MustCompile(`(?i)\baac`), "AAC", false},
+	{regexp.MustCompile(`(?i)\bflac`), "FLAC", false},
+	{regexp.MustCompile(`(?i)\bopus\b`), "Opus", false},
+	{regexp.MustCompile(`(?i)\bmp3\b`), "MP3", false},
+	{regexp.MustCompile(`(?i)\bl?pcm\b`), "PCM", false},
+}
+
+// language names match in any case; the short tags only in upper case,
+// where they can't be ordinary words
+var languageNames = map[string]string{
+	"english": "en", "japanese": "ja", "french": "fr", "truefrench": "fr", "german": "de", "spanish": "es",
+	"castellano": "es", "latino": "es", "italian": "it", "russian": "ru", "hindi": "hi", "korean": "ko",
+	"chinese": "zh", "mandarin": "zh", "cantonese": "zh", "portuguese": "pt", "polish": "pl", "dutch": "nl",
+	"swedish": "sv", "danish": "da", "norwegian": "no", "finnish": "fi", "turkish": "tr", "arabic": "ar",
+	"thai": "th", "vietnamese": "vi", "indonesian": "id", "hungarian": "hu", "czech": "cs", "greek": "el",
+	"hebrew": "he", "ukrainian": "uk", "tamil": "ta", "telugu": "te", "malayalam": "ml",
+}
+var languageTags = map[string]string{
+	"ENG": "en", "JAP": "ja", "JPN": "ja", "FRE": "fr", "FRA": "fr", "VFF": "fr", "VFQ": "fr",
+	"GER": "de", "SPA": "es", "ESP": "es", "ITA": "it", "RUS": "ru", "HIN": "hi", "KOR": "ko", "CHI": "zh",
+	"CHS": "zh", "CHT": "zh", "POR": "pt", "PTBR": "pt", "POL": "pl", "PL": "pl", "NLD": "nl", "SWE": "sv",
+	"TUR": "tr", "ARA": "ar", "UKR": "uk", "TAM": "ta", "TEL": "te",
+}
+
+// tags naming subtitles rather than audio
+var subtitleTags = map[string]string{"VOSTFR": "fr", "ESub": "en", "ESubs": "en"}
+
+// words that end up after a dash without being a group: "WEB-DL", "DTS-HD"
+var notGroups = map[string]bool{"dl": true, "rip": true, "hd": true, "ma": true, "x": true, "ray": true, "audio": true}
+
+// Parse reads everything it can from a release or file name. Directory
+// components and a media file extension are ignored.
+func Parse(name string) Release {
+	var r Release
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if ext := path.Ext(name); knownExts[strings.ToLower(ext)] {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	// "[Group] Title - 05": a leading tag is the group unless it is technical ("[1080p]")
+	if m := reLeadTag.FindStringSubmatch(name); m != nil {
+		if inner := strings.TrimSpace(m[1] + m[2]); !isTechnical(inner) {
+			r.Group, r.Fansub = inner, true
+			name = name[len(m[0]):]
+		}
+	}
+
+	// bracketed tags describe the release but are never part of the title; a
+	// year in parentheses stays in place ("Title (2019) 1080p")
+	var tags []string
+	body := reTag.ReplaceAllStringFunc(name, func(s string) string {
+		m := reTag.FindStringSubmatch(s)
+		inner := strings.TrimSpace(m[1] + m[2] + m[3])
+		switch {
+		case reCRC.MatchString(inner) && !reNumber.MatchString(inner):
+			r.Checksum = strings.ToUpper(inner)
+		case len(inner) == 4 && reYear.MatchString(inner):
+			return " " + inner + " "
+		default:
+			tags = append(tags, inner)
+		}
+		return " | "
+	})
+	body = strings.TrimLeft(body, " |")
+	// normalize swaps single bytes, so offsets into clean hold for body too
+	clean := normalize(body)
+	tagText := normalize(strings.Join(tags, " "))
+
+	titleEnd := len(clean)
+	mark := func(at int) {
+		if at > 0 && at < titleEnd {
+			titleEnd = at
+		}
+	}
+	if i := strings.IndexByte(clean, '|'); i >= 0 {
+		mark(i)
+	}
+
+	parseNumbering(&r, clean, tags, mark)
+
+	// technical tokens end the title; a leading one is the title itself ("Cam", "Hevc")
+	for _, re := range []*regexp.Regexp{reRes, reResDim, reRes4K, reBitDepth, reHi10} {
+		markFirst(re, clean, mark)
+	}
+	for _, list := range [][]pattern{sourcePatterns, codecPatterns, hdrPatterns} {
+		for _, p := range list {
+			if !p.weak {
+				markFirst(p.re, clean, mark)
+			}
+		}
+	}
+
+	// the last year ahead of everything else, so "Blade Runner 2049 2017"
+	// keeps 2049 and "2001 A Space Odyssey 1968" keeps 2001 in the title
+	yearAt := 0
+	for _, m := range reYear.FindAllStringSubmatchIndex(clean, -1) {
+		if m[0] == 0 {
+			continue
+		}
+		if m[0] >= titleEnd {
+			break
+		}
+		r.Year, yearAt = atoi(clean[m[2]:m[3]]), m[0]
+	}
+	mark(yearAt)
+	r.Title = tidyTitle(clean[:titleEnd])
+
+	// everything else is read from after the title only
+	tail := clean[titleEnd:] + " " + tagText
+	if m := reRes.FindStringSubmatch(tail); m != nil {
+		r.Resolution = m[1] + "p"
+	} else if m := reResDim.FindStringSubmatch(tail); m != nil {
+		r.Resolution = m[1] + "p"
+	} else if reRes4K.MatchString(tail) {
+		r.Resolution = "2160p"
+	}
+	r.Source = firstMatch(tail, sourcePatterns)
+	r.Codec = firstMatch(tail, codecPatterns)
+	if m := reBitDepth.FindStringSubmatch(tail); m != nil {
+		r.BitDepth = atoi(m[1])
+	} else if reHi10.MatchString(tail) {
+		r.BitDepth = 10
+	}
+	for _, p := range hdrPatterns {
+		if !p.re.MatchString(tail) {
+			continue
+		}
+		if p.value == "HDR10" && contains(r.HDR, "HDR10+") || p.value == "HDR" && (contains(r.HDR, "HDR10+") || contains(r.HDR, "HDR10")) {
+			continue
+		}
+		r.HDR = append(r.HDR, p.value)
+	}
+
+	r.AudioCodec = firstMatch(tail, audioPatterns)
+	r.Atmos = reAtmos.MatchString(tail)
+	if m := reChannels.FindStringSubmatch(tail); m != nil && r.AudioCodec != "" {
+		r.AudioChannels = m[1] + "." + m[2]
+	} else if m := reChanN.FindStringSubmatch(tail); m != nil {
+		r.AudioChannels = map[string]string{"2": "2.0", "6": "5.1", "8": "7.1"}[m[1]]
+	}
+
+	// a language followed by "subs" names subtitles, anything else audio
+	seen, seenSub := map[string]bool{}, map[string]bool{}
+	words := reWord.FindAllString(tail, -1)
+	for i, w := range words {
+		if code, ok := subtitleTags[w]; ok {
+			if !seenSub[code] {
+				seenSub[code] = true
+				r.SubLanguages = append(r.SubLanguages, code)
+			}
+			continue
+		}
+		code, ok := languageNames[strings.ToLower(w)]
+		if !ok {
+			code, ok = languageTags[w]
+		}
+		switch {
+		case !ok:
+		case i+1 < len(words) && reSubWord.MatchString(words[i+1]):
+			if !seenSub[code] {
+				seenSub[code] = true
+				r.SubLanguages = append(r.SubLanguages, code)
+			}
+		case !seen[code]:
+			seen[code] = true
+			r.Languages = append(r.Languages, code)
+		}
+	}
+	r.DualAudio = reDual.MatchString(tail)
+	r.MultiSubs = reMultiSub.MatchString(tail)
+	r.Multi = reMulti.MatchString(reMultiSub.ReplaceAllString(tail, " "))
+	r.Proper = reProper.MatchString(tail)
+	r.Repack = reRepack.MatchString(tail)
+
+	// scene group: "...-GROUP" at the very end and past the title, so a
+	// "Spider-Man" title stays whole; groups may hold dashes themselves
+	// ("x264-Spider-Man"), after dropping what belongs to a tag ("WEB-DL-GRP")
+	if r.Group == "" {
+		end := strings.TrimRight(body, " |")
+		if m := reGroup.FindStringSubmatchIndex(end); m != nil && m[0] >= titleEnd {
+			g := end[m[2]:m[3]]
+			for {
+				first, rest, ok := strings.Cut(g, "-")
+				if !ok || !notGroups[strings.ToLower(first)] {
+					break
+				}
+				g = rest
+			}
+			if !notGroups[strings.ToLower(g)] {
+				r.Group = g
+			}
+		}
+	}
+	return r
+}
+
+// parseNumbering fills the season and episode fields, marking where the
+// numbering starts
+func parseNumbering(r *Release, clean string, tags []string, mark func(int)) {
+	if m := reSxE.FindStringSubmatchIndex(clean); m != nil {
+		mark(m[0])
+		r.Season, r.Episode = atoi(clean[m[2]:m[3]]), atoi(clean[m[4]:m[5]])
+		r.Seasons, r.Episodes = []int{r.Season}, []int{r.Episode}
+		last := r.Episode
+		for _, em := range reMoreEp.FindAllStringSubmatch(clean[m[6]:m[7]], -1) {
+			n := atoi(em[2])
+			if n <= last {
+				continue
+			}
+			if em[1] == "-" {
+				// a range: "S01E01-E03"
+				for e := last + 1; e < n; e++ {
+					r.Episodes = append(r.Episodes, e)
+				}
+			}
+			r.Episodes = append(r.Episodes, n)
+			last = n
+		}
+		if m[8] >= 0 {
+			r.Version = atoi(clean[m[8]:m[9]])
+		}
+		return
+	}
+	if m := reNxN.FindStringSubmatchIndex(clean); m != nil {
+		mark(m[0])
+		r.Season, r.Episode = atoi(clean[m[2]:m[3]]), atoi(clean[m[4]:m[5]])
+		r.Seasons, r.Episodes = []int{r.Season}, []int{r.Episode}
+		return
+	}
+
+	// batches often name their seasons in a tag: "Title (Season 1-2) [Batch]"
+	tagText := strings.Join(tags, " ")
+	if loc := reComplete.FindStringIndex(clean); loc != nil {
+		mark(loc[0])
+		r.SeasonPack = true
+	} else if reComplete.MatchString(tagText) {
+		r.SeasonPack = true
+	}
+	if seasons, at := seasonRange(clean); seasons != nil {
+		mark(at)
+		r.Season, r.Seasons, r.SeasonPack = seasons[0], seasons, true
+		return
+	}
+	if seasons, _ := seasonRange(tagText); seasons != nil {
+		r.Season, r.Seasons, r.SeasonPack = seasons[0], seasons, true
+		return
+	}
+	if m := reSeason.FindStringSubmatchIndex(clean); m != nil {
+		mark(m[0])
+		r.Season = atoi(clean[m[2]:m[3]])
+		r.Seasons = []int{r.Season}
+	} else if m := reSeason.FindStringSubmatch(tagText); m != nil {
+		r.Season = atoi(m[1])
+		r.Seasons = []int{r.Season}
+	}
+
+	// anime: "Title 01-12", "Title - 05", "Title S2 - 05", "Title [05]"
+	if m := reAbsRange.FindStringSubmatchIndex(clean); m != nil && m[0] > 0 && !isYearOrRes(clean[m[2]:m[3]]) {
+		if a, b := atoi(clean[m[2]:m[3]]), atoi(clean[m[4]:m[5]]); b > a && b-a < 2000 {
+			mark(m[0])
+			for e := a; e <= b; e++ {
+				r.AbsEpisodes = append(r.AbsEpisodes, e)
+			}
+			r.AbsEpisode = a
+			r.SeasonPack = true
+			return
+		}
+	}
+	ep := 0
+	for _, m := range reAbsEp.FindAllStringSubmatchIndex(clean, -1) {
+		if n := clean[m[2]:m[3]]; m[0] > 0 && !isYearOrRes(n) && atoi(n) > 0 {
+			mark(m[0])
+			ep = atoi(n)
+			if m[4] >= 0 {
+				r.Version = atoi(clean[m[4]:m[5]])
+			}
+			break
+		}
+	}
+	if ep == 0 {
+		for _, t := range tags {
+			if reNumber.MatchString(t) && !isYearOrRes(t) && atoi(t) > 0 {
+				ep = atoi(t)
+				break
+			}
+		}
+	}
+	switch {
+	case ep > 0 && r.Season > 0:
+		// "Title S2 - 05" counts within the season
+		r.Episode, r.Episodes = ep, []int{ep}
+		r.SeasonPack = false
+	case ep > 0:
+		r.AbsEpisode, r.AbsEpisodes = ep, []int{ep}
+		r.SeasonPack = false
+	case r.Season > 0:
+		r.SeasonPack = true
+	}
+}
+
+// seasonRange reads the seasons of a multi-season pack, "S01-S03",
+// "Seasons 1 to 3" or "S1+S2", and where they are named in s
+func seasonRange(s string) ([]int, int) {
+	if m := reSeasonRg.FindStringSubmatchIndex(s); m != nil {
+		first, last := m[2:4], m[4:6]
+		if m[2] < 0 {
+			first, last = m[6:8], m[8:10]
+		}
+		var seasons []int
+		for n := atoi(s[first[0]:first[1]]); n <= atoi(s[last[0]:last[1]]); n++ {
+			seasons = append(seasons, n)
+		}
+		if seasons != nil {
+			return seasons, m[0]
+		}
+	}
+	if loc := reSeasonList.FindStringIndex(s); loc != nil {
+		var seasons []int
+		for _, m := range reSeason.FindAllStringSubmatch(s[loc[0]:loc[1]], -1) {
+			seasons = append(seasons, atoi(m[1]))
+		}
+		return seasons, loc[0]
+	}
+	return nil, -1
+}
+
+// normalize turns "." and "_" separators into spaces, keeping the dot of
+// audio channel counts ("DDP5.1"); the result is as long as s
+func normalize(s string) string {
+	digit := func(i int) bool { return i >= 0 && i < len(s) && s[i] >= '0' && s[i] <= '9' }
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c == '_':
+			b[i] = ' '
+		case c == '.' && !(digit(i-1) && !digit(i-2) && digit(i+1) && !digit(i+2)):
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// markFirst marks the first match of re that doesn't start the name
+func markFirst(re *regexp.Regexp, s string, mark func(int)) {
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		if loc[0] > 0 {
+			mark(loc[0])
+			return
+		}
+	}
+}
+
+func firstMatch(s string, pats []pattern) string {
+	for _, p := range pats {
+		if p.re.MatchString(s) {
+			return p.value
+		}
+	}
+	return ""
+}
+
+// isTechnical reports whether a bracket tag describes the encode rather than naming a group
+func isTechnical(tag string) bool {
+	if reRes.MatchString(tag) || reCRC.MatchString(tag) || reNumber.MatchString(tag) {
+		return true
+	}
+	return firstMatch(tag, codecPatterns) != ""
+}
+
+func tidyTitle(s string) string {
+	s = strings.Join(strings.Fields(strings.ReplaceAll(s, "|", " ")), " ")
+	return strings.Trim(s, " -–~:,(")
+}
+
+// isYearOrRes reports whether an episode-looking number is really a year,
+// resolution or codec
+func isYearOrRes(n string) bool {
+	switch v := atoi(n); v {
+	case 264, 265, 360, 480, 540, 576, 720, 1080, 1440, 2160:
+		return true
+	default:
+		return len(n) == 4 && v >= 1920 && v <= 2099
+	}
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
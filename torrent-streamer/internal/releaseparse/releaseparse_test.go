@@ -0,0 +1,214 @@
+package releaseparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func seq(a, b int) []int {
+	out := make([]int, 0, b-a+1)
+	for n := a; n <= b; n++ {
+		out = append(out, n)
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		want Release
+	}{
+		// scene episode numbering
+		{"Show.Name.S01E01E02.1080p.WEB-DL.DDP5.1.H.264-GRP.mkv", Release{
+			Title: "Show Name", Season: 1, Seasons: []int{1}, Episode: 1, Episodes: []int{1, 2},
+			Resolution: "1080p", Source: "WEB-DL", Codec: "h264", AudioCodec: "EAC3", AudioChannels: "5.1", Group: "GRP",
+		}},
+		{"Show.Name.S02E01-E03.720p.HDTV.x264-GRP", Release{
+			Title: "Show Name", Season: 2, Seasons: []int{2}, Episode: 1, Episodes: []int{1, 2, 3},
+			Resolution: "720p", Source: "HDTV", Codec: "h264", Group: "GRP",
+		}},
+		{"Show Name 3x07 HDTV XviD-GRP", Release{
+			Title: "Show Name", Season: 3, Seasons: []int{3}, Episode: 7, Episodes: []int{7},
+			Source: "HDTV", Codec: "xvid", Group: "GRP",
+		}},
+		{"Show 1x01 720p HDTV x264-GRP", Release{
+			Title: "Show", Season: 1, Seasons: []int{1}, Episode: 1, Episodes: []int{1},
+			Resolution: "720p", Source: "HDTV", Codec: "h264", Group: "GRP",
+		}},
+
+		// re-releases
+		{"Show.Name.S01E05.PROPER.1080p.WEB.H264-GRP", Release{
+			Title: "Show Name", Season: 1, Seasons: []int{1}, Episode: 5, Episodes: []int{5},
+			Resolution: "1080p", Source: "WEB", Codec: "h264", Group: "GRP", Proper: true,
+		}},
+		{"Show.Name.S01E05.REPACK2.1080p.WEB-DL.DD5.1.H.264-GRP", Release{
+			Title: "Show Name", Season: 1, Seasons: []int{1}, Episode: 5, Episodes: []int{5},
+			Resolution: "1080p", Source: "WEB-DL", Codec: "h264", AudioCodec: "AC3", AudioChannels: "5.1", Group: "GRP", Repack: true,
+		}},
+		{"Show.Name.S03E07.PROPER.REPACK.720p.HDTV.x264-GRP", Release{
+			Title: "Show Name", Season: 3, Seasons: []int{3}, Episode: 7, Episodes: []int{7},
+			Resolution: "720p", Source: "HDTV", Codec: "h264", Group: "GRP", Proper: true, Repack: true,
+		}},
+
+		// season packs
+		{"Show.Name.S01-S03.COMPLETE.1080p.BluRay.x265-GRP", Release{
+			Title: "Show Name", Season: 1, Seasons: []int{1, 2, 3}, SeasonPack: true,
+			Resolution: "1080p", Source: "BluRay", Codec: "hevc", Group: "GRP",
+		}},
+		{"Show Name Seasons 1 to 3 720p", Release{
+			Title: "Show Name", Season: 1, Seasons: []int{1, 2, 3}, SeasonPack: true, Resolution: "720p",
+		}},
+		{"Show.Name.S04.1080p.AMZN.WEB-DL.DDP5.1.H.264-GRP", Release{
+			Title: "Show Name", Season: 4, Seasons: []int{4}, SeasonPack: true,
+			Resolution: "1080p", Source: "WEB-DL", Codec: "h264", AudioCodec: "EAC3", AudioChannels: "5.1", Group: "GRP",
+		}},
+		{"Show.Name.COMPLETE.SERIES.720p.WEB-DL", Release{
+			Title: "Show Name", SeasonPack: true, Resolution: "720p", Source: "WEB-DL",
+		}},
+
+		// anime fansubs
+		{"[SubsPlease] Jujutsu Kaisen - 05v2 (1080p) [ABCD1234].mkv", Release{
+			Title: "Jujutsu Kaisen", AbsEpisode: 5, AbsEpisodes: []int{5}, Resolution: "1080p",
+			Group: "SubsPlease", Fansub: true, Checksum: "ABCD1234", Version: 2,
+		}},
+		{"[Group] One Piece 001-220 [480p]", Release{
+			Title: "One Piece", AbsEpisode: 1, AbsEpisodes: seq(1, 220), SeasonPack: true,
+			Resolution: "480p", Group: "Group", Fansub: true,
+		}},
+		{"[Group] Show - 12 [1080p Hi10P][ABCDEF12].mkv", Release{
+			Title: "Show", AbsEpisode: 12, AbsEpisodes: []int{12}, Resolution: "1080p", Codec: "h264", BitDepth: 10,
+			Group: "Group", Fansub: true, Checksum: "ABCDEF12",
+		}},
+		{"[SubsPlease] Mushoku Tensei S2 - 05 (1080p) [1A2B3C4D].mkv", Release{
+			Title: "Mushoku Tensei", Season: 2, Seasons: []int{2}, Episode: 5, Episodes: []int{5},
+			Resolution: "1080p", Group: "SubsPlease", Fansub: true, Checksum: "1A2B3C4D",
+		}},
+		{"[Group] Show S2 - 05 (1080p)", Release{
+			Title: "Show", Season: 2, Seasons: []int{2}, Episode: 5, Episodes: []int{5},
+			Resolution: "1080p", Group: "Group", Fansub: true,
+		}},
+
+		// multi-season anime batches, seasons in the name or in a tag
+		{"[Group] Show S01-S02 [1080p Dual Audio]", Release{
+			Title: "Show", Season: 1, Seasons: []int{1, 2}, SeasonPack: true,
+			Resolution: "1080p", DualAudio: true, Group: "Group", Fansub: true,
+		}},
+		{"[Group] Show S1+S2 [BD 1080p]", Release{
+			Title: "Show", Season: 1, Seasons: []int{1, 2}, SeasonPack: true,
+			Resolution: "1080p", Source: "BluRay", Group: "Group", Fansub: true,
+		}},
+		{"[Group] Show (Season 1-2) [1080p] [Batch]", Release{
+			Title: "Show", Season: 1, Seasons: []int{1, 2}, SeasonPack: true,
+			Resolution: "1080p", Group: "Group", Fansub: true,
+		}},
+		{"[Judas] Show (Seasons 1-3) [BD 1080p][HEVC x265 10bit][Dual-Audio] (Batch)", Release{
+			Title: "Show", Season: 1, Seasons: []int{1, 2, 3}, SeasonPack: true,
+			Resolution: "1080p", Source: "BluRay", Codec: "hevc", BitDepth: 10, DualAudio: true, Group: "Judas", Fansub: true,
+		}},
+
+		// numbers in titles
+		{"Blade.Runner.2049.2017.2160p.UHD.BluRay.REMUX.HDR10+.DV.HEVC.TrueHD.7.1.Atmos-GRP", Release{
+			Title: "Blade Runner 2049", Year: 2017, Resolution: "2160p", Source: "REMUX", Codec: "hevc",
+			HDR: []string{"DV", "HDR10+"}, AudioCodec: "TrueHD", AudioChannels: "7.1", Atmos: true, Group: "GRP",
+		}},
+		{"1917.2019.1080p.BDRip.x264.DD5.1-GRP", Release{
+			Title: "1917", Year: 2019, Resolution: "1080p", Source: "BDRip", Codec: "h264",
+			AudioCodec: "AC3", AudioChannels: "5.1", Group: "GRP",
+		}},
+		{"2012.2009.1080p.BluRay.x264-GRP", Release{
+			Title: "2012", Year: 2009, Resolution: "1080p", Source: "BluRay", Codec: "h264", Group: "GRP",
+		}},
+		{"2001.A.Space.Odyssey.1968.1080p.BluRay.x264-GRP", Release{
+			Title: "2001 A Space Odyssey", Year: 1968, Resolution: "1080p", Source: "BluRay", Codec: "h264", Group: "GRP",
+		}},
+		{"Show.2019", Release{Title: "Show", Year: 2019}},
+		{"Movie (2019) 1080p WEB-DL", Release{Title: "Movie", Year: 2019, Resolution: "1080p", Source: "WEB-DL"}},
+		{"Show.Name.2024.S01E01.1080p.WEB.H264-GRP", Release{
+			Title: "Show Name", Year: 2024, Season: 1, Seasons: []int{1}, Episode: 1, Episodes: []int{1},
+			Resolution: "1080p", Source: "WEB", Codec: "h264", Group: "GRP",
+		}},
+
+		// DTS is audio, TS and CAM a source only past the title
+		{"Movie.2019.1080p.BluRay.DTS.x264-GRP", Release{
+			Title: "Movie", Year: 2019, Resolution: "1080p", Source: "BluRay", Codec: "h264", AudioCodec: "DTS", Group: "GRP",
+		}},
+		{"Movie.2019.1080p.BluRay.DTS-HD.MA.5.1.x264-GRP", Release{
+			Title: "Movie", Year: 2019, Resolution: "1080p", Source: "BluRay", Codec: "h264",
+			AudioCodec: "DTS-HD MA", AudioChannels: "5.1", Group: "GRP",
+		}},
+		{"Movie.2019.TS.XviD-GRP", Release{Title: "Movie", Year: 2019, Source: "TS", Codec: "xvid", Group: "GRP"}},
+		{"Movie.2019.HDTS.x264-GRP", Release{Title: "Movie", Year: 2019, Source: "TS", Codec: "h264", Group: "GRP"}},
+		{"Movie.2019.HDCAM.x264-GRP", Release{Title: "Movie", Year: 2019, Source: "CAM", Codec: "h264", Group: "GRP"}},
+		{"Movie 2019 CAM x264", Release{Title: "Movie", Year: 2019, Source: "CAM", Codec: "h264"}},
+		{"The.TS.Show.S01E01.720p.WEB.x264-GRP", Release{
+			Title: "The TS Show", Season: 1, Seasons: []int{1}, Episode: 1, Episodes: []int{1},
+			Resolution: "720p", Source: "WEB", Codec: "h264", Group: "GRP",
+		}},
+		{"Cam.Girl.2019.1080p.WEB.x264-GRP", Release{
+			Title: "Cam Girl", Year: 2019, Resolution: "1080p", Source: "WEB", Codec: "h264", Group: "GRP",
+		}},
+
+		// dashes in the title and in the group
+		{"Spider-Man.Across.the.Spider-Verse.2023.1080p.WEBRip.x264-GRP", Release{
+			Title: "Spider-Man Across the Spider-Verse", Year: 2023, Resolution: "1080p", Source: "WEBRip",
+			Codec: "h264", Group: "GRP",
+		}},
+		{"Movie.Title.2020.1080p.WEB.x264-Spider-Man", Release{
+			Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB", Codec: "h264", Group: "Spider-Man",
+		}},
+		{"Movie.Title.2020.1080p.WEB-DL-GRP", Release{
+			Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", Group: "GRP",
+		}},
+		{"[Erai-raws] Show - 03 [720p][Multiple Subtitle]", Release{
+			Title: "Show", AbsEpisode: 3, AbsEpisodes: []int{3}, Resolution: "720p", Group: "Erai-raws", Fansub: true,
+		}},
+		// without a dash or leading brackets the last word can't be told from the rest
+		{"Show.Name.S01E01.1080p.WEB.x264 GRP", Release{
+			Title: "Show Name", Season: 1, Seasons: []int{1}, Episode: 1, Episodes: []int{1},
+			Resolution: "1080p", Source: "WEB", Codec: "h264",
+		}},
+		{"Show Name S01E01 1080p WEB x264 [GRP]", Release{
+			Title: "Show Name", Season: 1, Seasons: []int{1}, Episode: 1, Episodes: []int{1},
+			Resolution: "1080p", Source: "WEB", Codec: "h264",
+		}},
+
+		// video formats
+		{"Movie.2021.2160p.WEB-DL.DV.HDR10.DDP5.1.Atmos.H.265-GRP", Release{
+			Title: "Movie", Year: 2021, Resolution: "2160p", Source: "WEB-DL", Codec: "hevc",
+			HDR: []string{"DV", "HDR10"}, AudioCodec: "EAC3", AudioChannels: "5.1", Atmos: true, Group: "GRP",
+		}},
+		{"Movie 2020 1080p BluRay 10bit x264 AAC", Release{
+			Title: "Movie", Year: 2020, Resolution: "1080p", Source: "BluRay", Codec: "h264", BitDepth: 10, AudioCodec: "AAC",
+		}},
+
+		// languages
+		{"Film.2019.MULTi.1080p.WEB.x264-GRP", Release{
+			Title: "Film", Year: 2019, Resolution: "1080p", Source: "WEB", Codec: "h264", Multi: true, Group: "GRP",
+		}},
+		{"Show.S01E01.VOSTFR.1080p.WEB.H264-GRP", Release{
+			Title: "Show", Season: 1, Seasons: []int{1}, Episode: 1, Episodes: []int{1},
+			Resolution: "1080p", Source: "WEB", Codec: "h264", SubLanguages: []string{"fr"}, Group: "GRP",
+		}},
+		{"Movie.2018.Hindi.720p.WEBRip.x264.AAC.ESub", Release{
+			Title: "Movie", Year: 2018, Resolution: "720p", Source: "WEBRip", Codec: "h264", AudioCodec: "AAC",
+			Languages: []string{"hi"}, SubLanguages: []string{"en"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHDR(t *testing.T) {
+	r := Parse("Movie.2021.2160p.WEB-DL.DoVi.HDR10+.H.265-GRP")
+	if !r.HasHDR() || !r.DolbyVision() {
+		t.Errorf("HDR = %v", r.HDR)
+	}
+	if r := Parse("Movie.2021.1080p.WEB-DL.H.264-GRP"); r.HasHDR() || r.DolbyVision() {
+		t.Errorf("SDR release reports HDR %v", r.HDR)
+	}
+}
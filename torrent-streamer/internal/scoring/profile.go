@@ -0,0 +1,274 @@
+package scoring
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Profile is the tunable part of scoring: weights, quality ladders, size
+// bands and reject rules. A profile document is JSON; fields it leaves out
+// keep their DefaultProfile values and ladder entries are merged into the
+// built-in ones.
+type Profile struct {
+	// Version identifies the rules picks were made with; it is part of the
+	// pick key (see ProfileKey), so a new version re-evaluates episodes
+	Version string `json:"version"`
+	Weights Params `json:"weights"`
+
+	Sources     Ladder     `json:"sources"` // keyed by lowercase source ("web-dl", "remux", ...)
+	Resolutions Ladder     `json:"resolutions"`
+	Codecs      Ladder     `json:"codecs"`
+	QualityMix  QualityMix `json:"qualityMix"`
+
+	SizeBands   []SizeBand `json:"sizeBands"`   // ascending by Below
+	SizeUnknown float64    `json:"sizeUnknown"` // no size or runtime to judge by
+
+	RejectSources  []string `json:"rejectSources"`  // hard reject these sources ("CAM", "TS", ...)
+	RejectPatterns []string `json:"rejectPatterns"` // hard reject titles matching these regexps (case-insensitive)
+
+	// device fit: HDR for HDR screens, bitrate within the device budget
+	HDRBonus          float64 `json:"hdrBonus"`          // added to quality when the device prefers HDR
+	HDROnSDRPenalty   float64 `json:"hdrOnSdrPenalty"`   // taken off quality for HDR-only releases on SDR devices
+	BitrateRejectOver float64 `json:"bitrateRejectOver"` // hard reject above this multiple of MaxBitrate (0 = never)
+
+	// added to the total for the user's languages (see ProfileCaps)
+	AudioLangBonus float64 `json:"audioLangBonus"` // first choice; later ones get less
+	DualAudioBonus float64 `json:"dualAudioBonus"`
+	SubLangBonus   float64 `json:"subLangBonus"`
+
+	PreferredGroups     []string `json:"preferredGroups"`
+	BlockedGroups       []string `json:"blockedGroups"`       // hard reject
+	PreferredGroupBonus float64  `json:"preferredGroupBonus"` // added to the total
+
+	rejectRe []*regexp.Regexp
+}
+
+// Ladder scores the values of one quality attribute in [0,1]
+type Ladder struct {
+	Scores  map[string]float64 `json:"scores"`
+	Unknown float64            `json:"unknown"` // value not on the ladder or not stated
+}
+
+func (l Ladder) score(v string) float64 {
+	if s, ok := l.Scores[strings.ToLower(v)]; ok {
+		return s
+	}
+	return l.Unknown
+}
+
+// QualityMix is how the three ladders add up to the quality score
+type QualityMix struct {
+	Source     float64 `json:"source"`
+	Resolution float64 `json:"resolution"`
+	Codec      float64 `json:"codec"`
+}
+
+// SizeBand scores sizes below Below MB per minute; Below 0 catches the rest
+type SizeBand struct {
+	Below float64 `json:"below"`
+	Score float64 `json:"score"`
+}
+
+// DefaultProfile is used when no profile document is configured
+var DefaultProfile = Profile{
+	Version: "builtin-1",
+	Weights: DefaultParams,
+	Sources: Ladder{Unknown: 0.7, Scores: map[string]float64{
+		"web-dl": 1.0, "web": 0.95, "remux": 0.95, "bluray": 0.9, "bdrip": 0.85, "webrip": 0.85, "hdtv": 0.7, "dvdrip": 0.5,
+	}},
+	Resolutions: Ladder{Unknown: 0.6, Scores: map[string]float64{"2160p": 1.0, "1080p": 0.95, "720p": 0.8, "480p": 0.5}},
+	// prefer hevc/av1 for their lower bitrate where the device allows them
+	Codecs:      Ladder{Unknown: 0.7, Scores: map[string]float64{"av1": 1.0, "hevc": 0.95, "h264": 0.85, "hi10p": 0.6}},
+	QualityMix:  QualityMix{Source: 0.5, Resolution: 0.3, Codec: 0.2},
+	SizeBands:   []SizeBand{{3, 0.4}, {8, 0.8}, {14, 1.0}, {20, 0.7}, {0, 0.4}},
+	SizeUnknown: 0.5,
+
+	HDRBonus:          0.1,
+	HDROnSDRPenalty:   0.25,
+	BitrateRejectOver: 1.5,
+
+	AudioLangBonus: 0.1,
+	DualAudioBonus: 0.05,
+	SubLangBonus:   0.05,
+
+	RejectSources: []string{"CAM", "TS", "TC", "SCR"},
+}
+
+var active atomic.Pointer[Profile]
+
+func init() {
+	p, err := DefaultProfile.compiled()
+	if err != nil {
+		panic(err)
+	}
+	active.Store(p)
+}
+
+// Active returns the profile scoring currently uses
+func Active() *Profile { return active.Load() }
+
+// SetProfile makes p the active profile
+func SetProfile(p *Profile) { active.Store(p) }
+
+// ProfileKey folds the active scoring version into a device profile hash.
+// Picks are stored under this key, so changed rules make EnsurePick choose
+// again instead of returning a pick made under the old ones.
+func ProfileKey(profileHash string) string {
+	if i := strings.Index(profileHash, "|sp="); i >= 0 {
+		profileHash = profileHash[:i]
+	}
+	return profileHash + "|sp=" + Active().Version
+}
+
+// ParseProfile reads a profile document on top of DefaultProfile. Without a
+// "version" the document's content hash is used. Ladder keys are matched
+// case-insensitively: "HEVC" in the document replaces the default "hevc".
+func ParseProfile(data []byte) (*Profile, error) {
+	p := DefaultProfile.clone()
+	p.Version = ""
+	// the document's ladders are read on their own and merged in below
+	p.Sources.Scores, p.Resolutions.Scores, p.Codecs.Scores = nil, nil, nil
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	for _, l := range []struct {
+		name     string
+		doc      *map[string]float64
+		defaults map[string]float64
+	}{
+		{"sources", &p.Sources.Scores, DefaultProfile.Sources.Scores},
+		{"resolutions", &p.Resolutions.Scores, DefaultProfile.Resolutions.Scores},
+		{"codecs", &p.Codecs.Scores, DefaultProfile.Codecs.Scores},
+	} {
+		merged, err := mergeLadder(l.defaults, *l.doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.name, err)
+		}
+		*l.doc = merged
+	}
+	if p.Version == "" {
+		sum := sha256.Sum256(data)
+		p.Version = "sha-" + hex.EncodeToString(sum[:6])
+	}
+	if strings.Contains(p.Version, "|") {
+		return nil, fmt.Errorf("version must not contain '|'")
+	}
+	return p.compiled()
+}
+
+// LoadProfileFile reads a profile document from disk
+func LoadProfileFile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParseProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// WatchProfile reloads the profile at path whenever the file changes. A
+// document that fails to parse is logged and the previous profile kept.
+func WatchProfile(ctx context.Context, path string, every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	var last time.Time
+	if fi, err := os.Stat(path); err == nil {
+		last = fi.ModTime()
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fi, err := os.Stat(path)
+			if err != nil || fi.ModTime().Equal(last) {
+				continue
+			}
+			last = fi.ModTime()
+			p, err := LoadProfileFile(path)
+			if err != nil {
+				log.Printf("[scoring] reload failed, keeping %s: %v", Active().Version, err)
+				continue
+			}
+			if old := Active().Version; old != p.Version {
+				log.Printf("[scoring] profile %s → %s", old, p.Version)
+			}
+			SetProfile(p)
+		}
+	}
+}
+
+func (p Profile) clone() Profile {
+	cp := p
+	cp.Sources.Scores = cloneMap(p.Sources.Scores)
+	cp.Resolutions.Scores = cloneMap(p.Resolutions.Scores)
+	cp.Codecs.Scores = cloneMap(p.Codecs.Scores)
+	cp.SizeBands = append([]SizeBand(nil), p.SizeBands...)
+	cp.RejectSources = append([]string(nil), p.RejectSources...)
+	cp.RejectPatterns = append([]string(nil), p.RejectPatterns...)
+	cp.PreferredGroups = append([]string(nil), p.PreferredGroups...)
+	cp.BlockedGroups = append([]string(nil), p.BlockedGroups...)
+	return cp
+}
+
+// mergeLadder returns defaults with the document's scores laid over them,
+// all keys lowercased
+func mergeLadder(defaults, doc map[string]float64) (map[string]float64, error) {
+	out := cloneMap(defaults)
+	seen := make(map[string]string, len(doc))
+	for k, v := range doc {
+		lk := strings.ToLower(k)
+		if other, ok := seen[lk]; ok {
+			return nil, fmt.Errorf("%q and %q are the same key", other, k)
+		}
+		seen[lk] = k
+		out[lk] = v
+	}
+	return out, nil
+}
+
+func cloneMap(m map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(m))
+	for k, v := range m {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+// compiled returns a copy with ladder keys lowercased and patterns compiled
+func (p Profile) compiled() (*Profile, error) {
+	cp := p.clone()
+	cp.rejectRe = nil
+	for _, pat := range cp.RejectPatterns {
+		re, err := regexp.Compile("(?i)" + pat)
+		if err != nil {
+			return nil, fmt.Errorf("reject pattern %q: %w", pat, err)
+		}
+		cp.rejectRe = append(cp.rejectRe, re)
+	}
+	return &cp, nil
+}
+
+func hasFold(list []string, v string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
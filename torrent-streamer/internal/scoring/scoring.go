@@ -1,42 +1,135 @@
 package scoring
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"math"
+	"slices"
+	"strconv"
 	"strings"
 
 	"torrent-streamer/pkg/types"
 )
 
+// ProfileCaps is what a device can play plus its user's preferences; it is
+// stored as a device's capabilities (see ProfileHash)
 type ProfileCaps struct {
-	PreferHDR  bool
-	MaxBitrate int64           // bits per second budget (optional)
-	AllowHi10P bool            // avoid hi10p on most TVs
-	CodecAllow map[string]bool // e.g. {"h264":true,"hevc":true,"av1":false}
+	PreferHDR  bool            `json:"preferHdr"`
+	MaxBitrate int64           `json:"maxBitrate,omitempty"` // bits per second budget (optional)
+	AllowHi10P bool            `json:"allowHi10p"`           // avoid hi10p on most TVs
+	CodecAllow map[string]bool `json:"codecs"`               // e.g. {"h264":true,"hevc":true,"av1":false}
+
+	// user preferences
+	MaxResolution   string   `json:"maxResolution,omitempty"`   // e.g. "1080p" to skip 2160p releases ("" = any)
+	AudioLangs      []string `json:"audioLangs,omitempty"`      // ISO 639-1, most wanted first
+	RequireAudio    bool     `json:"requireAudio,omitempty"`    // reject releases known to have none of AudioLangs
+	PreferDualAudio bool     `json:"preferDualAudio,omitempty"` // favour dual/multi audio releases
+	SubLangs        []string `json:"subLangs,omitempty"`        // subtitles needed unless the audio is in one of these
+}
+
+// DefaultCaps is used for clients that don't name a registered device
+var DefaultCaps = ProfileCaps{CodecAllow: map[string]bool{"h264": true, "hevc": true, "av1": true}}
+
+// Normalized lowercases codec names and drops disallowed ones, so equal caps
+// compare (and hash) equal
+func (c ProfileCaps) Normalized() ProfileCaps {
+	allow := make(map[string]bool, len(c.CodecAllow))
+	for k, ok := range c.CodecAllow {
+		if k = strings.ToLower(strings.TrimSpace(k)); ok && k != "" {
+			allow[k] = true
+		}
+	}
+	c.CodecAllow = allow
+	c.MaxResolution = strings.ToLower(strings.TrimSpace(c.MaxResolution))
+	c.AudioLangs, c.SubLangs = normLangs(c.AudioLangs), normLangs(c.SubLangs)
+	return c
+}
+
+func normLangs(in []string) []string {
+	var out []string
+	for _, l := range in {
+		if l = strings.ToLower(strings.TrimSpace(l)); l != "" && !slices.Contains(out, l) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// ProfileHash is the canonical profile hash for caps: devices that can play
+// the same things with the same preferences share picks.
+func ProfileHash(caps ProfileCaps) string {
+	b, _ := json.Marshal(caps.Normalized()) // map keys are marshalled sorted
+	sum := sha256.Sum256(b)
+	return "caps:" + hex.EncodeToString(sum[:8])
+}
+
+// resolutionLines reads "1080p" as 1080, 0 when unknown
+func resolutionLines(res string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.ToLower(res), "p"))
+	return n
 }
 
 type Params struct {
-	WHealth, WQuality, WSize, WConsistency float64
+	WHealth      float64 `json:"health"`
+	WQuality     float64 `json:"quality"`
+	WSize        float64 `json:"size"`
+	WConsistency float64 `json:"consistency"`
 }
 
 var DefaultParams = Params{WHealth: 0.45, WQuality: 0.35, WSize: 0.15, WConsistency: 0.05}
 
-func HardReject(c types.Candidate, caps ProfileCaps) (string, bool) {
+func HardReject(c types.Candidate, caps ProfileCaps, prof *Profile) (string, bool) {
 	// reject CAM/TS/TC, weird codecs, unsupported codec
-	title := strings.ToLower(c.Title)
-	if strings.Contains(title, "cam ") || strings.Contains(title, "hdcam") || strings.Contains(title, "ts ") || strings.Contains(title, "telesync") || strings.Contains(title, "telecine") {
+	if hasFold(prof.RejectSources, c.Source) {
 		return "bad_source", true
 	}
-	if !caps.CodecAllow[strings.ToLower(c.Codec)] {
-		return "unsupported_codec", true
+	for _, re := range prof.rejectRe {
+		if re.MatchString(c.Title) {
+			return "rejected_pattern", true
+		}
+	}
+	if c.ReleaseGroup != "" && hasFold(prof.BlockedGroups, c.ReleaseGroup) {
+		return "blocked_group", true
 	}
 	if strings.ToLower(c.Codec) == "hi10p" && !caps.AllowHi10P {
 		return "hi10p_tv_unfriendly", true
 	}
+	// an unnamed codec is most likely h264 and is left to the quality score
+	if c.Codec != "" && !codecAllowed(c.Codec, caps) {
+		return "unsupported_codec", true
+	}
+	if limit := resolutionLines(caps.MaxResolution); limit > 0 && resolutionLines(c.Resolution) > limit {
+		return "over_resolution", true
+	}
+	// languages only count against a release that names its own
+	if caps.RequireAudio && len(caps.AudioLangs) > 0 && len(c.Languages) > 0 && !c.MultiAudio &&
+		audioRank(c, caps) < 0 {
+		return "audio_language", true
+	}
+	if len(caps.SubLangs) > 0 && len(c.SubLanguages) > 0 && !c.MultiSubs &&
+		!anyLang(c.SubLanguages, caps.SubLangs) && !anyLang(c.Languages, caps.SubLangs) {
+		return "missing_subtitles", true
+	}
+	// file list known and nothing but sample clips in it
+	if c.Files > 0 && c.SampleFiles > 0 && c.FileIndex == nil && c.EpisodeFiles == 0 {
+		return "sample_only", true
+	}
 	// absurdly large or tiny sizes (MB/min sanity)
 	// leave size sanity to soft score; we only hard reject extremes if SizeBytes known
 	return "", false
 }
 
+// codecAllowed reports whether the device decodes codec; hi10p is 10-bit
+// h264, so it also needs h264 (AllowHi10P is checked separately)
+func codecAllowed(codec string, caps ProfileCaps) bool {
+	codec = strings.ToLower(codec)
+	if codec == "hi10p" {
+		return caps.CodecAllow["hi10p"] || caps.CodecAllow["h264"]
+	}
+	return caps.CodecAllow[codec]
+}
+
 func logNormSeeders(s int) float64 {
 	if s <= 0 {
 		return 0
@@ -49,84 +142,168 @@ func logNormSeeders(s int) float64 {
 	return v
 }
 
-func qualityFit(c types.Candidate, caps ProfileCaps) float64 {
-	// simple ladder: WEB-DL > WEBRip > HDTV > BluRay remux? (you can tweak)
-	src := map[string]float64{"web-dl": 1.0, "webrip": 0.85, "hdtv": 0.7, "bluray": 0.9}
-	base := src[strings.ToLower(c.Source)]
-	if base == 0 {
-		base = 0.7
-	}
+func qualityFit(c types.Candidate, caps ProfileCaps, prof *Profile) float64 {
+	base := prof.Sources.score(c.Source)
+	rw := prof.Resolutions.score(c.Resolution)
 
-	// resolution weight
-	res := map[string]float64{"2160p": 1.0, "1080p": 0.95, "720p": 0.8, "480p": 0.5}
-	rw := res[strings.ToLower(c.Resolution)]
-	if rw == 0 {
-		rw = 0.6
+	// codec preference (device-aware)
+	codec := strings.ToLower(c.Codec)
+	cw := prof.Codecs.score(codec)
+	if codec != "" && !codecAllowed(codec, caps) {
+		cw = 0.0
 	}
 
-	// codec preference (device-aware), prefer hevc for lower bitrate if allowed
-	codec := strings.ToLower(c.Codec)
-	cw := 0.8
-	switch codec {
-	case "av1":
-		cw = 1.0
-	case "hevc", "x265":
-		cw = 0.95
-	case "h264", "x264":
-		cw = 0.85
-	case "hi10p":
-		cw = 0.6
+	m := prof.QualityMix
+	q := m.Source*base + m.Resolution*rw + m.Codec*cw
+	switch {
+	case len(c.HDR) == 0:
+	case caps.PreferHDR:
+		q += prof.HDRBonus
 	default:
-		cw = 0.7
+		// an SDR screen gets HDR tone-mapped (or DV in wrong colours)
+		q -= prof.HDROnSDRPenalty
 	}
-	if !caps.CodecAllow[codec] {
-		cw = 0.0
+	return math.Max(0, math.Min(1, q))
+}
+
+// episodeBytes is the size of the episode's own file, if it can be told
+func episodeBytes(c types.Candidate) int64 {
+	if c.SizeBytes <= 0 {
+		return 0
+	}
+	if c.FileIndex == nil && c.SourceKind == "season_pack" {
+		// the episode is one of several files; judge by its share
+		if c.EpisodeFiles <= 0 {
+			return 0
+		}
+		return c.SizeBytes / int64(c.EpisodeFiles)
 	}
+	return c.SizeBytes
+}
 
-	return 0.5*base + 0.3*rw + 0.2*cw
+// EstBitrate is the average bits per second implied by size and runtime,
+// 0 when either is unknown
+func EstBitrate(c types.Candidate, estRuntimeMin float64) int64 {
+	size := episodeBytes(c)
+	if size <= 0 || estRuntimeMin <= 0 {
+		return 0
+	}
+	return int64(float64(size) * 8 / (estRuntimeMin * 60))
 }
 
-func sizeSanity(c types.Candidate, estRuntimeMin float64, caps ProfileCaps) float64 {
-	// MB/min sanity within device bandwidth budget; if no size, neutral 0.5
-	if c.SizeBytes <= 0 || estRuntimeMin <= 0 {
-		return 0.5
+func sizeSanity(c types.Candidate, estRuntimeMin float64, caps ProfileCaps, prof *Profile) float64 {
+	// MB/min sanity within device bandwidth budget; if no size, neutral
+	size := episodeBytes(c)
+	if size <= 0 || estRuntimeMin <= 0 {
+		return prof.SizeUnknown
 	}
-	mb := float64(c.SizeBytes) / (1024 * 1024)
+	mb := float64(size) / (1024 * 1024)
 	mbpm := mb / estRuntimeMin
-	// simple bands (tune later)
-	switch {
-	case mbpm < 3:
-		return 0.4
-	case mbpm < 8:
-		return 0.8
-	case mbpm < 14:
-		return 1.0
-	case mbpm < 20:
-		return 0.7
-	default:
-		return 0.4
+	s := prof.SizeUnknown
+	for _, b := range prof.SizeBands {
+		if b.Below <= 0 || mbpm < b.Below {
+			s = b.Score
+			break
+		}
+	}
+	// over the device budget it would stall; scale down by how far over
+	if br := EstBitrate(c, estRuntimeMin); caps.MaxBitrate > 0 && br > caps.MaxBitrate {
+		s *= float64(caps.MaxBitrate) / float64(br)
+	}
+	return s
+}
+
+// overBudget reports a bitrate too far above the device budget to play
+func overBudget(c types.Candidate, estRuntimeMin float64, caps ProfileCaps, prof *Profile) bool {
+	if caps.MaxBitrate <= 0 || prof.BitrateRejectOver <= 0 {
+		return false
+	}
+	return float64(EstBitrate(c, estRuntimeMin)) > float64(caps.MaxBitrate)*prof.BitrateRejectOver
+}
+
+// audioRank is the position in caps.AudioLangs of the release's best audio
+// language, -1 when it has none of them (or names none)
+func audioRank(c types.Candidate, caps ProfileCaps) int {
+	best := -1
+	for _, l := range c.Languages {
+		if i := slices.Index(caps.AudioLangs, strings.ToLower(l)); i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
 	}
+	return best
 }
 
-func consistency(c types.Candidate, prior *types.Pick) float64 {
-	if prior == nil || prior.ReleaseGroup == nil {
+func anyLang(have, want []string) bool {
+	for _, l := range have {
+		if slices.Contains(want, strings.ToLower(l)) {
+			return true
+		}
+	}
+	return false
+}
+
+// languageBonus rewards the audio and subtitles the user asked for
+func languageBonus(c types.Candidate, caps ProfileCaps, prof *Profile) float64 {
+	b := 0.0
+	if n := len(caps.AudioLangs); n > 0 {
+		if i := audioRank(c, caps); i >= 0 {
+			b += prof.AudioLangBonus * float64(n-i) / float64(n)
+		}
+	}
+	if caps.PreferDualAudio && (c.DualAudio || c.MultiAudio || len(c.Languages) > 1) {
+		b += prof.DualAudioBonus
+	}
+	if len(caps.SubLangs) > 0 && (c.MultiSubs || anyLang(c.SubLanguages, caps.SubLangs)) {
+		b += prof.SubLangBonus
+	}
+	return b
+}
+
+// History is what earlier episodes of a series say about release groups
+type History struct {
+	Prior          *types.Pick `json:"prior,omitempty"`          // previous episode's pick
+	PreferredGroup string      `json:"preferredGroup,omitempty"` // learnt from completed episodes
+	Confidence     int         `json:"confidence,omitempty"`     // how often that held up
+}
+
+// confidence at which the preferred group counts as much as the prior episode's
+const fullConfidence = 5
+
+func consistency(c types.Candidate, h History) float64 {
+	if c.ReleaseGroup == "" {
 		return 0.5
 	}
-	if strings.EqualFold(c.ReleaseGroup, *prior.ReleaseGroup) {
+	if h.Prior != nil && h.Prior.ReleaseGroup != nil && strings.EqualFold(c.ReleaseGroup, *h.Prior.ReleaseGroup) {
 		return 1.0
 	}
+	if h.PreferredGroup != "" && strings.EqualFold(c.ReleaseGroup, h.PreferredGroup) {
+		return 0.5 + 0.5*float64(min(h.Confidence, fullConfidence))/fullConfidence
+	}
 	return 0.5
 }
 
-func Score(c types.Candidate, caps ProfileCaps, estRuntimeMin float64, prior *types.Pick, p Params) types.ScoreBreakdown {
-	if why, reject := HardReject(c, caps); reject {
+// Score rates a candidate with prof, or the active profile when prof is nil
+func Score(c types.Candidate, caps ProfileCaps, estRuntimeMin float64, hist History, prof *Profile) types.ScoreBreakdown {
+	if prof == nil {
+		prof = Active()
+	}
+	if why, reject := HardReject(c, caps, prof); reject {
 		return types.ScoreBreakdown{HardReject: why, Total: -1}
 	}
+	if overBudget(c, estRuntimeMin, caps, prof) {
+		return types.ScoreBreakdown{HardReject: "over_bitrate", Total: -1}
+	}
+	p := prof.Weights
 	sb := types.ScoreBreakdown{}
 	sb.Health = logNormSeeders(c.Seeders)
-	sb.Quality = qualityFit(c, caps)
-	sb.Size = sizeSanity(c, estRuntimeMin, caps)
-	sb.Consistency = consistency(c, prior)
+	sb.Quality = qualityFit(c, caps, prof)
+	sb.Size = sizeSanity(c, estRuntimeMin, caps, prof)
+	sb.Consistency = consistency(c, hist)
 	sb.Total = p.WHealth*sb.Health + p.WQuality*sb.Quality + p.WSize*sb.Size + p.WConsistency*sb.Consistency
+	sb.Bonus = languageBonus(c, caps, prof)
+	if c.ReleaseGroup != "" && hasFold(prof.PreferredGroups, c.ReleaseGroup) {
+		sb.Bonus += prof.PreferredGroupBonus
+	}
+	sb.Total += sb.Bonus
 	return sb
 }
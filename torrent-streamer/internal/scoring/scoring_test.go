@@ -0,0 +1,156 @@
+package scoring
+
+import (
+	"math"
+	"testing"
+
+	"torrent-streamer/pkg/types"
+)
+
+func TestHardRejectHi10P(t *testing.T) {
+	c := types.Candidate{Title: "Show - 05 [1080p Hi10P]", Codec: "hi10p", BitDepth: 10, Source: "BluRay"}
+	tests := []struct {
+		name string
+		caps ProfileCaps
+		want string
+	}{
+		{"tv without hi10p", ProfileCaps{CodecAllow: map[string]bool{"h264": true}}, "hi10p_tv_unfriendly"},
+		{"hi10p allowed", ProfileCaps{AllowHi10P: true, CodecAllow: map[string]bool{"h264": true}}, ""},
+		{"no h264 decoder", ProfileCaps{AllowHi10P: true, CodecAllow: map[string]bool{"hevc": true}}, "unsupported_codec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if why, _ := HardReject(c, tt.caps, Active()); why != tt.want {
+				t.Errorf("HardReject = %q, want %q", why, tt.want)
+			}
+		})
+	}
+
+	// an allowed hi10p release keeps its codec score
+	caps := ProfileCaps{AllowHi10P: true, CodecAllow: map[string]bool{"h264": true}}
+	withCodec := qualityFit(c, caps, Active())
+	c.Codec = "mpeg2"
+	if other := qualityFit(c, ProfileCaps{CodecAllow: map[string]bool{"h264": true}}, Active()); withCodec <= other {
+		t.Errorf("hi10p quality %.3f not above an undecodable codec's %.3f", withCodec, other)
+	}
+}
+
+// 40 minutes at bits per second b
+func sizeAt(b int64) int64 { return b * 40 * 60 / 8 }
+
+func TestScoreDeviceClasses(t *testing.T) {
+	sdrTV := ProfileCaps{CodecAllow: map[string]bool{"h264": true}}
+	hdrTV := ProfileCaps{PreferHDR: true, CodecAllow: map[string]bool{"h264": true, "hevc": true}}
+	mobile := ProfileCaps{MaxBitrate: 4_000_000, CodecAllow: map[string]bool{"h264": true, "hevc": true}}
+
+	// 0.5*webrip 0.85 + 0.3*720p 0.8 + 0.2*h264 0.85
+	const base = 0.835
+	sdr := types.Candidate{Source: "WEBRip", Resolution: "720p", Codec: "h264", Seeders: 50}
+	hdr := sdr
+	hdr.HDR = []string{"HDR10"}
+	uhd := types.Candidate{Source: "WEB-DL", Resolution: "2160p", Codec: "hevc", HDR: []string{"DV", "HDR10"}, Seeders: 50}
+	sized := func(c types.Candidate, b int64) types.Candidate { c.SizeBytes = sizeAt(b); return c }
+
+	prof := Active()
+	tests := []struct {
+		name    string
+		caps    ProfileCaps
+		c       types.Candidate
+		reject  string
+		quality float64
+	}{
+		{"sdr tv: sdr release", sdrTV, sdr, "", base},
+		{"sdr tv: hdr penalty", sdrTV, hdr, "", base - prof.HDROnSDRPenalty},
+		{"sdr tv: hevc not decodable", sdrTV, uhd, "unsupported_codec", 0},
+		{"hdr tv: sdr release", hdrTV, sdr, "", base},
+		{"hdr tv: hdr bonus", hdrTV, hdr, "", base + prof.HDRBonus},
+		{"hdr tv: dv capped at 1", hdrTV, uhd, "", 1},
+		{"mobile: hdr penalty", mobile, hdr, "", base - prof.HDROnSDRPenalty},
+		{"mobile: within budget", mobile, sized(sdr, 4_000_000), "", base},
+		{"mobile: at the reject limit", mobile, sized(sdr, 6_000_000), "", base},
+		{"mobile: over the reject limit", mobile, sized(sdr, 6_400_000), "over_bitrate", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := Score(tt.c, tt.caps, 40, History{}, prof)
+			if sb.HardReject != tt.reject {
+				t.Fatalf("reject = %q, want %q", sb.HardReject, tt.reject)
+			}
+			if tt.reject != "" {
+				if sb.Total >= 0 {
+					t.Errorf("rejected total = %v", sb.Total)
+				}
+				return
+			}
+			if math.Abs(sb.Quality-tt.quality) > 1e-9 {
+				t.Errorf("quality = %.4f, want %.4f", sb.Quality, tt.quality)
+			}
+		})
+	}
+}
+
+func TestSizeOverBudget(t *testing.T) {
+	prof := Active()
+	caps := ProfileCaps{MaxBitrate: 4_000_000}
+	free := ProfileCaps{}
+	for _, over := range []float64{1, 1.1, 1.25, 1.5} {
+		c := types.Candidate{SizeBytes: sizeAt(int64(over * 4_000_000))}
+		got, unlimited := sizeSanity(c, 40, caps, prof), sizeSanity(c, 40, free, prof)
+		// between 1x and 1.5x the budget the size score shrinks by budget/bitrate
+		if want := unlimited / over; math.Abs(got-want) > 1e-9 {
+			t.Errorf("%.2fx budget: size %.4f, want %.4f", over, got, want)
+		}
+	}
+}
+
+func TestSeasonPackEpisodeBytes(t *testing.T) {
+	const pack = 10 * 1200_000_000
+	tests := []struct {
+		name string
+		c    types.Candidate
+		want int64
+	}{
+		{"pack without a file", types.Candidate{SizeBytes: pack, SourceKind: "season_pack", EpisodeFiles: 10}, pack / 10},
+		{"pack with the episode file", types.Candidate{SizeBytes: 1_300_000_000, SourceKind: "season_pack", EpisodeFiles: 10, FileIndex: new(int)}, 1_300_000_000},
+		{"pack of unknown layout", types.Candidate{SizeBytes: pack, SourceKind: "season_pack"}, 0},
+		{"single episode", types.Candidate{SizeBytes: 1_200_000_000, SourceKind: "single"}, 1_200_000_000},
+	}
+	for _, tt := range tests {
+		if got := episodeBytes(tt.c); got != tt.want {
+			t.Errorf("%s: episodeBytes = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// the whole pack would be far over a 4 Mbps budget; its per-episode share is not
+	c := types.Candidate{Source: "WEB-DL", Codec: "h264", SizeBytes: pack, SourceKind: "season_pack", EpisodeFiles: 10}
+	caps := ProfileCaps{MaxBitrate: 4_000_000, CodecAllow: map[string]bool{"h264": true}}
+	if br := EstBitrate(c, 40); br != 4_000_000 {
+		t.Errorf("EstBitrate = %d, want 4000000", br)
+	}
+	if sb := Score(c, caps, 40, History{}, nil); sb.HardReject != "" {
+		t.Errorf("season pack rejected: %s", sb.HardReject)
+	}
+}
+
+func TestParseProfileLadderKeys(t *testing.T) {
+	p, err := ParseProfile([]byte(`{"version": "t", "codecs": {"scores": {"HEVC": 0.5, "VP9": 0.4}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the document's key wins over the default whatever its case
+	for k, want := range map[string]float64{"hevc": 0.5, "vp9": 0.4, "h264": 0.85} {
+		if got, ok := p.Codecs.Scores[k]; !ok || got != want {
+			t.Errorf("codecs[%s] = %v %v, want %v", k, got, ok, want)
+		}
+	}
+	if len(p.Codecs.Scores) != len(DefaultProfile.Codecs.Scores)+1 {
+		t.Errorf("codecs = %v", p.Codecs.Scores)
+	}
+	if p.Sources.Scores["web-dl"] != 1.0 {
+		t.Errorf("default sources lost: %v", p.Sources.Scores)
+	}
+
+	if _, err := ParseProfile([]byte(`{"codecs": {"scores": {"HEVC": 0.5, "hevc": 0.9}}}`)); err == nil {
+		t.Error("keys differing only in case accepted")
+	}
+}
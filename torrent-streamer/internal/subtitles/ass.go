@@ -0,0 +1,450 @@
+package subtitles
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// assStyle holds the parts of an ASS/SSA style that survive in WebVTT
+type assStyle struct {
+	bold, italic, underline bool
+	align                   int // numpad alignment 1..9
+}
+
+// assDoc is a parsed ASS/SSA script header: styles, event format and canvas size
+type assDoc struct {
+	playResX, playResY float64
+	wrapStyle          int
+	styles             map[string]assStyle
+	eventFormat        []string // lowercased field names of the [Events] Format line
+}
+
+var defaultASSEventFormat = []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+
+// ASSToVTT converts ASS/SSA subtitles to WebVTT, keeping bold/italic/underline,
+// line breaks and positioning (\an, \a, \pos, \move) as VTT cue settings
+func ASSToVTT(ass string) string {
+	doc, events := parseASS(ass)
+	var cues []Cue
+	for _, ev := range events {
+		if c, ok := doc.eventCue(ev); ok {
+			cues = append(cues, c)
+		}
+	}
+	return WriteVTT(cues)
+}
+
+// IsASS reports whether content looks like an ASS/SSA script
+func IsASS(content string) bool {
+	head := strings.ToLower(content)
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	return strings.Contains(head, "[script info]") || strings.Contains(head, "[events]") ||
+		strings.Contains(head, "[v4+ styles]") || strings.Contains(head, "[v4 styles]")
+}
+
+func newASSDoc() *assDoc {
+	return &assDoc{
+		playResX: 384, playResY: 288, // spec defaults when the header omits them
+		styles:      map[string]assStyle{"default": {align: 2}},
+		eventFormat: defaultASSEventFormat,
+	}
+}
+
+// parseASS returns the script header and the raw Dialogue field maps
+func parseASS(ass string) (*assDoc, []map[string]string) {
+	doc := newASSDoc()
+	var events []map[string]string
+	ass = strings.TrimPrefix(ass, "\ufeff")
+	ass = strings.ReplaceAll(ass, "\r\n", "\n")
+	ass = strings.ReplaceAll(ass, "\r", "\n")
+
+	section := ""
+	var styleFormat []string
+	playResSet := false
+	for _, raw := range strings.Split(ass, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(line)
+			continue
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+
+		switch section {
+		case "[script info]":
+			switch key {
+			case "playresx":
+				if v, err := strconv.ParseFloat(val, 64); err == nil && v > 0 {
+					doc.playResX = v
+					playResSet = true
+				}
+			case "playresy":
+				if v, err := strconv.ParseFloat(val, 64); err == nil && v > 0 {
+					doc.playResY = v
+					playResSet = true
+				}
+			case "wrapstyle":
+				doc.wrapStyle, _ = strconv.Atoi(val)
+			}
+		case "[v4+ styles]", "[v4 styles]", "[v4 styles+]":
+			switch key {
+			case "format":
+				styleFormat = splitFormat(val)
+			case "style":
+				if styleFormat == nil {
+					continue
+				}
+				fields := splitFields(val, len(styleFormat))
+				name, st := parseASSStyle(styleFormat, fields, section == "[v4 styles]")
+				doc.styles[name] = st
+			}
+		case "[events]":
+			switch key {
+			case "format":
+				doc.eventFormat = splitFormat(val)
+			case "dialogue":
+				fields := splitFields(val, len(doc.eventFormat))
+				ev := make(map[string]string, len(fields))
+				for i, f := range fields {
+					ev[doc.eventFormat[i]] = f
+				}
+				events = append(events, ev)
+			}
+		}
+	}
+	// Scripts with only one of PlayResX/PlayResY set scale the other by 4:3
+	if playResSet {
+		if doc.playResX == 384 && doc.playResY != 288 {
+			doc.playResX = doc.playResY * 4 / 3
+		} else if doc.playResY == 288 && doc.playResX != 384 {
+			doc.playResY = doc.playResX * 3 / 4
+		}
+	}
+	return doc, events
+}
+
+func splitFormat(val string) []string {
+	parts := strings.Split(val, ",")
+	for i := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(parts[i]))
+	}
+	return parts
+}
+
+// splitFields splits on commas into at most n fields; the last one (Text) keeps its commas
+func splitFields(val string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	parts := strings.SplitN(val, ",", n)
+	for i := range parts {
+		if i < len(parts)-1 || len(parts) < n {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+	}
+	return parts
+}
+
+func parseASSStyle(format, fields []string, legacy bool) (string, assStyle) {
+	st := assStyle{align: 2}
+	name := "default"
+	for i, f := range fields {
+		if i >= len(format) {
+			break
+		}
+		switch format[i] {
+		case "name":
+			name = normStyleName(f)
+		case "bold":
+			st.bold = f != "0" && f != ""
+		case "italic":
+			st.italic = f != "0" && f != ""
+		case "underline":
+			st.underline = f != "0" && f != ""
+		case "alignment":
+			n, _ := strconv.Atoi(f)
+			if legacy {
+				n = ssaToNumpad(n)
+			}
+			if n >= 1 && n <= 9 {
+				st.align = n
+			}
+		}
+	}
+	return name, st
+}
+
+// style names are matched case-insensitively; some tools prefix them with '*'
+func normStyleName(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "*"))
+}
+
+// ssaToNumpad maps legacy SSA \a alignment (1-3 sub, +4 top, +8 mid) to numpad \an
+func ssaToNumpad(a int) int {
+	h := a & 3
+	if h == 0 {
+		return 2
+	}
+	switch {
+	case a&4 != 0:
+		return h + 6
+	case a&8 != 0:
+		return h + 3
+	default:
+		return h
+	}
+}
+
+// parseASSTime parses H:MM:SS.cc (centiseconds; extra digits are tolerated)
+func parseASSTime(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	secStr, frac, _ := strings.Cut(parts[2], ".")
+	sec, err3 := strconv.Atoi(secStr)
+	if err1 != nil || err2 != nil || err3 != nil || h < 0 || m < 0 || sec < 0 {
+		return 0, false
+	}
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	if frac != "" {
+		// pad/truncate to milliseconds
+		for len(frac) < 3 {
+			frac += "0"
+		}
+		if ms, err := strconv.Atoi(frac[:3]); err == nil {
+			d += time.Duration(ms) * time.Millisecond
+		}
+	}
+	return d, true
+}
+
+// eventCue converts one Dialogue field map into a cue
+func (d *assDoc) eventCue(ev map[string]string) (Cue, bool) {
+	start, ok1 := parseASSTime(ev["start"])
+	end, ok2 := parseASSTime(ev["end"])
+	if !ok1 || !ok2 || end <= start {
+		return Cue{}, false
+	}
+	text, settings := d.renderText(ev["style"], ev["text"])
+	if strings.TrimSpace(text) == "" {
+		return Cue{}, false
+	}
+	return Cue{Start: start, End: end, Text: text, Settings: settings}, true
+}
+
+var (
+	assPosRe  = regexp.MustCompile(`^(?:pos|move)\(\s*(-?[\d.]+)\s*,\s*(-?[\d.]+)`)
+	assAnRe   = regexp.MustCompile(`^an(\d)`)
+	assARe    = regexp.MustCompile(`^a(\d{1,2})`)
+	assFlagRe = regexp.MustCompile(`^([biu])(\d*)$`)
+	assDrawRe = regexp.MustCompile(`^p(\d+)`)
+)
+
+// renderText turns ASS event text into VTT markup plus cue settings
+func (d *assDoc) renderText(styleName, text string) (string, string) {
+	base, ok := d.styles[normStyleName(styleName)]
+	if !ok {
+		base = d.styles["default"]
+	}
+	cur := base
+	align := base.align
+	posX, posY := -1.0, -1.0
+	drawing := false
+
+	var out strings.Builder
+	// open tags as a stack so closing one keeps VTT markup properly nested
+	var open []byte
+	isOpen := func(tag byte) bool { return bytes.IndexByte(open, tag) >= 0 }
+	setFlag := func(tag byte, on bool) {
+		if isOpen(tag) == on {
+			return
+		}
+		if on {
+			open = append(open, tag)
+			out.WriteString("<" + string(tag) + ">")
+			return
+		}
+		k := bytes.IndexByte(open, tag)
+		for j := len(open) - 1; j >= k; j-- {
+			out.WriteString("</" + string(open[j]) + ">")
+		}
+		reopen := append([]byte{}, open[k+1:]...)
+		open = open[:k]
+		for _, t := range reopen {
+			open = append(open, t)
+			out.WriteString("<" + string(t) + ">")
+		}
+	}
+	applyStyle := func(s assStyle) {
+		setFlag('b', s.bold)
+		setFlag('i', s.italic)
+		setFlag('u', s.underline)
+	}
+	applyStyle(cur)
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '{':
+			j := strings.IndexByte(text[i:], '}')
+			if j < 0 {
+				// unclosed override block: drop the rest like VSFilter does
+				i = len(text)
+				continue
+			}
+			block := text[i+1 : i+j]
+			i += j + 1
+			for _, tag := range strings.Split(block, `\`)[1:] {
+				tag = strings.TrimSpace(tag)
+				switch {
+				case tag == "":
+				case tag == "r" || strings.HasPrefix(tag, "r") && !strings.HasPrefix(tag, "rnd"):
+					if st, ok := d.styles[normStyleName(tag[1:])]; ok && tag != "r" {
+						cur = st
+					} else {
+						cur = base
+					}
+					applyStyle(cur)
+				case assFlagRe.MatchString(tag):
+					m := assFlagRe.FindStringSubmatch(tag)
+					on := m[2] != "0" && m[2] != ""
+					if m[1] == "b" && m[2] != "" && m[2] != "0" && m[2] != "1" {
+						n, _ := strconv.Atoi(m[2]) // font weight
+						on = n >= 600
+					}
+					if m[2] == "" {
+						on = map[string]bool{"b": base.bold, "i": base.italic, "u": base.underline}[m[1]]
+					}
+					setFlag(m[1][0], on)
+				case assAnRe.MatchString(tag):
+					if n, _ := strconv.Atoi(assAnRe.FindStringSubmatch(tag)[1]); n >= 1 && n <= 9 {
+						align = n
+					}
+				case assARe.MatchString(tag):
+					n, _ := strconv.Atoi(assARe.FindStringSubmatch(tag)[1])
+					align = ssaToNumpad(n)
+				case assPosRe.MatchString(tag):
+					m := assPosRe.FindStringSubmatch(tag)
+					posX, _ = strconv.ParseFloat(m[1], 64)
+					posY, _ = strconv.ParseFloat(m[2], 64)
+				case assDrawRe.MatchString(tag):
+					n, _ := strconv.Atoi(assDrawRe.FindStringSubmatch(tag)[1])
+					drawing = n > 0
+				}
+			}
+		case c == '\\' && i+1 < len(text):
+			switch text[i+1] {
+			case 'N':
+				out.WriteByte('\n')
+			case 'n':
+				if d.wrapStyle == 2 {
+					out.WriteByte('\n')
+				} else {
+					out.WriteByte(' ')
+				}
+			case 'h':
+				out.WriteString("\u00a0") // hard space
+			default:
+				out.WriteByte('\\')
+				out.WriteByte(text[i+1])
+			}
+			i += 2
+		default:
+			if !drawing {
+				switch c {
+				case '<':
+					out.WriteString("&lt;")
+				case '>':
+					out.WriteString("&gt;")
+				case '&':
+					out.WriteString("&amp;")
+				default:
+					out.WriteByte(c)
+				}
+			}
+			i++
+		}
+	}
+	applyStyle(assStyle{})
+
+	return tidyVTTMarkup(out.String()), d.cueSettings(align, posX, posY)
+}
+
+// tidyVTTMarkup drops tag pairs that ended up wrapping nothing
+func tidyVTTMarkup(s string) string {
+	for {
+		n := s
+		for _, t := range []string{"b", "i", "u"} {
+			n = strings.ReplaceAll(n, "<"+t+"></"+t+">", "")
+		}
+		if n == s {
+			return s
+		}
+		s = n
+	}
+}
+
+// cueSettings maps numpad alignment and an optional \pos to VTT cue settings
+func (d *assDoc) cueSettings(align int, posX, posY float64) string {
+	var parts []string
+	col := (align - 1) % 3 // 0 left, 1 center, 2 right
+	row := (align - 1) / 3 // 0 bottom, 1 middle, 2 top
+
+	anchor := [...]string{"line-left", "center", "line-right"}[col]
+	lineAnchor := [...]string{"end", "center", "start"}[row]
+
+	if posX >= 0 && posY >= 0 && d.playResX > 0 && d.playResY > 0 {
+		parts = append(parts,
+			fmt.Sprintf("position:%s%%,%s", pct(posX/d.playResX*100), anchor),
+			fmt.Sprintf("line:%s%%,%s", pct(posY/d.playResY*100), lineAnchor),
+		)
+		if col == 0 {
+			parts = append(parts, "align:start")
+		} else if col == 2 {
+			parts = append(parts, "align:end")
+		}
+		return strings.Join(parts, " ")
+	}
+
+	switch row {
+	case 1:
+		parts = append(parts, "line:50%,center")
+	case 2:
+		parts = append(parts, "line:0")
+	}
+	switch col {
+	case 0:
+		parts = append(parts, "position:0%,line-left", "align:start")
+	case 2:
+		parts = append(parts, "position:100%,line-right", "align:end")
+	}
+	return strings.Join(parts, " ")
+}
+
+func pct(v float64) string {
+	if v < 0 {
+		v = 0
+	}
+	if v > 100 {
+		v = 100
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
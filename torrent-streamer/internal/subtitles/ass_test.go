@@ -0,0 +1,193 @@
+package subtitles
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 1920
+PlayResY: 1080
+%WRAP%
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,52,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,1,2,10,10,10,1
+Style: Sign,Arial,40,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,-1,0,0,0,100,100,0,0,1,2,1,8,10,10,10,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func assScript(wrap string, events ...string) string {
+	return strings.Replace(assHeader, "%WRAP%", wrap, 1) + strings.Join(events, "\n") + "\n"
+}
+
+func TestASSEventText(t *testing.T) {
+	tests := []struct {
+		name     string
+		wrap     string
+		event    string
+		text     string
+		settings string
+	}{
+		{
+			name:  "plain",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Hello there`,
+			text:  "Hello there",
+		},
+		{
+			name:  "override blocks become markup",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\i1}Hello{\i0} {\b1\fs40\c&H00FF00&}world{\b0}`,
+			text:  "<i>Hello</i> <b>world</b>",
+		},
+		{
+			name:  "font weight counts as bold",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\b700}Loud{\b400} quiet`,
+			text:  "<b>Loud</b> quiet",
+		},
+		{
+			name:  "unclosed override block drops the rest",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Kept{\i1 dropped`,
+			text:  "Kept",
+		},
+		{
+			name:  "commas in text",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Well, well, well`,
+			text:  "Well, well, well",
+		},
+		{
+			name:  `\N is a hard break`,
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,One\NTwo`,
+			text:  "One\nTwo",
+		},
+		{
+			name:  `\n is a space by default`,
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,One\nTwo`,
+			text:  "One Two",
+		},
+		{
+			name:  `\n breaks with WrapStyle 2`,
+			wrap:  "WrapStyle: 2",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,One\nTwo`,
+			text:  "One\nTwo",
+		},
+		{
+			name:  `\h is a hard space`,
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Mr.\hSmith`,
+			text:  "Mr.\u00a0Smith",
+		},
+		{
+			name:  "markup characters are escaped",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,a < b & c`,
+			text:  "a &lt; b &amp; c",
+		},
+		{
+			name:     `\an8 goes to the top`,
+			event:    `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\an8}Top`,
+			text:     "Top",
+			settings: "line:0",
+		},
+		{
+			name:     `\an7 goes to the top left`,
+			event:    `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\an7}Corner`,
+			text:     "Corner",
+			settings: "line:0 position:0%,line-left align:start",
+		},
+		{
+			name:     "style alignment and bold",
+			event:    `Dialogue: 0,0:00:01.00,0:00:02.00,Sign,,0,0,0,,Sign text`,
+			text:     "<b>Sign text</b>",
+			settings: "line:0",
+		},
+		{
+			name:     `\pos maps to percentages of PlayRes`,
+			event:    `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\an5\pos(960,540)}Center`,
+			text:     "Center",
+			settings: "position:50%,center line:50%,center",
+		},
+		{
+			name:     `\move uses its start point`,
+			event:    `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\an1\move(192,1080,960,540)}Moving`,
+			text:     "Moving",
+			settings: "position:10%,line-left line:100%,end align:start",
+		},
+		{
+			name:  "drawings are dropped",
+			event: `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\p1}m 0 0 l 100 0 100 100{\p0}Text`,
+			text:  "Text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, events := parseASS(assScript(tt.wrap, tt.event))
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			c, ok := doc.eventCue(events[0])
+			if !ok {
+				t.Fatalf("event dropped")
+			}
+			if c.Text != tt.text {
+				t.Errorf("text = %q, want %q", c.Text, tt.text)
+			}
+			if c.Settings != tt.settings {
+				t.Errorf("settings = %q, want %q", c.Settings, tt.settings)
+			}
+		})
+	}
+}
+
+func TestASSToVTTSkipsComments(t *testing.T) {
+	vtt := ASSToVTT(assScript("",
+		`Comment: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Translator note`,
+		`Dialogue: 0,0:00:03.50,0:00:04.25,Default,,0,0,0,,Spoken`,
+	))
+	if strings.Contains(vtt, "Translator note") {
+		t.Errorf("comment line rendered:\n%s", vtt)
+	}
+	if !strings.Contains(vtt, "00:00:03.500 --> 00:00:04.250\nSpoken") {
+		t.Errorf("dialogue missing:\n%s", vtt)
+	}
+}
+
+func TestASSMissingFormatLine(t *testing.T) {
+	// no [V4+ Styles] and no [Events] Format: the default event layout applies
+	script := "[Script Info]\nTitle: x\n\n[Events]\n" +
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,First, with a comma\n"
+	doc, events := parseASS(script)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	c, ok := doc.eventCue(events[0])
+	if !ok {
+		t.Fatal("event dropped")
+	}
+	if c.Start != time.Second || c.End != 2*time.Second {
+		t.Errorf("times = %v-%v, want 1s-2s", c.Start, c.End)
+	}
+	if c.Text != "First, with a comma" {
+		t.Errorf("text = %q", c.Text)
+	}
+}
+
+func TestParseASSTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"0:00:01.00", time.Second, true},
+		{"1:02:03.45", time.Hour + 2*time.Minute + 3*time.Second + 450*time.Millisecond, true},
+		{"0:00:01.5", time.Second + 500*time.Millisecond, true},
+		{"garbage", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseASSTime(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parseASSTime(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package subtitles
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Choice identifies one subtitle of an episode: a file in the torrent
+// ("torrent", Ref = file index), a track muxed into the video ("embedded",
+// Ref = track number) or a provider result (Source = provider, Ref = id)
+type Choice struct {
+	Source   string `json:"source"`
+	Ref      string `json:"ref"`
+	Lang     string `json:"lang"`
+	InfoHash string `json:"infoHash,omitempty"` // torrent the ref belongs to (torrent/embedded)
+}
+
+// ChoiceStore remembers which subtitle each subject picked per episode
+type ChoiceStore struct{ DB *sql.DB }
+
+func NewChoiceStore(db *sql.DB) *ChoiceStore { return &ChoiceStore{DB: db} }
+
+func (s *ChoiceStore) GetChoice(ctx context.Context, subjectID, seriesID string, season, episode int) (Choice, bool, error) {
+	var c Choice
+	err := s.DB.QueryRowContext(ctx, `
+SELECT source, ref, lang, infohash FROM subtitle_choices
+WHERE subject_id=$1 AND series_id=$2 AND season=$3 AND episode=$4`,
+		subjectID, seriesID, season, episode).Scan(&c.Source, &c.Ref, &c.Lang, &c.InfoHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Choice{}, false, nil
+		}
+		return Choice{}, false, err
+	}
+	return c, true, nil
+}
+
+func (s *ChoiceStore) SaveChoice(ctx context.Context, subjectID, seriesID string, season, episode int, c Choice) error {
+	_, err := s.DB.ExecContext(ctx, `
+INSERT INTO subtitle_choices (subject_id, series_id, season, episode, source, ref, lang, infohash, created_at, updated_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8, now(), now())
+ON CONFLICT (subject_id, series_id, season, episode) DO UPDATE
+SET source=EXCLUDED.source, ref=EXCLUDED.ref, lang=EXCLUDED.lang, infohash=EXCLUDED.infohash, updated_at=now()`,
+		subjectID, seriesID, season, episode, c.Source, c.Ref, c.Lang, c.InfoHash)
+	return err
+}
+
+// RecentLangs returns the languages the subject chose for a series, most
+// recent first; the fallback preference when none is given
+func (s *ChoiceStore) RecentLangs(ctx context.Context, subjectID, seriesID string) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT lang FROM subtitle_choices
+WHERE subject_id=$1 AND series_id=$2 AND lang <> ''
+GROUP BY lang ORDER BY max(updated_at) DESC LIMIT 3`, subjectID, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var l string
+		if err := rows.Scan(&l); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,315 @@
+package subtitles
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiskCache stores converted VTT documents under a directory, one file per
+// key (provider:id[|transform]). Entries are evicted least-recently-used once
+// the total size exceeds maxBytes, and dropped after ttl by the sweeper.
+// The index is rebuilt from the directory on start, so the cache survives
+// restarts and spares the quota-limited providers.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*diskEntry // file name -> entry
+	size    int64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type diskEntry struct {
+	name    string
+	size    int64
+	used    time.Time // last access; persisted as the file mtime
+	fetched time.Time // when the content was stored; persisted in the header
+}
+
+// CacheStats is a snapshot of the subtitle cache counters
+type CacheStats struct {
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"maxBytes"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+}
+
+var cache *DiskCache
+
+// InitCache opens (or creates) the subtitle cache in dir and makes it the
+// package cache used by downloads and retiming. Without it nothing is cached.
+func InitCache(dir string, maxBytes int64, ttl time.Duration) error {
+	c, err := OpenDiskCache(dir, maxBytes, ttl)
+	if err != nil {
+		return err
+	}
+	cache = c
+	return nil
+}
+
+// OpenDiskCache indexes the files already in dir
+func OpenDiskCache(dir string, maxBytes int64, ttl time.Duration) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{dir: dir, maxBytes: maxBytes, ttl: ttl, entries: map[string]*diskEntry{}}
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, de := range des {
+		if strings.HasSuffix(de.Name(), ".tmp") {
+			_ = os.Remove(filepath.Join(dir, de.Name())) // interrupted write
+			continue
+		}
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".vtt") {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		fetched := fi.ModTime()
+		if _, ts, err := readCacheHeader(filepath.Join(dir, de.Name())); err == nil && !ts.IsZero() {
+			fetched = ts
+		}
+		c.entries[de.Name()] = &diskEntry{name: de.Name(), size: fi.Size(), used: fi.ModTime(), fetched: fetched}
+		c.size += fi.Size()
+	}
+	c.Sweep()
+	log.Printf("[subtitles] cache %s: %d entries, %d bytes", dir, len(c.entries), c.size)
+	return c, nil
+}
+
+func cacheFileName(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".vtt"
+}
+
+// Get returns the cached VTT and source encoding for key
+func (c *DiskCache) Get(key string) (vtt, encoding string, ok bool) {
+	name := cacheFileName(key)
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	if ok && c.ttl > 0 && time.Since(e.fetched) > c.ttl {
+		c.removeLocked(e)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.misses.Add(1)
+		return "", "", false
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		// a Put may have replaced the entry meanwhile; only this one is dropped
+		c.mu.Lock()
+		c.removeLocked(e)
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return "", "", false
+	}
+	header, body, _ := strings.Cut(string(data), "\n")
+	if encoding, _, _ = strings.Cut(header, " "); encoding == "-" {
+		encoding = ""
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	e.used = now
+	c.mu.Unlock()
+	_ = os.Chtimes(filepath.Join(c.dir, name), now, now)
+	c.hits.Add(1)
+	return body, encoding, true
+}
+
+// Peek returns the source encoding for key without counting a hit or miss
+func (c *DiskCache) Peek(key string) (encoding string, ok bool) {
+	name := cacheFileName(key)
+	c.mu.Lock()
+	_, ok = c.entries[name]
+	c.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	encoding, _, err := readCacheHeader(filepath.Join(c.dir, name))
+	return encoding, err == nil
+}
+
+// Put stores vtt under key, evicting least-recently-used entries over the cap
+func (c *DiskCache) Put(key, vtt, encoding string) {
+	name := cacheFileName(key)
+	now := time.Now()
+	if encoding == "" {
+		encoding = "-"
+	}
+	data := encoding + " " + now.UTC().Format(time.RFC3339) + "\n" + vtt
+
+	// write-then-rename so readers never see a partial file; a temp file of
+	// its own per writer so concurrent Puts of one key don't interleave
+	f, err := os.CreateTemp(c.dir, name+".*.tmp")
+	if err != nil {
+		log.Printf("[subtitles] cache write %s: %v", key, err)
+		return
+	}
+	tmp := f.Name()
+	_ = f.Chmod(0o644)
+	_, err = f.WriteString(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		log.Printf("[subtitles] cache write %s: %v", key, err)
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		log.Printf("[subtitles] cache write %s: %v", key, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[name]; ok {
+		c.size -= old.size
+	}
+	c.entries[name] = &diskEntry{name: name, size: int64(len(data)), used: now, fetched: now}
+	c.size += int64(len(data))
+	c.evictLocked()
+}
+
+// Sweep drops expired entries and enforces the size cap
+func (c *DiskCache) Sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl > 0 {
+		for _, e := range c.entries {
+			if time.Since(e.fetched) > c.ttl {
+				c.removeLocked(e)
+			}
+		}
+	}
+	c.evictLocked()
+}
+
+// Stats returns the current counters
+func (c *DiskCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Entries:  len(c.entries),
+		Bytes:    c.size,
+		MaxBytes: c.maxBytes,
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+	}
+}
+
+func (c *DiskCache) evictLocked() {
+	if c.maxBytes <= 0 || c.size <= c.maxBytes {
+		return
+	}
+	lru := make([]*diskEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		lru = append(lru, e)
+	}
+	sort.Slice(lru, func(i, j int) bool { return lru[i].used.Before(lru[j].used) })
+	for _, e := range lru {
+		if c.size <= c.maxBytes {
+			break
+		}
+		c.removeLocked(e)
+	}
+}
+
+func (c *DiskCache) removeLocked(e *diskEntry) {
+	if cur, ok := c.entries[e.name]; !ok || cur != e {
+		return // already gone, or replaced by a newer entry under the same name
+	}
+	_ = os.Remove(filepath.Join(c.dir, e.name))
+	delete(c.entries, e.name)
+	c.size -= e.size
+}
+
+// readCacheHeader reads the "<encoding> <stored-at>" first line of a cache file
+func readCacheHeader(path string) (string, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	enc, ts, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if enc == "-" {
+		enc = ""
+	}
+	t, _ := time.Parse(time.RFC3339, ts)
+	return enc, t, nil
+}
+
+// RunCacheSweeper sweeps the package cache every interval until ctx is done
+func RunCacheSweeper(ctx context.Context, every time.Duration) {
+	if cache == nil || every <= 0 {
+		return
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			cache.Sweep()
+		}
+	}
+}
+
+// GetCacheStats returns the package cache counters (zero if disabled)
+func GetCacheStats() CacheStats {
+	if cache == nil {
+		return CacheStats{}
+	}
+	return cache.Stats()
+}
+
+// GetCachedVTT returns the VTT stored under key by PutCachedVTT
+func GetCachedVTT(key string) (string, bool) {
+	vtt, _, ok := cacheGet(key)
+	return vtt, ok
+}
+
+// PutCachedVTT stores a converted subtitle under key
+func PutCachedVTT(key, vtt, encoding string) { cachePut(key, vtt, encoding) }
+
+func cacheGet(key string) (string, string, bool) {
+	if cache == nil {
+		return "", "", false
+	}
+	return cache.Get(key)
+}
+
+func cachePut(key, vtt, encoding string) {
+	if cache != nil {
+		cache.Put(key, vtt, encoding)
+	}
+}
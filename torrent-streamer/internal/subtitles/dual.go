@@ -0,0 +1,174 @@
+package subtitles
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ParseVTT reads the cues of a WebVTT document (as produced by ToVTT);
+// header, NOTE, STYLE and REGION blocks are skipped
+func ParseVTT(vtt string) []Cue {
+	var cues []Cue
+	for _, block := range strings.Split(strings.ReplaceAll(vtt, "\r\n", "\n"), "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, line := range lines {
+			m := vttTimingRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			start, err1 := parseVTTTime(m[1])
+			end, err2 := parseVTTTime(m[2])
+			if err1 == nil && err2 == nil {
+				cues = append(cues, Cue{
+					Start:    start,
+					End:      end,
+					Text:     strings.Join(lines[i+1:], "\n"),
+					Settings: strings.TrimSpace(m[3]),
+				})
+			}
+			break
+		}
+	}
+	return cues
+}
+
+// Dual layouts for the secondary language
+const (
+	DualBelow = "below" // same cue, under the primary text
+	DualAbove = "above" // same cue, over the primary text
+	DualTop   = "top"   // own cue at the top of the frame
+)
+
+// DualOptions controls how MergeDual places the secondary track
+type DualOptions struct {
+	Layout string // DualBelow (default), DualAbove or DualTop
+	Line   int    // DualTop: line position in percent from the top (default 5)
+}
+
+// minOverlap is the share of the shorter cue two cues must overlap by to be
+// considered the same line of dialogue
+const minOverlap = 0.3
+
+// MergeDual aligns secondary cues to primary ones by time overlap and returns
+// a single cue list showing both languages. Each secondary cue joins the
+// primary cue it overlaps most; when stacked, the pair shares the primary
+// timing and the secondary text is wrapped in <c.secondary> for styling (see
+// WriteDualVTT). Secondary cues that overlap nothing are kept at their own
+// times, placed where the nearest primary cue sits so they don't jump around.
+func MergeDual(primary, secondary []Cue, opt DualOptions) []Cue {
+	prim := sortedCues(primary)
+	sec := sortedCues(secondary)
+
+	matched := make([][]int, len(prim)) // primary index -> secondary indexes
+	var orphans []Cue
+	j0 := 0
+	for si, s := range sec {
+		best, bestOv := -1, time.Duration(0)
+		// primary cues ending before s starts can't match this or later cues
+		for j0 < len(prim) && prim[j0].End <= s.Start {
+			j0++
+		}
+		for pi := j0; pi < len(prim) && prim[pi].Start < s.End; pi++ {
+			if ov := overlap(prim[pi], s); ov > bestOv {
+				best, bestOv = pi, ov
+			}
+		}
+		if best >= 0 && float64(bestOv) >= minOverlap*float64(min(cueLen(prim[best]), cueLen(s))) {
+			matched[best] = append(matched[best], si)
+		} else {
+			orphans = append(orphans, s)
+		}
+	}
+
+	secText := func(c Cue) string { return "<c.secondary>" + strings.TrimSpace(c.Text) + "</c>" }
+	topSettings := func() string {
+		line := opt.Line
+		if line <= 0 || line > 100 {
+			line = 5
+		}
+		return fmt.Sprintf("line:%d%% position:50%% align:center", line)
+	}
+
+	out := make([]Cue, 0, len(prim)+len(sec))
+	for pi, p := range prim {
+		if opt.Layout == DualTop {
+			out = append(out, p)
+			// snap to the primary cue so both lines appear and clear together
+			if len(matched[pi]) > 0 {
+				var texts []string
+				for _, si := range matched[pi] {
+					texts = append(texts, secText(sec[si]))
+				}
+				out = append(out, Cue{Start: p.Start, End: p.End, Text: strings.Join(texts, "\n"), Settings: topSettings()})
+			}
+			continue
+		}
+		var texts []string
+		for _, si := range matched[pi] {
+			texts = append(texts, secText(sec[si]))
+		}
+		if opt.Layout == DualAbove {
+			texts = append(texts, strings.TrimSpace(p.Text))
+		} else {
+			texts = append([]string{strings.TrimSpace(p.Text)}, texts...)
+		}
+		p.Text = strings.Join(texts, "\n")
+		out = append(out, p)
+	}
+	for _, s := range orphans {
+		s.Text = secText(s)
+		if opt.Layout == DualTop {
+			s.Settings = topSettings()
+		} else {
+			s.Settings = nearestSettings(prim, s)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// dualStyle sets the secondary language apart from the primary one
+const dualStyle = "STYLE\n::cue(.secondary) {\n  color: #ffe680;\n  font-size: 85%;\n}"
+
+// WriteDualVTT renders MergeDual output with a STYLE block for the
+// <c.secondary> spans
+func WriteDualVTT(cues []Cue) string {
+	return strings.Replace(WriteVTT(cues), "WEBVTT\n\n", "WEBVTT\n\n"+dualStyle+"\n\n", 1)
+}
+
+// nearestSettings returns the cue settings of the primary cue closest in
+// time to c; without any primary cues it is the default placement
+func nearestSettings(prim []Cue, c Cue) string {
+	settings, best := "", time.Duration(-1)
+	for _, p := range prim {
+		gap := max(0, p.Start-c.End, c.Start-p.End)
+		if best < 0 || gap < best {
+			settings, best = p.Settings, gap
+		}
+	}
+	return settings
+}
+
+func sortedCues(cues []Cue) []Cue {
+	out := make([]Cue, 0, len(cues))
+	for _, c := range cues {
+		if strings.TrimSpace(c.Text) != "" {
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+func cueLen(c Cue) time.Duration {
+	if c.End > c.Start {
+		return c.End - c.Start
+	}
+	return 0
+}
+
+func overlap(a, b Cue) time.Duration {
+	return max(0, min(a.End, b.End)-max(a.Start, b.Start))
+}
@@ -0,0 +1,54 @@
+package subtitles
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeDualOrphanPlacement(t *testing.T) {
+	sec := func(s int) time.Duration { return time.Duration(s) * time.Second }
+	primary := []Cue{
+		{Start: sec(1), End: sec(3), Text: "Hello", Settings: "line:80%"},
+		{Start: sec(10), End: sec(12), Text: "Bye", Settings: "line:90%"},
+	}
+	secondary := []Cue{
+		{Start: sec(1), End: sec(3), Text: "Hallo"},
+		{Start: sec(13), End: sec(14), Text: "Tschüss", Settings: "line:0"},
+	}
+
+	tests := []struct {
+		layout         string
+		mergedText     string
+		orphanSettings string
+	}{
+		{DualBelow, "Hello\n<c.secondary>Hallo</c>", "line:90%"},
+		{DualAbove, "<c.secondary>Hallo</c>\nHello", "line:90%"},
+		{DualTop, "Hello", "line:5% position:50% align:center"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			out := MergeDual(primary, secondary, DualOptions{Layout: tt.layout})
+			if out[0].Text != tt.mergedText || out[0].Settings != "line:80%" {
+				t.Errorf("merged cue = %+v", out[0])
+			}
+			orphan := out[len(out)-1]
+			if orphan.Start != sec(13) || orphan.Text != "<c.secondary>Tschüss</c>" {
+				t.Fatalf("orphan cue = %+v", orphan)
+			}
+			if orphan.Settings != tt.orphanSettings {
+				t.Errorf("orphan settings = %q, want %q", orphan.Settings, tt.orphanSettings)
+			}
+		})
+	}
+}
+
+func TestWriteDualVTTStyle(t *testing.T) {
+	vtt := WriteDualVTT([]Cue{{Start: time.Second, End: 2 * time.Second, Text: "<c.secondary>Hallo</c>"}})
+	if !strings.HasPrefix(vtt, "WEBVTT\n\nSTYLE\n::cue(.secondary) {") {
+		t.Errorf("missing style block:\n%s", vtt)
+	}
+	if cues := ParseVTT(vtt); len(cues) != 1 || cues[0].Text != "<c.secondary>Hallo</c>" {
+		t.Errorf("cues = %+v", cues)
+	}
+}
@@ -0,0 +1,252 @@
+package subtitles
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// Encoding names reported to clients (WHATWG labels)
+const (
+	EncUTF8     = "utf-8"
+	EncUTF16LE  = "utf-16le"
+	EncUTF16BE  = "utf-16be"
+	EncWin1250  = "windows-1250"
+	EncWin1251  = "windows-1251"
+	EncWin1252  = "windows-1252"
+	EncWin1253  = "windows-1253"
+	EncWin1254  = "windows-1254"
+	EncWin1255  = "windows-1255"
+	EncWin1256  = "windows-1256"
+	EncWin1258  = "windows-1258"
+	EncWin874   = "windows-874"
+	EncGBK      = "gbk"
+	EncBig5     = "big5"
+	EncShiftJIS = "shift_jis"
+	EncEUCKR    = "euc-kr"
+)
+
+var decoders = map[string]encoding.Encoding{
+	EncUTF16LE:  xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM),
+	EncUTF16BE:  xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM),
+	EncWin1250:  charmap.Windows1250,
+	EncWin1251:  charmap.Windows1251,
+	EncWin1252:  charmap.Windows1252,
+	EncWin1253:  charmap.Windows1253,
+	EncWin1254:  charmap.Windows1254,
+	EncWin1255:  charmap.Windows1255,
+	EncWin1256:  charmap.Windows1256,
+	EncWin1258:  charmap.Windows1258,
+	EncWin874:   charmap.Windows874,
+	EncGBK:      simplifiedchinese.GBK,
+	EncBig5:     traditionalchinese.Big5,
+	EncShiftJIS: japanese.ShiftJIS,
+	EncEUCKR:    korean.EUCKR,
+}
+
+// legacy code page usually used for subtitles in a given language
+var langEncoding = map[string]string{
+	"ar": EncWin1256, "fa": EncWin1256, "ur": EncWin1256,
+	"ru": EncWin1251, "uk": EncWin1251, "bg": EncWin1251, "sr": EncWin1251, "mk": EncWin1251, "be": EncWin1251,
+	"pl": EncWin1250, "cs": EncWin1250, "sk": EncWin1250, "hu": EncWin1250, "ro": EncWin1250, "hr": EncWin1250, "sl": EncWin1250,
+	"el": EncWin1253,
+	"tr": EncWin1254,
+	"he": EncWin1255,
+	"vi": EncWin1258,
+	"th": EncWin874,
+	"zh": EncGBK,
+	"ja": EncShiftJIS,
+	"ko": EncEUCKR,
+}
+
+// DecodeSubtitle sniffs the character encoding of raw subtitle bytes and
+// returns the text as UTF-8 together with the detected encoding name.
+// langHint is an ISO 639-1 code ("" or "und" when unknown).
+func DecodeSubtitle(data []byte, langHint string) (string, string) {
+	enc := DetectEncoding(data, langHint)
+	switch enc {
+	case EncUTF8:
+		return strings.TrimPrefix(string(data), "\ufeff"), enc
+	case EncUTF16LE, EncUTF16BE:
+		data = bytes.TrimPrefix(bytes.TrimPrefix(data, []byte{0xFF, 0xFE}), []byte{0xFE, 0xFF})
+	}
+	out, err := decoders[enc].NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "\ufffd"), EncUTF8
+	}
+	return strings.TrimPrefix(string(out), "\ufeff"), enc
+}
+
+// DetectEncoding guesses the encoding of data: BOM first, then UTF-16 and
+// UTF-8 validity, then the language's legacy code page, then byte statistics.
+func DetectEncoding(data []byte, langHint string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return EncUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return EncUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return EncUTF16BE
+	}
+
+	sample := data
+	if len(sample) > 64<<10 {
+		sample = sample[:64<<10]
+		// cut at a line break so double-byte characters stay whole
+		if i := bytes.LastIndexByte(sample, '\n'); i > 0 {
+			sample = sample[:i]
+		}
+	}
+	if enc, ok := sniffUTF16(sample); ok {
+		return enc
+	}
+	if utf8.Valid(trimPartialRune(sample)) {
+		return EncUTF8
+	}
+
+	lang := NormalizeLang(langHint)
+	if enc, ok := langEncoding[lang]; ok && decodesCleanly(decoders[enc], sample) {
+		return enc
+	}
+	return guessLegacy(sample)
+}
+
+// sniffUTF16 detects BOM-less UTF-16 from the NUL bytes of ASCII characters
+func sniffUTF16(b []byte) (string, bool) {
+	if len(b) < 16 {
+		return "", false
+	}
+	var even, odd int
+	for i, c := range b {
+		if c == 0 {
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	half := len(b) / 2
+	switch {
+	case odd > half*4/10 && even < half/20:
+		return EncUTF16LE, true
+	case even > half*4/10 && odd < half/20:
+		return EncUTF16BE, true
+	}
+	return "", false
+}
+
+// trimPartialRune drops a multi-byte sequence cut off by sampling
+func trimPartialRune(b []byte) []byte {
+	for i := 0; i < 3 && len(b) > 0; i++ {
+		r, _ := utf8.DecodeLastRune(b)
+		if r != utf8.RuneError {
+			break
+		}
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// decodesCleanly reports whether enc decodes b with (almost) no replacement chars
+func decodesCleanly(enc encoding.Encoding, b []byte) bool {
+	s, err := enc.NewDecoder().String(string(b))
+	if err != nil {
+		return false
+	}
+	bad := strings.Count(s, "\ufffd")
+	return bad*200 <= utf8.RuneCountInString(s)
+}
+
+// guessLegacy picks a legacy code page for non-UTF text without a language hint
+func guessLegacy(b []byte) string {
+	var high, letters int
+	for _, c := range b {
+		if c >= 0x80 {
+			high++
+		}
+		if c >= 0x80 || (c|0x20 >= 'a' && c|0x20 <= 'z') {
+			letters++
+		}
+	}
+	// Western text only has the odd accented letter
+	if letters == 0 || high*10 < letters {
+		return EncWin1252
+	}
+
+	// Double-byte scripts: the decode must be clean and dominated by the script
+	if s, ok := cleanDecode(japanese.ShiftJIS, b); ok && scriptRatio(s, isKana) >= 0.15 {
+		return EncShiftJIS
+	}
+	if s, ok := cleanDecode(korean.EUCKR, b); ok && scriptRatio(s, isHangul) >= 0.7 {
+		return EncEUCKR
+	}
+	if s, ok := cleanDecode(simplifiedchinese.GBK, b); ok && scriptRatio(s, isHan) >= 0.6 {
+		return EncGBK
+	}
+	if s, ok := cleanDecode(traditionalchinese.Big5, b); ok && scriptRatio(s, isHan) >= 0.6 {
+		return EncBig5
+	}
+
+	// Single-byte: both code pages map every high byte to a letter, so compare
+	// how much of the text falls on each language's most frequent letters
+	ru := commonLetterRatio(charmap.Windows1251, b, "оеаинтсрвл")
+	ar := commonLetterRatio(charmap.Windows1256, b, "اليمونهرتب")
+	switch {
+	case ru >= 0.35 && ru >= ar:
+		return EncWin1251
+	case ar >= 0.35:
+		return EncWin1256
+	}
+	return EncWin1252
+}
+
+func cleanDecode(enc encoding.Encoding, b []byte) (string, bool) {
+	s, err := enc.NewDecoder().String(string(b))
+	if err != nil || strings.Contains(s, "\ufffd") {
+		return "", false
+	}
+	return s, true
+}
+
+// scriptRatio is the share of non-ASCII runes in s that satisfy in
+func scriptRatio(s string, in func(rune) bool) float64 {
+	var total, hit int
+	for _, r := range s {
+		if r < 0x80 {
+			continue
+		}
+		total++
+		if in(r) {
+			hit++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(hit) / float64(total)
+}
+
+func commonLetterRatio(enc encoding.Encoding, b []byte, common string) float64 {
+	s, err := enc.NewDecoder().String(string(b))
+	if err != nil {
+		return 0
+	}
+	s = strings.ToLower(s)
+	return scriptRatio(s, func(r rune) bool { return unicode.IsLetter(r) && strings.ContainsRune(common, r) })
+}
+
+func isKana(r rune) bool   { return r >= 0x3040 && r <= 0x30FF }
+func isHangul(r rune) bool { return unicode.Is(unicode.Hangul, r) }
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r) || (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
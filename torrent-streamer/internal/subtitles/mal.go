@@ -0,0 +1,81 @@
+package subtitles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const jikanAPI = "https://api.jikan.moe/v4"
+
+// MALTitles resolves MyAnimeList ids to titles through the Jikan API. No
+// provider searches by MAL id, so anime known only by it is searched by name.
+type MALTitles struct {
+	APIURL string // "" = public API
+	HTTP   *http.Client
+
+	mu     sync.Mutex
+	titles map[string]string
+}
+
+// Title returns the English title of anime id, or its romaji title when it
+// has none. Lookups are remembered for the life of the process.
+func (m *MALTitles) Title(ctx context.Context, id string) (string, error) {
+	m.mu.Lock()
+	if t, ok := m.titles[id]; ok {
+		m.mu.Unlock()
+		return t, nil
+	}
+	m.mu.Unlock()
+
+	base := strings.TrimRight(m.APIURL, "/")
+	if base == "" {
+		base = jikanAPI
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", base+"/anime/"+url.PathEscape(id), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
+	client := m.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("jikan request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("jikan returned status %d", resp.StatusCode)
+	}
+	var res struct {
+		Data struct {
+			Title        string `json:"title"`
+			TitleEnglish string `json:"title_english"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("failed to decode jikan response: %w", err)
+	}
+	title := res.Data.TitleEnglish
+	if title == "" {
+		title = res.Data.Title
+	}
+	if title == "" {
+		return "", fmt.Errorf("no title for MAL id %s", id)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.titles == nil {
+		m.titles = map[string]string{}
+	}
+	m.titles[id] = title
+	return title, nil
+}
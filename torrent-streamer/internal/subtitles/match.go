@@ -0,0 +1,118 @@
+package subtitles
+
+import (
+	"regexp"
+	"strings"
+
+	"torrent-streamer/internal/releaseparse"
+)
+
+var reTokens = regexp.MustCompile(`[A-Za-z0-9]+`)
+
+// episodeTag is what a file or release name says about its episode
+type episodeTag struct {
+	season, episode int // 0 = not stated
+	abs             int // anime absolute number
+}
+
+// parseEpisodeTag reads S01E02 / 1x02 / "Title - 05" style markers
+func parseEpisodeTag(name string) episodeTag {
+	rel := releaseparse.Parse(name)
+	return episodeTag{season: rel.Season, episode: rel.Episode, abs: rel.AbsEpisode}
+}
+
+// releaseGroup extracts "NTb" from "Show.S01E01.1080p.WEB-DL-NTb" or
+// "SubsPlease" from "[SubsPlease] Show - 01"
+func releaseGroup(name string) string { return releaseparse.Parse(name).Group }
+
+// titleFromRelease guesses the show title from a release name, used as a
+// text query when no database id is known (typical for anime)
+func titleFromRelease(name string) string { return releaseparse.Parse(name).Title }
+
+// release tokens worth comparing between a subtitle and the video file
+var releaseTokens = map[string]bool{
+	"web": true, "webdl": true, "webrip": true, "bluray": true, "bdrip": true, "brrip": true,
+	"hdtv": true, "remux": true, "dvdrip": true, "amzn": true, "nf": true, "dsnp": true,
+	"hmax": true, "atvp": true, "hulu": true, "cr": true, "2160p": true, "1080p": true,
+	"720p": true, "480p": true, "x264": true, "x265": true, "hevc": true, "h264": true,
+	"proper": true, "repack": true, "extended": true,
+}
+
+func tokenSet(name string) map[string]bool {
+	set := map[string]bool{}
+	lower := strings.ToLower(strings.ReplaceAll(name, "web-dl", "webdl"))
+	for _, t := range reTokens.FindAllString(lower, -1) {
+		if releaseTokens[t] {
+			set[t] = true
+		}
+	}
+	return set
+}
+
+// matchScore rates how well a subtitle fits the query in [0,1] and reports
+// whether it is for a different episode altogether
+func matchScore(s SubResult, q Query) (score float64, reject bool) {
+	if s.HashMatch {
+		return 1, false
+	}
+	name := s.FileName
+	if name == "" {
+		name = s.Label
+	}
+	tag := parseEpisodeTag(name)
+	if s.Season > 0 && tag.season == 0 {
+		tag.season = s.Season
+	}
+	if s.Episode > 0 && tag.episode == 0 {
+		tag.episode = s.Episode
+	}
+
+	// episode fit: exact 0.5, season pack or unstated 0.2, wrong episode rejected
+	switch {
+	case q.Episode > 0 && tag.episode > 0:
+		if tag.episode != q.Episode || (q.Season > 0 && tag.season > 0 && tag.season != q.Season) {
+			return 0, true
+		}
+		score += 0.5
+	case q.AbsEpisode > 0 && tag.abs > 0:
+		if tag.abs != q.AbsEpisode {
+			return 0, true
+		}
+		score += 0.5
+	case q.Episode > 0 && tag.abs > 0:
+		if tag.abs != q.Episode {
+			return 0, true
+		}
+		score += 0.4
+	case q.AbsEpisode > 0 && tag.episode > 0:
+		// only meaningful for first seasons, where both numberings agree
+		if tag.episode == q.AbsEpisode && tag.season <= 1 {
+			score += 0.4
+		} else {
+			score += 0.1
+		}
+	case q.Season > 0 && tag.season > 0 && tag.season != q.Season:
+		return 0, true
+	case q.Episode > 0 || q.AbsEpisode > 0:
+		score += 0.2
+	}
+
+	if q.ReleaseName == "" {
+		return score, false
+	}
+	// same release group usually means the same cut and timing
+	if g := releaseGroup(q.ReleaseName); g != "" && strings.EqualFold(g, releaseGroup(name)) {
+		score += 0.3
+	}
+	want, have := tokenSet(q.ReleaseName), tokenSet(name)
+	if len(want) > 0 {
+		var common int
+		for t := range want {
+			if have[t] {
+				common++
+			}
+		}
+		score += 0.2 * float64(common) / float64(len(want))
+	}
+	return score, false
+}
@@ -0,0 +1,870 @@
+package subtitles
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Matroska element IDs we care about
+const (
+	mkvEBML          = 0x1A45DFA3
+	mkvSegment       = 0x18538067
+	mkvSeekHead      = 0x114D9B74
+	mkvSeek          = 0x4DBB
+	mkvSeekID        = 0x53AB
+	mkvSeekPosition  = 0x53AC
+	mkvInfo          = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvTracks        = 0x1654AE6B
+	mkvTrackEntry    = 0xAE
+	mkvTrackNumber   = 0xD7
+	mkvTrackType     = 0x83
+	mkvCodecID       = 0x86
+	mkvCodecPrivate  = 0x63A2
+	mkvLanguage      = 0x22B59C
+	mkvLanguageBCP   = 0x22B59D
+	mkvName          = 0x536E
+	mkvFlagDefault   = 0x88
+	mkvFlagForced    = 0x55AA
+	mkvContentEncs   = 0x6D80
+	mkvContentEnc    = 0x6240
+	mkvContentComp   = 0x5034
+	mkvCompAlgo      = 0x4254
+	mkvCompSettings  = 0x4255
+	mkvCues          = 0x1C53BB6B
+	mkvCuePoint      = 0xBB
+	mkvCueTrackPos   = 0xB7
+	mkvCueTrack      = 0xF7
+	mkvCueClusterPos = 0xF1
+	mkvCueRelPos     = 0xF0
+	mkvCluster       = 0x1F43B675
+	mkvTimecode      = 0xE7
+	mkvSimpleBlock   = 0xA3
+	mkvBlockGroup    = 0xA0
+	mkvBlock         = 0xA1
+	mkvBlockDur      = 0x9B
+
+	mkvTrackTypeSubtitle = 0x11
+	mkvUnknownSize       = -1
+)
+
+var (
+	ErrNotMKV            = errors.New("not a matroska file")
+	ErrMKVDataMissing    = errors.New("matroska header not downloaded yet")
+	ErrUnsupportedTrack  = errors.New("unsupported subtitle track")
+	supportedMKVSubCodec = map[string]string{
+		"S_TEXT/UTF8":   "srt",
+		"S_TEXT/ASS":    "ass",
+		"S_TEXT/SSA":    "ssa",
+		"S_TEXT/WEBVTT": "vtt",
+	}
+)
+
+// MKVSource is a (possibly partially downloaded) Matroska file
+type MKVSource struct {
+	R    io.ReadSeeker
+	Size int64
+	// Have reports whether [off, off+n) is available locally; nil means everything is
+	Have func(off, n int64) bool
+	// Want is called with byte ranges that are needed but missing (optional)
+	Want func(off, n int64)
+}
+
+// MKVTrack describes a subtitle track inside a Matroska file
+type MKVTrack struct {
+	Number  uint64 `json:"number"`
+	Codec   string `json:"codec"` // e.g. "S_TEXT/ASS"
+	Ext     string `json:"ext"`   // "srt", "ass", "ssa", "vtt" ("" if unsupported)
+	Lang    string `json:"lang"`
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+	Forced  bool   `json:"forced"`
+	URL     string `json:"url,omitempty"` // internal endpoint, filled by the HTTP layer
+
+	private     []byte
+	compAlgo    int // -1 none, 0 zlib, 3 header stripping
+	compSetting []byte
+	ass         *assDoc // script header from CodecPrivate (ASS/SSA only)
+}
+
+// MKVInfo is the parsed segment header of a Matroska file
+type MKVInfo struct {
+	Tracks []MKVTrack
+
+	timecodeScale int64 // ns per tick
+	segmentData   int64 // absolute offset of the segment payload
+	segmentEnd    int64
+	firstCluster  int64
+	cuesPos       int64               // absolute offset of the Cues element, -1 if none
+	cuesLoaded    bool                // cues were read (they often sit at the end of the file)
+	cues          map[uint64][]cueRef // track -> blocks indexed by the cues
+	clusters      []int64             // every cluster offset referenced by cues
+
+	mu   sync.Mutex
+	done map[[2]int64]doneCluster // (track, cluster offset) -> fully decoded cluster
+}
+
+// cueRef locates an indexed block: its cluster and, when the muxer wrote
+// CueRelativePosition, the block's offset inside the cluster payload
+type cueRef struct {
+	cluster int64
+	rel     int64 // -1 = unknown
+}
+
+// doneCluster is what one cluster yielded for a track, kept so that repeated
+// extractions of a partially downloaded file only look at what is new
+type doneCluster struct {
+	cues []Cue
+	next int64
+}
+
+// Track returns the subtitle track with the given number
+func (m *MKVInfo) Track(number uint64) (MKVTrack, bool) {
+	for _, t := range m.Tracks {
+		if t.Number == number {
+			return t, true
+		}
+	}
+	return MKVTrack{}, false
+}
+
+type ebmlReader struct {
+	src MKVSource
+	mu  sync.Mutex
+}
+
+func (r *ebmlReader) have(off, n int64) bool {
+	if off < 0 || n < 0 || off+n > r.src.Size {
+		return false
+	}
+	return r.src.Have == nil || r.src.Have(off, n)
+}
+
+func (r *ebmlReader) want(off, n int64) {
+	if off+n > r.src.Size {
+		n = r.src.Size - off
+	}
+	if r.src.Want != nil && n > 0 {
+		r.src.Want(off, n)
+	}
+}
+
+func (r *ebmlReader) readAt(off, n int64) ([]byte, error) {
+	if !r.have(off, n) {
+		return nil, ErrMKVDataMissing
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.src.R.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.src.R, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// header reads an element header at off (not reading past end) and returns
+// the ID, payload offset and size
+func (r *ebmlReader) header(off, end int64) (id uint64, dataOff, size int64, err error) {
+	n := int64(12)
+	if end > r.src.Size {
+		end = r.src.Size
+	}
+	if off+n > end {
+		n = end - off
+	}
+	if n < 2 {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	b, err := r.readAt(off, n)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	id, idLen, ok := readVintID(b)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("bad element id at %d", off)
+	}
+	size, sizeLen, ok := readVintSize(b[idLen:])
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("bad element size at %d", off)
+	}
+	return id, off + int64(idLen+sizeLen), size, nil
+}
+
+// readVintID reads an element ID, keeping the length marker bits
+func readVintID(b []byte) (uint64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	l := 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		l++
+	}
+	if l > 4 || len(b) < l {
+		return 0, 0, false
+	}
+	var v uint64
+	for i := 0; i < l; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, l, true
+}
+
+// readVintSize reads a data size, stripping the length marker; all-ones means unknown
+func readVintSize(b []byte) (int64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	l := 1
+	mask := byte(0x80)
+	for ; b[0]&mask == 0; mask >>= 1 {
+		l++
+	}
+	if l > 8 || len(b) < l {
+		return 0, 0, false
+	}
+	v := uint64(b[0] & (mask - 1))
+	allOnes := v == uint64(mask-1)
+	for i := 1; i < l; i++ {
+		v = v<<8 | uint64(b[i])
+		allOnes = allOnes && b[i] == 0xFF
+	}
+	if allOnes {
+		return mkvUnknownSize, l, true
+	}
+	return int64(v), l, true
+}
+
+// ebmlChild is one element inside an in-memory master element
+type ebmlChild struct {
+	id   uint64
+	data []byte
+}
+
+func parseChildren(b []byte) []ebmlChild {
+	var out []ebmlChild
+	for len(b) > 0 {
+		id, idLen, ok := readVintID(b)
+		if !ok {
+			break
+		}
+		size, sizeLen, ok := readVintSize(b[idLen:])
+		if !ok || size < 0 {
+			break
+		}
+		start := idLen + sizeLen
+		if int64(len(b)-start) < size {
+			break
+		}
+		out = append(out, ebmlChild{id: id, data: b[start : start+int(size)]})
+		b = b[start+int(size):]
+	}
+	return out
+}
+
+func ebmlUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func ebmlString(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
+
+// ProbeMKV parses the EBML header, segment info, tracks and cues. Only the
+// header region needs to be available; missing cues are requested via Want.
+func ProbeMKV(src MKVSource) (*MKVInfo, error) {
+	r := &ebmlReader{src: src}
+
+	id, dataOff, size, err := r.header(0, src.Size)
+	if err != nil {
+		if errors.Is(err, ErrMKVDataMissing) {
+			r.want(0, 64<<10)
+		}
+		return nil, err
+	}
+	if id != mkvEBML {
+		return nil, ErrNotMKV
+	}
+	id, segOff, segSize, err := r.header(dataOff+size, src.Size)
+	if err != nil {
+		return nil, err
+	}
+	if id != mkvSegment {
+		return nil, ErrNotMKV
+	}
+
+	info := &MKVInfo{
+		timecodeScale: 1_000_000,
+		segmentData:   segOff,
+		segmentEnd:    src.Size,
+		cuesPos:       -1,
+		cues:          make(map[uint64][]cueRef),
+		done:          make(map[[2]int64]doneCluster),
+	}
+	if segSize != mkvUnknownSize && segOff+segSize < src.Size {
+		info.segmentEnd = segOff + segSize
+	}
+
+	var cuesPos int64 = -1
+	haveTracks := false
+	off := segOff
+	for off < info.segmentEnd {
+		id, dOff, sz, err := r.header(off, info.segmentEnd)
+		if err != nil {
+			if errors.Is(err, ErrMKVDataMissing) {
+				r.want(off, 256<<10)
+			}
+			if haveTracks {
+				break
+			}
+			return nil, err
+		}
+		if id == mkvCluster {
+			info.firstCluster = off
+			break
+		}
+		if sz == mkvUnknownSize {
+			break
+		}
+		switch id {
+		case mkvSeekHead:
+			if b, err := r.readAt(dOff, sz); err == nil {
+				for _, s := range parseChildren(b) {
+					if s.id != mkvSeek {
+						continue
+					}
+					var sid uint64
+					var pos int64 = -1
+					for _, c := range parseChildren(s.data) {
+						switch c.id {
+						case mkvSeekID:
+							sid = ebmlUint(c.data)
+						case mkvSeekPosition:
+							pos = int64(ebmlUint(c.data))
+						}
+					}
+					if sid == mkvCues && pos >= 0 {
+						cuesPos = segOff + pos
+					}
+				}
+			}
+		case mkvInfo:
+			b, err := r.readAt(dOff, sz)
+			if err != nil {
+				r.want(dOff, sz)
+				return nil, err
+			}
+			for _, c := range parseChildren(b) {
+				if c.id == mkvTimecodeScale {
+					if v := int64(ebmlUint(c.data)); v > 0 {
+						info.timecodeScale = v
+					}
+				}
+			}
+		case mkvTracks:
+			b, err := r.readAt(dOff, sz)
+			if err != nil {
+				r.want(dOff, sz)
+				return nil, err
+			}
+			info.Tracks = parseTracks(b)
+			haveTracks = true
+		case mkvCues:
+			cuesPos = off
+		}
+		off = dOff + sz
+	}
+	if !haveTracks {
+		return nil, ErrMKVDataMissing
+	}
+
+	info.cuesPos = cuesPos
+	info.tryCues(r)
+	return info, nil
+}
+
+func parseTracks(b []byte) []MKVTrack {
+	var out []MKVTrack
+	for _, te := range parseChildren(b) {
+		if te.id != mkvTrackEntry {
+			continue
+		}
+		t := MKVTrack{Lang: "eng", compAlgo: -1}
+		var ttype uint64
+		t.Default = true
+		for _, c := range parseChildren(te.data) {
+			switch c.id {
+			case mkvTrackNumber:
+				t.Number = ebmlUint(c.data)
+			case mkvTrackType:
+				ttype = ebmlUint(c.data)
+			case mkvCodecID:
+				t.Codec = ebmlString(c.data)
+			case mkvCodecPrivate:
+				t.private = c.data
+			case mkvLanguage:
+				t.Lang = ebmlString(c.data)
+			case mkvLanguageBCP:
+				if v := ebmlString(c.data); v != "" {
+					t.Lang = v
+				}
+			case mkvName:
+				t.Name = ebmlString(c.data)
+			case mkvFlagDefault:
+				t.Default = ebmlUint(c.data) != 0
+			case mkvFlagForced:
+				t.Forced = ebmlUint(c.data) != 0
+			case mkvContentEncs:
+				for _, enc := range parseChildren(c.data) {
+					if enc.id != mkvContentEnc {
+						continue
+					}
+					for _, ec := range parseChildren(enc.data) {
+						if ec.id != mkvContentComp {
+							continue
+						}
+						t.compAlgo = 0 // zlib is the default algorithm
+						for _, cc := range parseChildren(ec.data) {
+							switch cc.id {
+							case mkvCompAlgo:
+								t.compAlgo = int(ebmlUint(cc.data))
+							case mkvCompSettings:
+								t.compSetting = cc.data
+							}
+						}
+					}
+				}
+			}
+		}
+		if ttype != mkvTrackTypeSubtitle {
+			continue
+		}
+		t.Lang = NormalizeLang(t.Lang)
+		t.Ext = supportedMKVSubCodec[t.Codec]
+		out = append(out, t)
+	}
+	return out
+}
+
+// tryCues loads the cue index if it is not loaded yet
+func (m *MKVInfo) tryCues(r *ebmlReader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cuesPos < 0 || m.cuesLoaded {
+		return
+	}
+	if err := m.loadCues(r, m.cuesPos); err != nil {
+		// cues usually sit at the end of the file; ask for them and carry on
+		r.want(m.cuesPos, 1<<20)
+		return
+	}
+	m.cuesLoaded = true
+}
+
+func (m *MKVInfo) loadCues(r *ebmlReader, off int64) error {
+	id, dOff, sz, err := r.header(off, m.segmentEnd)
+	if err != nil {
+		return err
+	}
+	if id != mkvCues || sz == mkvUnknownSize {
+		return fmt.Errorf("no cues at %d", off)
+	}
+	b, err := r.readAt(dOff, sz)
+	if err != nil {
+		r.want(dOff, sz)
+		return err
+	}
+	seen := make(map[int64]bool)
+	for _, cp := range parseChildren(b) {
+		if cp.id != mkvCuePoint {
+			continue
+		}
+		for _, ctp := range parseChildren(cp.data) {
+			if ctp.id != mkvCueTrackPos {
+				continue
+			}
+			var track uint64
+			var pos, rel int64 = -1, -1
+			for _, c := range parseChildren(ctp.data) {
+				switch c.id {
+				case mkvCueTrack:
+					track = ebmlUint(c.data)
+				case mkvCueClusterPos:
+					pos = m.segmentData + int64(ebmlUint(c.data))
+				case mkvCueRelPos:
+					rel = int64(ebmlUint(c.data))
+				}
+			}
+			if pos < 0 {
+				continue
+			}
+			m.cues[track] = append(m.cues[track], cueRef{cluster: pos, rel: rel})
+			if !seen[pos] {
+				seen[pos] = true
+				m.clusters = append(m.clusters, pos)
+			}
+		}
+	}
+	sort.Slice(m.clusters, func(i, j int) bool { return m.clusters[i] < m.clusters[j] })
+	return nil
+}
+
+// TrackClusters returns the absolute offsets of clusters that the cue index
+// says contain blocks for the given track (empty if the file has no such cues)
+func (m *MKVInfo) TrackClusters(track uint64) []int64 {
+	var out []int64
+	for _, c := range m.cues[track] {
+		if len(out) == 0 || out[len(out)-1] != c.cluster {
+			out = append(out, c.cluster)
+		}
+	}
+	return out
+}
+
+// trackBlocks maps each cluster to the relative block positions the cues
+// give for track; clusters with any unknown position are left out
+func (m *MKVInfo) trackBlocks(track uint64) map[int64][]int64 {
+	out := make(map[int64][]int64)
+	unknown := make(map[int64]bool)
+	for _, c := range m.cues[track] {
+		if c.rel < 0 {
+			unknown[c.cluster] = true
+			continue
+		}
+		out[c.cluster] = append(out[c.cluster], c.rel)
+	}
+	for pos := range unknown {
+		delete(out, pos)
+	}
+	return out
+}
+
+func (m *MKVInfo) cluster(track uint64, off int64) (doneCluster, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.done[[2]int64{int64(track), off}]
+	return d, ok
+}
+
+func (m *MKVInfo) finish(track uint64, off int64, d doneCluster) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done[[2]int64{int64(track), off}] = d
+}
+
+// ExtractMKVSubtitles walks the clusters of src and converts every available
+// block of the given text subtitle track into WebVTT. complete is false when
+// some clusters were not downloaded yet; those are requested via Want. When
+// the cues give block positions only those blocks are requested, not the
+// video data around them. Decoded clusters are remembered in info, so
+// calling again with the same info only reads what was missing.
+func ExtractMKVSubtitles(src MKVSource, info *MKVInfo, track uint64) (vtt string, complete bool, err error) {
+	t, ok := info.Track(track)
+	if !ok || t.Ext == "" {
+		return "", false, ErrUnsupportedTrack
+	}
+	if t.Ext == "ass" || t.Ext == "ssa" {
+		t.ass, _ = parseASS(string(t.private))
+	}
+	r := &ebmlReader{src: src}
+	info.tryCues(r)
+
+	// Clusters known to hold this track get fetched first; without a cue
+	// index for the track every cluster is a candidate.
+	needed := make(map[int64]bool)
+	blocks := info.trackBlocks(track)
+	for _, pos := range info.TrackClusters(track) {
+		needed[pos] = true
+		if _, done := info.cluster(track, pos); !done && !r.have(pos, 4<<10) {
+			r.want(pos, 4<<10)
+		}
+	}
+	missing := func(pos, off, n int64) {
+		if len(needed) == 0 || needed[pos] {
+			complete = false
+			r.want(off, n)
+		}
+	}
+
+	var cues []Cue
+	complete = true
+	off := info.firstCluster
+	if off == 0 {
+		off = info.segmentData
+	}
+	for off < info.segmentEnd {
+		if d, ok := info.cluster(track, off); ok {
+			cues = append(cues, d.cues...)
+			off = d.next
+			continue
+		}
+		id, dOff, sz, err := r.header(off, info.segmentEnd)
+		if err != nil {
+			if !errors.Is(err, ErrMKVDataMissing) {
+				break
+			}
+			// cluster header not downloaded: jump to the next cluster we know of
+			missing(off, off, 4<<10)
+			next := info.nextCluster(off)
+			if next < 0 {
+				break
+			}
+			off = next
+			continue
+		}
+		if id != mkvCluster {
+			if sz == mkvUnknownSize {
+				break
+			}
+			off = dOff + sz
+			continue
+		}
+		end := dOff + sz
+		if sz == mkvUnknownSize || end > info.segmentEnd {
+			end = info.segmentEnd
+		}
+		got, at, next, ok := r.clusterCues(dOff, end, t, info.timecodeScale)
+		if !ok && len(blocks[off]) > 0 {
+			// read the indexed blocks directly and ask for just those
+			var want [][2]int64
+			got, want = r.indexedCues(dOff, end, blocks[off], t, info.timecodeScale, got, at)
+			for _, w := range want {
+				missing(off, w[0], w[1])
+			}
+			ok = len(want) == 0
+		} else if !ok {
+			missing(off, dOff, end-dOff)
+		}
+		if !ok && info.cuesLoaded && len(needed) > 0 && !needed[off] {
+			ok = true // the cues say the track has nothing here
+		}
+		if ok {
+			info.finish(track, off, doneCluster{cues: got, next: next})
+		}
+		cues = append(cues, got...)
+		off = next
+	}
+	return WriteVTT(cues), complete, nil
+}
+
+// indexedCues reads the blocks at the given positions of a cluster payload
+// that starts at dOff, adding them to have unless a block at the same
+// position (haveAt) is already there. It returns the byte ranges still to
+// download.
+func (r *ebmlReader) indexedCues(dOff, end int64, rels []int64, t MKVTrack, scale int64, have []Cue, haveAt []int64) ([]Cue, [][2]int64) {
+	var want [][2]int64
+	clusterTC, err := r.clusterTimecode(dOff, end)
+	if err != nil {
+		return have, [][2]int64{{dOff, 4 << 10}}
+	}
+	// distinct events may share a start time; only the block position
+	// tells a cue already read from one that isn't
+	seen := make(map[int64]bool, len(haveAt))
+	for _, pos := range haveAt {
+		seen[pos] = true
+	}
+	for _, rel := range rels {
+		off := dOff + rel
+		if seen[off] {
+			continue
+		}
+		id, bOff, sz, err := r.header(off, end)
+		if err != nil || sz == mkvUnknownSize {
+			want = append(want, [2]int64{off, 4 << 10})
+			continue
+		}
+		c, ok, err := r.elementCue(id, bOff, sz, t, clusterTC, scale)
+		if err != nil {
+			want = append(want, [2]int64{off, bOff + sz - off})
+			continue
+		}
+		if ok {
+			seen[off] = true
+			have = append(have, c)
+		}
+	}
+	sort.SliceStable(have, func(i, j int) bool { return have[i].Start < have[j].Start })
+	return have, want
+}
+
+// clusterTimecode reads the Timecode element near the start of a cluster payload
+func (r *ebmlReader) clusterTimecode(off, end int64) (int64, error) {
+	for i := 0; i < 4 && off < end; i++ {
+		id, dOff, sz, err := r.header(off, end)
+		if err != nil {
+			return 0, err
+		}
+		if sz == mkvUnknownSize {
+			break
+		}
+		if id == mkvTimecode {
+			b, err := r.readAt(dOff, sz)
+			if err != nil {
+				return 0, err
+			}
+			return int64(ebmlUint(b)), nil
+		}
+		off = dOff + sz
+	}
+	return 0, fmt.Errorf("no cluster timecode at %d", off)
+}
+
+func (m *MKVInfo) nextCluster(after int64) int64 {
+	i := sort.Search(len(m.clusters), func(i int) bool { return m.clusters[i] > after })
+	if i < len(m.clusters) {
+		return m.clusters[i]
+	}
+	return -1
+}
+
+// clusterCues reads the blocks of one cluster, with the position of the
+// block each cue came from. It returns the offset right after the cluster
+// and ok=false if part of the cluster was unavailable.
+func (r *ebmlReader) clusterCues(off, end int64, t MKVTrack, scale int64) (cues []Cue, at []int64, next int64, ok bool) {
+	var clusterTC int64
+	for off < end {
+		id, dOff, sz, err := r.header(off, end)
+		if err != nil || sz == mkvUnknownSize {
+			return cues, at, end, false
+		}
+		switch id {
+		case mkvCluster:
+			// unknown-size cluster ended where the next one starts
+			return cues, at, off, true
+		case mkvTimecode:
+			b, err := r.readAt(dOff, sz)
+			if err != nil {
+				return cues, at, end, false
+			}
+			clusterTC = int64(ebmlUint(b))
+		case mkvSimpleBlock, mkvBlockGroup:
+			if c, ok, err := r.elementCue(id, dOff, sz, t, clusterTC, scale); err != nil {
+				return cues, at, end, false
+			} else if ok {
+				cues, at = append(cues, c), append(at, off)
+			}
+		}
+		off = dOff + sz
+	}
+	return cues, at, end, true
+}
+
+// elementCue decodes a SimpleBlock or BlockGroup element if it belongs to track t
+func (r *ebmlReader) elementCue(id uint64, dOff, sz int64, t MKVTrack, clusterTC, scale int64) (Cue, bool, error) {
+	if id == mkvSimpleBlock {
+		return r.blockCue(dOff, sz, 0, t, clusterTC, scale)
+	}
+	if id != mkvBlockGroup {
+		return Cue{}, false, nil
+	}
+	var blockOff, blockSz int64 = -1, 0
+	var dur int64
+	g := dOff
+	for g < dOff+sz {
+		cid, cOff, csz, err := r.header(g, dOff+sz)
+		if err != nil {
+			return Cue{}, false, err
+		}
+		if csz == mkvUnknownSize {
+			return Cue{}, false, fmt.Errorf("unknown-size element in block group at %d", g)
+		}
+		switch cid {
+		case mkvBlock:
+			blockOff, blockSz = cOff, csz
+		case mkvBlockDur:
+			b, err := r.readAt(cOff, csz)
+			if err != nil {
+				return Cue{}, false, err
+			}
+			dur = int64(ebmlUint(b))
+		}
+		g = cOff + csz
+	}
+	if blockOff < 0 {
+		return Cue{}, false, nil
+	}
+	return r.blockCue(blockOff, blockSz, dur, t, clusterTC, scale)
+}
+
+// blockCue decodes a Block/SimpleBlock if it belongs to track t
+func (r *ebmlReader) blockCue(off, size, dur int64, t MKVTrack, clusterTC, scale int64) (Cue, bool, error) {
+	hn := size
+	if hn > 12 {
+		hn = 12
+	}
+	h, err := r.readAt(off, hn)
+	if err != nil {
+		return Cue{}, false, err
+	}
+	num, numLen, ok := readVintSize(h)
+	if !ok || uint64(num) != t.Number || len(h) < numLen+3 {
+		return Cue{}, false, nil
+	}
+	rel := int64(int16(binary.BigEndian.Uint16(h[numLen:])))
+	flags := h[numLen+2]
+	if flags&0x06 != 0 {
+		return Cue{}, false, nil // laced text blocks don't occur in practice
+	}
+	hdr := int64(numLen + 3)
+	payload, err := r.readAt(off+hdr, size-hdr)
+	if err != nil {
+		return Cue{}, false, err
+	}
+	payload, err = t.decode(payload)
+	if err != nil {
+		return Cue{}, false, nil
+	}
+	start := time.Duration((clusterTC + rel) * scale)
+	text, settings := t.cueText(payload)
+	c := Cue{Start: start, Text: text, Settings: settings}
+	if dur > 0 {
+		c.End = start + time.Duration(dur*scale)
+	}
+	return c, true, nil
+}
+
+func (t MKVTrack) decode(b []byte) ([]byte, error) {
+	switch t.compAlgo {
+	case 0:
+		zr, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(io.LimitReader(zr, 1<<20))
+	case 3:
+		return append(append([]byte{}, t.compSetting...), b...), nil
+	default:
+		return b, nil
+	}
+}
+
+// cueText turns a block payload into VTT cue text and cue settings
+func (t MKVTrack) cueText(b []byte) (string, string) {
+	s := strings.ReplaceAll(string(b), "\r\n", "\n")
+	switch t.Ext {
+	case "ass", "ssa":
+		// ReadOrder, Layer, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+		parts := strings.SplitN(s, ",", 9)
+		if len(parts) != 9 {
+			return t.ass.renderText("", s)
+		}
+		return t.ass.renderText(parts[2], parts[8])
+	default:
+		return s, ""
+	}
+}
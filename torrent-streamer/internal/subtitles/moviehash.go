@@ -0,0 +1,33 @@
+package subtitles
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MovieHashChunk is how much of each end of a file the OpenSubtitles hash reads
+const MovieHashChunk = 64 << 10
+
+// ErrFileTooSmall is returned for files shorter than one hash chunk
+var ErrFileTooSmall = errors.New("file too small for moviehash")
+
+// MovieHash computes the OpenSubtitles hash: the file size plus the sum of
+// the little-endian uint64 words of its first and last 64 KiB, as 16 hex digits
+func MovieHash(r io.ReaderAt, size int64) (string, error) {
+	if size < MovieHashChunk {
+		return "", ErrFileTooSmall
+	}
+	h := uint64(size)
+	buf := make([]byte, MovieHashChunk)
+	for _, off := range []int64{0, size - MovieHashChunk} {
+		if _, err := r.ReadAt(buf, off); err != nil && err != io.EOF {
+			return "", err
+		}
+		for i := 0; i < len(buf); i += 8 {
+			h += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+	return fmt.Sprintf("%016x", h), nil
+}
@@ -0,0 +1,374 @@
+package subtitles
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrUnknownProvider is returned for a source that is not registered
+var ErrUnknownProvider = errors.New("unknown or disabled subtitle provider")
+
+// Query describes what to search subtitles for. Providers use the ids they
+// understand; Title is the free-text fallback (anime rarely has an IMDb id).
+type Query struct {
+	IMDbID string
+	TMDbID string
+	MALID  string
+	Title  string
+	Kind   string // movie|tv|anime ("" = unknown)
+
+	Season     int // 0 = not an episode / unknown
+	Episode    int
+	AbsEpisode int // anime absolute numbering
+
+	// ReleaseName is the file being streamed; results are ranked by how
+	// closely their filename matches it (episode, group, source tokens)
+	ReleaseName string
+	// MovieHash is the OpenSubtitles hash of that file; providers that index
+	// it return subtitles synced to exactly this release
+	MovieHash string
+
+	Langs []string // preferred languages, most preferred first
+}
+
+// IsEpisode reports whether q targets a single episode
+func (q Query) IsEpisode() bool {
+	return q.Season > 0 || q.Episode > 0 || q.AbsEpisode > 0
+}
+
+// maxPerLang bounds how many ranked results are kept per language
+const maxPerLang = 3
+
+// RateLimit is what a provider last reported about its quota
+type RateLimit struct {
+	Known     bool      `json:"known"`
+	Limit     int       `json:"limit,omitempty"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt,omitzero"`
+}
+
+// Exhausted reports whether the quota is used up until ResetAt
+func (r RateLimit) Exhausted() bool {
+	return r.Known && r.Remaining <= 0 && time.Now().Before(r.ResetAt)
+}
+
+// Provider is an external subtitle source
+type Provider interface {
+	// Name is the source id used in URLs and cache keys ("subdl", "opensub")
+	Name() string
+	Search(ctx context.Context, q Query) ([]SubResult, error)
+	// Download returns the raw subtitle file (any format or encoding)
+	Download(ctx context.Context, id string) ([]byte, error)
+	RateLimit() RateLimit
+}
+
+// ProviderReport summarizes one provider's part in a search
+type ProviderReport struct {
+	Name      string    `json:"name"`
+	Results   int       `json:"results"`
+	LatencyMs int64     `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+	RateLimit RateLimit `json:"rateLimit"`
+}
+
+type registered struct {
+	p       Provider
+	timeout time.Duration
+}
+
+// Registry queries a set of providers in parallel and merges their results.
+// Registration order is the tie-break priority when ranking.
+type Registry struct {
+	mu        sync.RWMutex
+	providers []registered
+
+	// MAL resolves MyAnimeList ids to a title for queries without one (optional)
+	MAL interface {
+		Title(ctx context.Context, id string) (string, error)
+	}
+}
+
+func NewRegistry() *Registry { return &Registry{} }
+
+// Register adds p, bounding each of its calls by timeout (0 = caller's context only)
+func (r *Registry) Register(p Provider, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers = append(r.providers, registered{p: p, timeout: timeout})
+}
+
+// Get returns the provider registered under name
+func (r *Registry) Get(name string) (Provider, time.Duration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rp := range r.providers {
+		if rp.p.Name() == name {
+			return rp.p, rp.timeout, true
+		}
+	}
+	return nil, 0, false
+}
+
+// Names lists the registered providers in priority order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, len(r.providers))
+	for i, rp := range r.providers {
+		out[i] = rp.p.Name()
+	}
+	return out
+}
+
+// Search queries all providers concurrently. A provider that fails, times out
+// or is out of quota only loses its own results; reports say what happened.
+func (r *Registry) Search(ctx context.Context, q Query) ([]SubResult, []ProviderReport) {
+	if q.Title == "" && q.IMDbID == "" && q.TMDbID == "" && q.MALID != "" && r.MAL != nil {
+		if title, err := r.MAL.Title(ctx, q.MALID); err == nil {
+			q.Title = title
+		} else {
+			log.Printf("[subtitles] MAL %s: %v", q.MALID, err)
+		}
+	}
+	if q.Title == "" && q.IMDbID == "" && q.TMDbID == "" && q.ReleaseName != "" {
+		q.Title = titleFromRelease(q.ReleaseName)
+	}
+	r.mu.RLock()
+	providers := append([]registered(nil), r.providers...)
+	r.mu.RUnlock()
+
+	results := make([][]SubResult, len(providers))
+	reports := make([]ProviderReport, len(providers))
+	var wg sync.WaitGroup
+	for i, rp := range providers {
+		reports[i].Name = rp.p.Name()
+		if rl := rp.p.RateLimit(); rl.Exhausted() {
+			reports[i].Error = "rate limited until " + rl.ResetAt.Format(time.RFC3339)
+			reports[i].RateLimit = rl
+			continue
+		}
+		wg.Add(1)
+		go func(i int, rp registered) {
+			defer wg.Done()
+			pctx := ctx
+			if rp.timeout > 0 {
+				var cancel context.CancelFunc
+				pctx, cancel = context.WithTimeout(ctx, rp.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			res, err := rp.p.Search(pctx, q)
+			reports[i].LatencyMs = time.Since(start).Milliseconds()
+			reports[i].RateLimit = rp.p.RateLimit()
+			if err != nil {
+				reports[i].Error = err.Error()
+				return
+			}
+			reports[i].Results = len(res)
+			results[i] = res
+		}(i, rp)
+	}
+	wg.Wait()
+
+	var merged []SubResult
+	prio := map[string]int{}
+	for i, res := range results {
+		prio[providers[i].p.Name()] = i
+		for _, s := range res {
+			score, reject := matchScore(s, q)
+			if reject {
+				reports[i].Results--
+				continue
+			}
+			s.Match = score
+			merged = append(merged, s)
+		}
+	}
+	rankResults(merged, q.Langs, prio)
+
+	// keep the best few per language
+	perLang := map[string]int{}
+	out := merged[:0]
+	for _, s := range merged {
+		if perLang[s.Lang] < maxPerLang {
+			perLang[s.Lang]++
+			out = append(out, s)
+		}
+	}
+	return out, reports
+}
+
+// Download fetches subtitle id from source and returns it as UTF-8 WebVTT.
+// Results are cached under source:id; lang hints the encoding detection.
+func (r *Registry) Download(ctx context.Context, source, id, lang string) (string, error) {
+	cacheKey := source + ":" + id
+	if vtt, _, ok := cacheGet(cacheKey); ok {
+		return vtt, nil
+	}
+	p, timeout, ok := r.Get(source)
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	if timeout > 0 {
+		// downloads are two round trips for some providers
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 2*timeout)
+		defer cancel()
+	}
+	data, err := p.Download(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	content, enc := DecodeSubtitle(data, lang)
+	vtt := ToVTT(content)
+	cachePut(cacheKey, vtt, enc)
+	return vtt, nil
+}
+
+// RateLimits returns the last known quota of every provider
+func (r *Registry) RateLimits() map[string]RateLimit {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]RateLimit, len(r.providers))
+	for _, rp := range r.providers {
+		out[rp.p.Name()] = rp.p.RateLimit()
+	}
+	return out
+}
+
+// rankResults orders by requested language, then match, then provider priority,
+// then popularity
+func rankResults(subs []SubResult, langs []string, prio map[string]int) {
+	langRank := map[string]int{}
+	for i, l := range langs {
+		if _, ok := langRank[NormalizeLang(l)]; !ok {
+			langRank[NormalizeLang(l)] = i
+		}
+	}
+	rank := func(lang string) int {
+		if r, ok := langRank[lang]; ok {
+			return r
+		}
+		return len(langs)
+	}
+	sort.SliceStable(subs, func(i, j int) bool {
+		a, b := subs[i], subs[j]
+		if ra, rb := rank(a.Lang), rank(b.Lang); ra != rb {
+			return ra < rb
+		}
+		if a.Match != b.Match {
+			return a.Match > b.Match
+		}
+		if pa, pb := prio[a.Source], prio[b.Source]; pa != pb {
+			return pa < pb
+		}
+		return a.Downloads > b.Downloads
+	})
+}
+
+// rateState tracks quota headers shared by the HTTP providers
+type rateState struct {
+	mu sync.Mutex
+	rl RateLimit
+}
+
+func (s *rateState) get() RateLimit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rl
+}
+
+// observe records RateLimit-* / X-RateLimit-* headers and 429 Retry-After
+func (s *rateState) observe(resp *http.Response) {
+	h := resp.Header
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := h.Get(k); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v := first("RateLimit-Remaining", "X-RateLimit-Remaining"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			s.rl.Known = true
+			s.rl.Remaining = n
+		}
+	}
+	if v := first("RateLimit-Limit", "X-RateLimit-Limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			s.rl.Limit = n
+		}
+	}
+	if v := first("RateLimit-Reset", "X-RateLimit-Reset"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if n > 1e9 { // epoch seconds rather than delta
+				s.rl.ResetAt = time.Unix(n, 0)
+			} else {
+				s.rl.ResetAt = time.Now().Add(time.Duration(n) * time.Second)
+			}
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		s.rl.Known = true
+		s.rl.Remaining = 0
+		wait := time.Minute
+		if n, err := strconv.Atoi(h.Get("Retry-After")); err == nil && n > 0 {
+			wait = time.Duration(n) * time.Second
+		}
+		if reset := time.Now().Add(wait); reset.After(s.rl.ResetAt) {
+			s.rl.ResetAt = reset
+		}
+	}
+}
+
+func (s *rateState) set(remaining int, reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rl.Known = true
+	s.rl.Remaining = remaining
+	if !reset.IsZero() {
+		s.rl.ResetAt = reset
+	}
+}
+
+// ProviderConfig selects and configures the built-in providers. Empty URLs
+// mean the public APIs; tests point them at local stand-in servers.
+type ProviderConfig struct {
+	Names   []string // in priority order; unknown names are ignored
+	Timeout time.Duration
+
+	SubdlAPIURL      string
+	SubdlDownloadURL string
+	OpenSubAPIURL    string
+	OpenSubAPIKey    string
+	JikanAPIURL      string // MAL id -> title lookups
+}
+
+// NewRegistryFrom builds a registry of the built-in providers named in cfg.
+// OpenSubtitles is skipped without an API key.
+func NewRegistryFrom(cfg ProviderConfig) *Registry {
+	reg := NewRegistry()
+	client := &http.Client{Timeout: 30 * time.Second}
+	reg.MAL = &MALTitles{APIURL: cfg.JikanAPIURL, HTTP: client}
+	for _, name := range cfg.Names {
+		switch name {
+		case "subdl":
+			reg.Register(&SubdlProvider{APIURL: cfg.SubdlAPIURL, DownloadURL: cfg.SubdlDownloadURL, HTTP: client}, cfg.Timeout)
+		case "opensub":
+			if cfg.OpenSubAPIKey == "" {
+				continue
+			}
+			reg.Register(&OpenSubProvider{APIURL: cfg.OpenSubAPIURL, APIKey: cfg.OpenSubAPIKey, HTTP: client}, cfg.Timeout)
+		}
+	}
+	return reg
+}
@@ -0,0 +1,234 @@
+package subtitles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const openSubAPI = "https://api.opensubtitles.com/api/v1"
+
+// OpenSubProvider searches OpenSubtitles (requires API key)
+type OpenSubProvider struct {
+	APIURL string // "" = public API
+	APIKey string
+	HTTP   *http.Client
+
+	rl rateState
+}
+
+func (p *OpenSubProvider) Name() string         { return "opensub" }
+func (p *OpenSubProvider) RateLimit() RateLimit { return p.rl.get() }
+
+func (p *OpenSubProvider) client() *http.Client {
+	if p.HTTP != nil {
+		return p.HTTP
+	}
+	return &http.Client{Timeout: defaultHTTPTimout}
+}
+
+func (p *OpenSubProvider) base() string {
+	if p.APIURL != "" {
+		return strings.TrimRight(p.APIURL, "/")
+	}
+	return openSubAPI
+}
+
+// Search looks up subtitles by IMDb/TMDb ID or title, most downloaded first.
+// For episodes the ids are the show's (parent_*) plus season/episode numbers.
+// With a moviehash, results made for that exact file are flagged HashMatch.
+func (p *OpenSubProvider) Search(ctx context.Context, q Query) ([]SubResult, error) {
+	if p.APIKey == "" {
+		return nil, nil
+	}
+
+	params := url.Values{}
+	prefix := ""
+	if q.IsEpisode() {
+		prefix = "parent_"
+	}
+	switch {
+	case q.IMDbID != "":
+		// Normalize IMDB ID - OpenSub wants numeric only
+		params.Set(prefix+"imdb_id", strings.TrimPrefix(q.IMDbID, "tt"))
+	case q.TMDbID != "":
+		params.Set(prefix+"tmdb_id", q.TMDbID)
+	case q.Title != "":
+		params.Set("query", q.Title)
+	case q.MovieHash == "":
+		return nil, nil
+	}
+	if q.IsEpisode() || q.Kind == "tv" || q.Kind == "anime" {
+		params.Set("type", "episode")
+	} else if q.Kind == "movie" {
+		params.Set("type", "movie")
+	}
+	if q.Season > 0 {
+		params.Set("season_number", strconv.Itoa(q.Season))
+	}
+	if ep := q.Episode; ep > 0 || q.AbsEpisode > 0 {
+		if ep == 0 {
+			ep = q.AbsEpisode
+		}
+		params.Set("episode_number", strconv.Itoa(ep))
+	}
+	if q.MovieHash != "" {
+		params.Set("moviehash", q.MovieHash)
+	}
+	if len(q.Langs) > 0 {
+		params.Set("languages", strings.Join(q.Langs, ","))
+	}
+	params.Set("order_by", "download_count")
+	params.Set("order_direction", "desc")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.base()+"/subtitles?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Api-Key", p.APIKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("opensub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	p.rl.observe(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("opensub returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []struct {
+			Attributes struct {
+				Files []struct {
+					FileID   int    `json:"file_id"`
+					FileName string `json:"file_name"`
+				} `json:"files"`
+				Language        string `json:"language"`
+				Release         string `json:"release"`
+				DownloadCount   int    `json:"download_count"`
+				HearingImpaired bool   `json:"hearing_impaired"`
+				MovieHashMatch  bool   `json:"moviehash_match"`
+				FeatureDetails  struct {
+					SeasonNumber  int `json:"season_number"`
+					EpisodeNumber int `json:"episode_number"`
+				} `json:"feature_details"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode opensub response: %w", err)
+	}
+
+	var subs []SubResult
+	for _, item := range result.Data {
+		a := item.Attributes
+		if len(a.Files) == 0 {
+			continue
+		}
+
+		lang := NormalizeLang(a.Language)
+
+		fileID := a.Files[0].FileID
+		fileName := a.Files[0].FileName
+		if fileName == "" {
+			fileName = a.Release
+		}
+
+		hi := ""
+		if a.HearingImpaired {
+			hi = " (HI)"
+		}
+
+		subs = append(subs, SubResult{
+			Source:    "opensub",
+			ID:        fmt.Sprintf("%d", fileID),
+			Lang:      lang,
+			Label:     fmt.Sprintf("%s%s", langName(lang), hi),
+			FileName:  fileName,
+			Downloads: a.DownloadCount,
+			Season:    a.FeatureDetails.SeasonNumber,
+			Episode:   a.FeatureDetails.EpisodeNumber,
+			HashMatch: a.MovieHashMatch,
+		})
+	}
+
+	return subs, nil
+}
+
+// Download resolves a temporary link for the file and fetches it
+func (p *OpenSubProvider) Download(ctx context.Context, id string) ([]byte, error) {
+	if p.APIKey == "" {
+		return nil, fmt.Errorf("OpenSubtitles API key required")
+	}
+	fileID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opensub file id %q", id)
+	}
+
+	// First, get download link from OpenSubtitles
+	reqBody := strings.NewReader(fmt.Sprintf(`{"file_id":%d}`, fileID))
+	req, err := http.NewRequestWithContext(ctx, "POST", p.base()+"/download", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Api-Key", p.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("opensub download request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	p.rl.observe(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("opensub download returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var dlResp struct {
+		Link      string `json:"link"`
+		Remaining int    `json:"remaining"`
+		ResetTime string `json:"reset_time_utc"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&dlResp); err != nil {
+		return nil, fmt.Errorf("failed to decode opensub download response: %w", err)
+	}
+	// the download quota is separate from the request rate limit and is what runs out
+	reset, _ := time.Parse(time.RFC3339, dlResp.ResetTime)
+	p.rl.set(dlResp.Remaining, reset)
+
+	if dlResp.Link == "" {
+		return nil, fmt.Errorf("no download link in opensub response")
+	}
+
+	// Now download the actual subtitle file
+	subReq, err := http.NewRequestWithContext(ctx, "GET", dlResp.Link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	subResp, err := p.client().Do(subReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download subtitle file: %w", err)
+	}
+	defer subResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(subResp.Body, 5<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subtitle file: %w", err)
+	}
+	return data, nil
+}
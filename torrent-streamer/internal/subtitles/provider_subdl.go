@@ -0,0 +1,169 @@
+package subtitles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	subdlAPI      = "https://api.subdl.com/api/v1/subtitles"
+	subdlDownload = "https://dl.subdl.com/subtitle"
+)
+
+// SubdlProvider searches Subdl (free, no API key required)
+type SubdlProvider struct {
+	APIURL      string // search endpoint; "" = public API
+	DownloadURL string // download base; "" = public host
+	HTTP        *http.Client
+
+	rl rateState
+}
+
+func (p *SubdlProvider) Name() string         { return "subdl" }
+func (p *SubdlProvider) RateLimit() RateLimit { return p.rl.get() }
+
+func (p *SubdlProvider) client() *http.Client {
+	if p.HTTP != nil {
+		return p.HTTP
+	}
+	return &http.Client{Timeout: defaultHTTPTimout}
+}
+
+// Search looks up subtitles by IMDb or TMDb ID, falling back to the title;
+// episodes are narrowed by season/episode number
+func (p *SubdlProvider) Search(ctx context.Context, q Query) ([]SubResult, error) {
+	params := url.Values{}
+	switch {
+	case q.IMDbID != "":
+		// Normalize IMDB ID
+		imdbID := q.IMDbID
+		if !strings.HasPrefix(imdbID, "tt") {
+			imdbID = "tt" + imdbID
+		}
+		params.Set("imdb_id", imdbID)
+	case q.TMDbID != "":
+		params.Set("tmdb_id", q.TMDbID)
+	case q.Title != "":
+		params.Set("film_name", q.Title)
+	default:
+		return nil, nil
+	}
+	if q.IsEpisode() || q.Kind == "tv" || q.Kind == "anime" {
+		params.Set("type", "tv")
+	} else if q.Kind == "movie" {
+		params.Set("type", "movie")
+	}
+	if q.Season > 0 {
+		params.Set("season_number", strconv.Itoa(q.Season))
+	}
+	if ep := q.Episode; ep > 0 || q.AbsEpisode > 0 {
+		if ep == 0 {
+			ep = q.AbsEpisode
+		}
+		params.Set("episode_number", strconv.Itoa(ep))
+	}
+	params.Set("subs_per_page", "30")
+	if len(q.Langs) > 0 {
+		params.Set("languages", strings.Join(q.Langs, ","))
+	}
+
+	base := p.APIURL
+	if base == "" {
+		base = subdlAPI
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", base+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("subdl request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	p.rl.observe(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("subdl returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Status    bool `json:"status"`
+		Results   int  `json:"results"`
+		Subtitles []struct {
+			SubID       int    `json:"sd_id"`
+			ReleaseName string `json:"release_name"`
+			Name        string `json:"name"`
+			Lang        string `json:"lang"`
+			Author      string `json:"author"`
+			URL         string `json:"url"`
+			Season      int    `json:"season"`
+			Episode     int    `json:"episode"`
+		} `json:"subtitles"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode subdl response: %w", err)
+	}
+
+	var subs []SubResult
+	for _, s := range result.Subtitles {
+		lang := NormalizeLang(s.Lang)
+
+		label := s.Name
+		if label == "" {
+			label = s.ReleaseName
+		}
+
+		subs = append(subs, SubResult{
+			Source:   "subdl",
+			ID:       fmt.Sprintf("%d", s.SubID),
+			Lang:     lang,
+			Label:    label,
+			FileName: s.Name,
+			Season:   s.Season,
+			Episode:  s.Episode,
+		})
+	}
+
+	return subs, nil
+}
+
+// Download fetches the raw subtitle file
+func (p *SubdlProvider) Download(ctx context.Context, id string) ([]byte, error) {
+	base := p.DownloadURL
+	if base == "" {
+		base = subdlDownload
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(base, "/")+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("subdl download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	p.rl.observe(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("subdl download returned status %d", resp.StatusCode)
+	}
+
+	// Read the content (could be SRT or VTT or ZIP)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 5<<20)) // 5MB limit
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subdl response: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,262 @@
+package subtitles
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSRT = "1\r\n00:00:01,000 --> 00:00:02,500\r\nHello\r\n"
+
+// subdlStandIn serves the Subdl search and download endpoints
+func subdlStandIn(t *testing.T, status int) (*httptest.Server, *SubdlProvider) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/subtitles", func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("imdb_id") != "tt0944947" || q.Get("type") != "tv" || q.Get("season_number") != "1" || q.Get("episode_number") != "5" {
+			t.Errorf("subdl query = %v", q)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"status": true,
+			"subtitles": []map[string]any{
+				{"sd_id": 11, "release_name": "Show.S01E05.1080p.WEB-DL-GRP", "name": "Show.S01E05.1080p.WEB-DL-GRP.srt", "lang": "English", "season": 1, "episode": 5},
+				{"sd_id": 12, "name": "Show.S01E05.720p.HDTV-OTHER.srt", "lang": "french", "season": 1, "episode": 5},
+				{"sd_id": 13, "name": "Show.S01E06.1080p.WEB-DL-GRP.srt", "lang": "english", "season": 1, "episode": 6},
+			},
+		})
+	})
+	mux.HandleFunc("/dl/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testSRT))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &SubdlProvider{APIURL: srv.URL + "/api/v1/subtitles", DownloadURL: srv.URL + "/dl", HTTP: srv.Client()}
+}
+
+// openSubStandIn serves the OpenSubtitles search and two-step download;
+// remaining is reported in the rate limit headers, 0 answers 429
+func openSubStandIn(t *testing.T, remaining int) (*httptest.Server, *OpenSubProvider) {
+	t.Helper()
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/subtitles", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if remaining == 0 {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "7")
+		w.Header().Set("X-RateLimit-Limit", "40")
+		if q := r.URL.Query(); q.Get("parent_imdb_id") != "0944947" || q.Get("type") != "episode" {
+			t.Errorf("opensub query = %v", q)
+		}
+		_, _ = w.Write([]byte(`{"data":[
+			{"attributes":{"files":[{"file_id":21,"file_name":"Show.S01E05.1080p.WEB-DL-GRP.srt"}],"language":"en","download_count":500,
+			  "feature_details":{"season_number":1,"episode_number":5}}},
+			{"attributes":{"files":[{"file_id":22,"file_name":"Show.S01E05.srt"}],"language":"en","download_count":9000,"hearing_impaired":true,
+			  "feature_details":{"season_number":1,"episode_number":5}}},
+			{"attributes":{"files":[],"language":"en"}}
+		]}`))
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"link": srv.URL + "/file/21", "remaining": 3, "reset_time_utc": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	mux.HandleFunc("/file/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testSRT))
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &OpenSubProvider{APIURL: srv.URL, APIKey: "key", HTTP: srv.Client()}
+}
+
+func episodeQuery() Query {
+	return Query{IMDbID: "tt0944947", Kind: "tv", Season: 1, Episode: 5, ReleaseName: "Show.S01E05.1080p.WEB-DL-GRP.mkv"}
+}
+
+func TestSubdlSearch(t *testing.T) {
+	_, p := subdlStandIn(t, http.StatusOK)
+	res, err := p.Search(context.Background(), episodeQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("got %d results, want 3", len(res))
+	}
+	if res[0].Source != "subdl" || res[0].ID != "11" || res[0].Lang != "en" || res[0].Episode != 5 {
+		t.Errorf("first result = %+v", res[0])
+	}
+	if res[1].Lang != "fr" {
+		t.Errorf("lang = %q, want fr", res[1].Lang)
+	}
+	data, err := p.Download(context.Background(), "11")
+	if err != nil || string(data) != testSRT {
+		t.Errorf("download = %q, %v", data, err)
+	}
+}
+
+func TestOpenSubSearchAndRateLimit(t *testing.T) {
+	_, p := openSubStandIn(t, 7)
+	res, err := p.Search(context.Background(), episodeQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("got %d results, want 2 (entry without files skipped)", len(res))
+	}
+	if res[1].Label != "English (HI)" || res[1].Downloads != 9000 {
+		t.Errorf("second result = %+v", res[1])
+	}
+	rl := p.RateLimit()
+	if !rl.Known || rl.Remaining != 7 || rl.Limit != 40 || rl.Exhausted() {
+		t.Errorf("rate limit = %+v", rl)
+	}
+
+	data, err := p.Download(context.Background(), "21")
+	if err != nil || string(data) != testSRT {
+		t.Fatalf("download = %q, %v", data, err)
+	}
+	if rl := p.RateLimit(); rl.Remaining != 3 {
+		t.Errorf("download quota not recorded: %+v", rl)
+	}
+}
+
+func TestOpenSubTooManyRequests(t *testing.T) {
+	_, p := openSubStandIn(t, 0)
+	if _, err := p.Search(context.Background(), episodeQuery()); err == nil {
+		t.Fatal("expected an error for 429")
+	}
+	rl := p.RateLimit()
+	if !rl.Exhausted() || time.Until(rl.ResetAt) < time.Minute {
+		t.Errorf("rate limit after 429 = %+v", rl)
+	}
+
+	// an exhausted provider is skipped without a request
+	reg := NewRegistry()
+	reg.Register(p, time.Second)
+	res, reports := reg.Search(context.Background(), episodeQuery())
+	if len(res) != 0 || len(reports) != 1 || !strings.HasPrefix(reports[0].Error, "rate limited") {
+		t.Errorf("results %v, reports %+v", res, reports)
+	}
+}
+
+func TestRegistryRanking(t *testing.T) {
+	_, subdl := subdlStandIn(t, http.StatusOK)
+	_, opensub := openSubStandIn(t, 7)
+	reg := NewRegistry()
+	reg.Register(subdl, time.Second)
+	reg.Register(opensub, time.Second)
+
+	q := episodeQuery()
+	q.Langs = []string{"fr", "en"}
+	res, reports := reg.Search(context.Background(), q)
+	for _, rep := range reports {
+		if rep.Error != "" {
+			t.Errorf("%s: %s", rep.Name, rep.Error)
+		}
+	}
+
+	var got []string
+	for _, s := range res {
+		got = append(got, s.Source+":"+s.ID)
+	}
+	// French first (requested first); the S01E06 file is rejected; among
+	// English the release match wins, then provider order, then downloads
+	want := []string{"subdl:12", "subdl:11", "opensub:21", "opensub:22"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+	if reports[0].Results != 2 {
+		t.Errorf("subdl results = %d, want 2 after rejecting the wrong episode", reports[0].Results)
+	}
+}
+
+func TestRegistryOneProviderFails(t *testing.T) {
+	_, subdl := subdlStandIn(t, http.StatusInternalServerError)
+	_, opensub := openSubStandIn(t, 7)
+	reg := NewRegistry()
+	reg.Register(subdl, time.Second)
+	reg.Register(opensub, time.Second)
+
+	res, reports := reg.Search(context.Background(), episodeQuery())
+	if len(res) != 2 {
+		t.Fatalf("got %d results, want opensub's 2", len(res))
+	}
+	for _, s := range res {
+		if s.Source != "opensub" {
+			t.Errorf("unexpected result %+v", s)
+		}
+	}
+	if reports[0].Name != "subdl" || !strings.Contains(reports[0].Error, "500") {
+		t.Errorf("subdl report = %+v", reports[0])
+	}
+	if reports[1].Error != "" || reports[1].Results != 2 {
+		t.Errorf("opensub report = %+v", reports[1])
+	}
+
+	vtt, err := reg.Download(context.Background(), "opensub", "21", "en")
+	if err != nil || !strings.Contains(vtt, "00:00:01.000 --> 00:00:02.500") {
+		t.Errorf("download = %q, %v", vtt, err)
+	}
+	if _, err := reg.Download(context.Background(), "nope", "1", ""); err != ErrUnknownProvider {
+		t.Errorf("unknown provider: %v", err)
+	}
+}
+
+func TestRegistryProviderTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+	_, opensub := openSubStandIn(t, 7)
+	reg := NewRegistry()
+	reg.Register(&SubdlProvider{APIURL: slow.URL, HTTP: slow.Client()}, 50*time.Millisecond)
+	reg.Register(opensub, time.Second)
+
+	res, reports := reg.Search(context.Background(), episodeQuery())
+	if len(res) != 2 || reports[0].Error == "" {
+		t.Errorf("results %d, subdl report %+v", len(res), reports[0])
+	}
+}
+
+func TestRegistryResolvesMALID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/anime/16498":
+			_, _ = w.Write([]byte(`{"data":{"title":"Shingeki no Kyojin","title_english":"Attack on Titan"}}`))
+		case r.URL.Path == "/subtitles":
+			if got := r.URL.Query().Get("film_name"); got != "Attack on Titan" {
+				t.Errorf("film_name = %q", got)
+			}
+			_, _ = w.Write([]byte(`{"status":true,"subtitles":[{"sd_id":1,"name":"Attack.on.Titan.S01E05.srt","lang":"english","season":1,"episode":5}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	reg := NewRegistry()
+	reg.MAL = &MALTitles{APIURL: srv.URL, HTTP: srv.Client()}
+	reg.Register(&SubdlProvider{APIURL: srv.URL + "/subtitles", HTTP: srv.Client()}, time.Second)
+	res, _ := reg.Search(context.Background(), Query{MALID: "16498", Kind: "anime", Season: 1, Episode: 5})
+	if len(res) != 1 {
+		t.Fatalf("got %d results, want 1", len(res))
+	}
+}
@@ -0,0 +1,132 @@
+package subtitles
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transform retimes a subtitle: every timestamp t becomes t*Ratio + Offset.
+// Ratio corrects framerate mismatches (a 25 fps subtitle on a 23.976 fps
+// release needs 25/23.976); Offset fixes constant drift.
+type Transform struct {
+	OffsetMs int64   `json:"offsetMs"`
+	Ratio    float64 `json:"ratio"` // 0 means 1
+}
+
+// IsIdentity reports whether t leaves timings unchanged
+func (t Transform) IsIdentity() bool {
+	return t.OffsetMs == 0 && (t.Ratio == 0 || t.Ratio == 1)
+}
+
+// Key is a stable cache key fragment for t ("" for the identity)
+func (t Transform) Key() string {
+	if t.IsIdentity() {
+		return ""
+	}
+	r := t.Ratio
+	if r == 0 {
+		r = 1
+	}
+	return fmt.Sprintf("o%d_r%s", t.OffsetMs, strconv.FormatFloat(r, 'f', 6, 64))
+}
+
+func (t Transform) apply(d time.Duration) time.Duration {
+	if t.Ratio > 0 {
+		d = time.Duration(float64(d) * t.Ratio)
+	}
+	return d + time.Duration(t.OffsetMs)*time.Millisecond
+}
+
+// ParseFPSRatio parses a framerate ratio given either as "from:to" framerates
+// (the subtitle's fps, then the video's) or as a plain factor
+func ParseFPSRatio(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if from, to, ok := strings.Cut(s, ":"); ok {
+		a, err1 := strconv.ParseFloat(from, 64)
+		b, err2 := strconv.ParseFloat(to, 64)
+		if err1 != nil || err2 != nil || a <= 0 || b <= 0 {
+			return 0, fmt.Errorf("invalid fps ratio %q", s)
+		}
+		return a / b, nil
+	}
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil || r <= 0 {
+		return 0, fmt.Errorf("invalid fps ratio %q", s)
+	}
+	return r, nil
+}
+
+var vttTimingRe = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}\.\d{3})\s+-->\s+((?:\d+:)?\d{1,2}:\d{2}\.\d{3})(.*)$`)
+
+// RetimeVTT applies t to every cue of a WebVTT document. Cues that end up
+// entirely before zero are dropped; cues straddling zero start at zero.
+func RetimeVTT(vtt string, t Transform) string {
+	if t.IsIdentity() {
+		return vtt
+	}
+	blocks := strings.Split(strings.ReplaceAll(vtt, "\r\n", "\n"), "\n\n")
+	out := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		lines := strings.Split(block, "\n")
+		keep := true
+		for i, line := range lines {
+			m := vttTimingRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			start, err1 := parseVTTTime(m[1])
+			end, err2 := parseVTTTime(m[2])
+			if err1 != nil || err2 != nil {
+				break
+			}
+			start, end = t.apply(start), t.apply(end)
+			if end <= 0 {
+				keep = false
+				break
+			}
+			lines[i] = formatVTTTime(start) + " --> " + formatVTTTime(end) + m[3]
+			break
+		}
+		if keep {
+			out = append(out, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(out, "\n\n")
+}
+
+// parseVTTTime parses HH:MM:SS.mmm or MM:SS.mmm
+func parseVTTTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("bad timestamp %q", s)
+	}
+	var h, m int
+	var err error
+	if len(parts) == 3 {
+		if h, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, err
+		}
+		parts = parts[1:]
+	}
+	if m, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, err
+	}
+	// integer seconds and milliseconds: a float would turn .001 into .000999…
+	secStr, fracStr, _ := strings.Cut(strings.Replace(parts[1], ",", ".", 1), ".")
+	sec, err := strconv.Atoi(secStr)
+	if err != nil {
+		return 0, err
+	}
+	var ms int
+	if fracStr != "" {
+		fracStr = (fracStr + "00")[:3]
+		if ms, err = strconv.Atoi(fracStr); err != nil {
+			return 0, err
+		}
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
@@ -0,0 +1,34 @@
+package subtitles
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVTTTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"00:00:05.001", 5*time.Second + time.Millisecond},
+		{"00:00:05.999", 5*time.Second + 999*time.Millisecond},
+		{"01:02:03.456", time.Hour + 2*time.Minute + 3*time.Second + 456*time.Millisecond},
+		{"02:03.5", 2*time.Minute + 3*time.Second + 500*time.Millisecond},
+		{"00:00:07,250", 7*time.Second + 250*time.Millisecond},
+		{"00:00:09", 9 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parseVTTTime(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseVTTTime(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+		if err == nil && len(tt.in) == 12 && tt.in[8] == '.' && formatVTTTime(got) != tt.in {
+			t.Errorf("round trip %q -> %q", tt.in, formatVTTTime(got))
+		}
+	}
+	for _, bad := range []string{"", "5", "aa:bb.ccc", "00:00:xx.000"} {
+		if _, err := parseVTTTime(bad); err == nil {
+			t.Errorf("parseVTTTime(%q) accepted", bad)
+		}
+	}
+}
@@ -1,43 +1,28 @@
 package subtitles
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 )
 
 // SubResult represents a subtitle search result from external sources
 type SubResult struct {
-	Source   string `json:"source"`   // "subdl" or "opensub"
-	ID       string `json:"id"`       // unique identifier for download
-	Lang     string `json:"lang"`     // ISO 639-1 language code
-	Label    string `json:"label"`    // display label
-	URL      string `json:"url"`      // download URL (internal endpoint)
-	FileName string `json:"fileName"` // original filename
-}
-
-// Cache for downloaded subtitles (VTT content)
-var (
-	subCache   = make(map[string]cachedSub)
-	subCacheMu sync.RWMutex
-)
-
-type cachedSub struct {
-	vtt     string
-	fetched time.Time
+	Source    string  `json:"source"`              // "subdl" or "opensub"
+	ID        string  `json:"id"`                  // unique identifier for download
+	Lang      string  `json:"lang"`                // ISO 639-1 language code
+	Label     string  `json:"label"`               // display label
+	URL       string  `json:"url"`                 // download URL (internal endpoint)
+	FileName  string  `json:"fileName"`            // original filename
+	Encoding  string  `json:"encoding,omitempty"`  // detected charset, known once downloaded
+	Downloads int     `json:"downloads,omitempty"` // provider popularity, used for ranking
+	Season    int     `json:"season,omitempty"`    // as reported by the provider
+	Episode   int     `json:"episode,omitempty"`
+	Match     float64 `json:"match,omitempty"`     // fit to the requested episode and release, 0..1
+	HashMatch bool    `json:"hashMatch,omitempty"` // made for this exact file (moviehash)
 }
 
 const (
-	cacheTTL          = 1 * time.Hour
-	subdlAPI          = "https://api.subdl.com/api/v1/subtitles"
-	openSubAPI        = "https://api.opensubtitles.com/api/v1"
 	defaultHTTPTimout = 15 * time.Second
 )
 
@@ -92,336 +77,44 @@ func SRTtoVTT(srt string) string {
 	return vtt.String()
 }
 
-// FetchFromSubdl searches Subdl API for subtitles (free, no API key required)
-func FetchFromSubdl(ctx context.Context, imdbID string, langs []string) ([]SubResult, error) {
-	if imdbID == "" {
-		return nil, nil
-	}
-
-	// Normalize IMDB ID
-	if !strings.HasPrefix(imdbID, "tt") {
-		imdbID = "tt" + imdbID
-	}
-
-	params := url.Values{}
-	params.Set("imdb_id", imdbID)
-	if len(langs) > 0 {
-		params.Set("languages", strings.Join(langs, ","))
-	}
-
-	reqURL := subdlAPI + "?" + params.Encode()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
-
-	client := &http.Client{Timeout: defaultHTTPTimout}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("subdl request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("subdl returned status %d", resp.StatusCode)
-	}
-
-	var result struct {
-		Status    bool   `json:"status"`
-		Results   int    `json:"results"`
-		Subtitles []struct {
-			SubID       int    `json:"sd_id"`
-			ReleaseName string `json:"release_name"`
-			Name        string `json:"name"`
-			Lang        string `json:"lang"`
-			Author      string `json:"author"`
-			URL         string `json:"url"`
-		} `json:"subtitles"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode subdl response: %w", err)
-	}
-
-	var subs []SubResult
-	seen := make(map[string]bool) // dedupe by lang
-	for _, s := range result.Subtitles {
-		lang := normalizeLang(s.Lang)
-		if seen[lang] {
-			continue
-		}
-		seen[lang] = true
-
-		label := s.Name
-		if label == "" {
-			label = s.ReleaseName
-		}
-
-		subs = append(subs, SubResult{
-			Source:   "subdl",
-			ID:       fmt.Sprintf("%d", s.SubID),
-			Lang:     lang,
-			Label:    label,
-			FileName: s.Name,
-		})
+// ToVTT converts subtitle content of any supported format (VTT, ASS/SSA, SRT) to WebVTT
+func ToVTT(content string) string {
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(content, "\ufeff")), "WEBVTT"):
+		return content
+	case IsASS(content):
+		return ASSToVTT(content)
+	default:
+		return SRTtoVTT(content)
 	}
-
-	return subs, nil
 }
 
-// FetchFromOpenSub searches OpenSubtitles API for subtitles (requires API key)
-func FetchFromOpenSub(ctx context.Context, imdbID string, langs []string, apiKey string) ([]SubResult, error) {
-	if imdbID == "" || apiKey == "" {
-		return nil, nil
-	}
-
-	// Normalize IMDB ID - OpenSub wants numeric only
-	imdbNumeric := strings.TrimPrefix(imdbID, "tt")
-
-	params := url.Values{}
-	params.Set("imdb_id", imdbNumeric)
-	if len(langs) > 0 {
-		params.Set("languages", strings.Join(langs, ","))
-	}
-	params.Set("order_by", "download_count")
-	params.Set("order_direction", "desc")
-
-	reqURL := openSubAPI + "/subtitles?" + params.Encode()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Api-Key", apiKey)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
-
-	client := &http.Client{Timeout: defaultHTTPTimout}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("opensub request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("opensub returned status %d", resp.StatusCode)
-	}
-
-	var result struct {
-		Data []struct {
-			Attributes struct {
-				Files []struct {
-					FileID   int    `json:"file_id"`
-					FileName string `json:"file_name"`
-				} `json:"files"`
-				Language       string `json:"language"`
-				Release        string `json:"release"`
-				DownloadCount  int    `json:"download_count"`
-				HearingImpaired bool  `json:"hearing_impaired"`
-			} `json:"attributes"`
-		} `json:"data"`
+// CachedEncoding returns the detected charset of a previously downloaded subtitle
+func CachedEncoding(source, id string) string {
+	if cache == nil {
+		return ""
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode opensub response: %w", err)
-	}
-
-	var subs []SubResult
-	seen := make(map[string]bool) // dedupe by lang
-	for _, item := range result.Data {
-		a := item.Attributes
-		if len(a.Files) == 0 {
-			continue
-		}
-
-		lang := normalizeLang(a.Language)
-		if seen[lang] {
-			continue
-		}
-		seen[lang] = true
-
-		fileID := a.Files[0].FileID
-		fileName := a.Files[0].FileName
-		if fileName == "" {
-			fileName = a.Release
-		}
-
-		hi := ""
-		if a.HearingImpaired {
-			hi = " (HI)"
-		}
-
-		subs = append(subs, SubResult{
-			Source:   "opensub",
-			ID:       fmt.Sprintf("%d", fileID),
-			Lang:     lang,
-			Label:    fmt.Sprintf("%s%s", langName(lang), hi),
-			FileName: fileName,
-		})
-	}
-
-	return subs, nil
+	enc, _ := cache.Peek(source + ":" + id)
+	return enc
 }
 
-// DownloadSubdlSubtitle downloads a subtitle from Subdl and returns VTT content
-func DownloadSubdlSubtitle(ctx context.Context, subID string) (string, error) {
-	cacheKey := "subdl:" + subID
-
-	// Check cache
-	subCacheMu.RLock()
-	if c, ok := subCache[cacheKey]; ok && time.Since(c.fetched) < cacheTTL {
-		subCacheMu.RUnlock()
-		return c.vtt, nil
-	}
-	subCacheMu.RUnlock()
-
-	// Subdl download endpoint
-	downloadURL := fmt.Sprintf("https://dl.subdl.com/subtitle/%s", subID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", "TorrentStreamer/1.0")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("subdl download failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("subdl download returned status %d", resp.StatusCode)
-	}
-
-	// Read the content (could be SRT or VTT or ZIP)
-	data, err := io.ReadAll(io.LimitReader(resp.Body, 5<<20)) // 5MB limit
-	if err != nil {
-		return "", fmt.Errorf("failed to read subdl response: %w", err)
-	}
-
-	content := string(data)
-
-	// If it's a ZIP file, we'd need to extract it (simplified: just check for SRT/VTT)
-	// For now, assume it's SRT and convert if needed
-	var vtt string
-	if strings.HasPrefix(strings.TrimSpace(content), "WEBVTT") {
-		vtt = content
-	} else {
-		vtt = SRTtoVTT(content)
-	}
-
-	// Cache the result
-	subCacheMu.Lock()
-	subCache[cacheKey] = cachedSub{vtt: vtt, fetched: time.Now()}
-	subCacheMu.Unlock()
-
-	return vtt, nil
-}
-
-// DownloadOpenSubSubtitle downloads a subtitle from OpenSubtitles and returns VTT content
-func DownloadOpenSubSubtitle(ctx context.Context, fileID string, apiKey string) (string, error) {
-	if apiKey == "" {
-		return "", fmt.Errorf("OpenSubtitles API key required")
-	}
-
-	cacheKey := "opensub:" + fileID
-
-	// Check cache
-	subCacheMu.RLock()
-	if c, ok := subCache[cacheKey]; ok && time.Since(c.fetched) < cacheTTL {
-		subCacheMu.RUnlock()
-		return c.vtt, nil
-	}
-	subCacheMu.RUnlock()
-
-	// First, get download link from OpenSubtitles
-	downloadReqURL := openSubAPI + "/download"
-	reqBody := strings.NewReader(fmt.Sprintf(`{"file_id":%s}`, fileID))
-
-	req, err := http.NewRequestWithContext(ctx, "POST", downloadReqURL, reqBody)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Api-Key", apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("opensub download request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return "", fmt.Errorf("opensub download returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var dlResp struct {
-		Link string `json:"link"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&dlResp); err != nil {
-		return "", fmt.Errorf("failed to decode opensub download response: %w", err)
-	}
-
-	if dlResp.Link == "" {
-		return "", fmt.Errorf("no download link in opensub response")
-	}
-
-	// Now download the actual subtitle file
-	subReq, err := http.NewRequestWithContext(ctx, "GET", dlResp.Link, nil)
-	if err != nil {
-		return "", err
+// Retimed returns vtt with t applied, cached under key plus the transform so
+// every distinct correction of the same subtitle is converted once
+func Retimed(key, vtt string, t Transform) string {
+	if t.IsIdentity() {
+		return vtt
 	}
-
-	subResp, err := client.Do(subReq)
-	if err != nil {
-		return "", fmt.Errorf("failed to download subtitle file: %w", err)
-	}
-	defer subResp.Body.Close()
-
-	data, err := io.ReadAll(io.LimitReader(subResp.Body, 5<<20))
-	if err != nil {
-		return "", fmt.Errorf("failed to read subtitle file: %w", err)
-	}
-
-	content := string(data)
-	var vtt string
-	if strings.HasPrefix(strings.TrimSpace(content), "WEBVTT") {
-		vtt = content
-	} else {
-		vtt = SRTtoVTT(content)
-	}
-
-	// Cache the result
-	subCacheMu.Lock()
-	subCache[cacheKey] = cachedSub{vtt: vtt, fetched: time.Now()}
-	subCacheMu.Unlock()
-
-	return vtt, nil
-}
-
-// ClearCache removes expired entries from the subtitle cache
-func ClearCache() {
-	subCacheMu.Lock()
-	defer subCacheMu.Unlock()
-
-	now := time.Now()
-	for k, v := range subCache {
-		if now.Sub(v.fetched) > cacheTTL {
-			delete(subCache, k)
-		}
+	cacheKey := key + "|" + t.Key()
+	if out, _, ok := cacheGet(cacheKey); ok {
+		return out
 	}
+	out := RetimeVTT(vtt, t)
+	cachePut(cacheKey, out, "")
+	return out
 }
 
-// normalizeLang converts various language codes to ISO 639-1 (2-letter)
-func normalizeLang(lang string) string {
+// NormalizeLang converts various language codes to ISO 639-1 (2-letter)
+func NormalizeLang(lang string) string {
 	lang = strings.ToLower(strings.TrimSpace(lang))
 
 	// Map of 3-letter to 2-letter codes
@@ -445,6 +138,22 @@ func normalizeLang(lang string) string {
 		"tha": "th", "thai": "th",
 		"ind": "id", "indonesian": "id",
 		"msa": "ms", "malay": "ms",
+		"fas": "fa", "per": "fa", "persian": "fa", "farsi": "fa",
+		"urd": "ur", "urdu": "ur",
+		"ukr": "uk", "ukrainian": "uk",
+		"bul": "bg", "bulgarian": "bg",
+		"srp": "sr", "scc": "sr", "serbian": "sr",
+		"mkd": "mk", "mac": "mk", "macedonian": "mk",
+		"bel": "be", "belarusian": "be",
+		"ces": "cs", "cze": "cs", "czech": "cs",
+		"slk": "sk", "slo": "sk", "slovak": "sk",
+		"hun": "hu", "hungarian": "hu",
+		"ron": "ro", "rum": "ro", "romanian": "ro",
+		"hrv": "hr", "scr": "hr", "croatian": "hr",
+		"slv": "sl", "slovenian": "sl",
+		"ell": "el", "gre": "el", "greek": "el",
+		"heb": "he", "hebrew": "he", "iw": "he",
+		"fre": "fr", "ger": "de", "dut": "nl",
 	}
 
 	if mapped, ok := langMap[lang]; ok {
@@ -481,6 +190,21 @@ func langName(code string) string {
 		"th": "Thai",
 		"id": "Indonesian",
 		"ms": "Malay",
+		"fa": "Persian",
+		"ur": "Urdu",
+		"uk": "Ukrainian",
+		"bg": "Bulgarian",
+		"sr": "Serbian",
+		"mk": "Macedonian",
+		"be": "Belarusian",
+		"cs": "Czech",
+		"sk": "Slovak",
+		"hu": "Hungarian",
+		"ro": "Romanian",
+		"hr": "Croatian",
+		"sl": "Slovenian",
+		"el": "Greek",
+		"he": "Hebrew",
 	}
 
 	if name, ok := names[code]; ok {
@@ -0,0 +1,48 @@
+package subtitles
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SyncStore persists per-user subtitle timing corrections
+type SyncStore struct{ DB *sql.DB }
+
+func NewSyncStore(db *sql.DB) *SyncStore { return &SyncStore{DB: db} }
+
+// GetSync returns the correction subjectID saved for subtitle subKey played
+// against the video in infoHash
+func (s *SyncStore) GetSync(ctx context.Context, subjectID, infoHash, subKey string) (Transform, bool, error) {
+	var t Transform
+	err := s.DB.QueryRowContext(ctx, `
+SELECT offset_ms, ratio FROM subtitle_sync
+WHERE subject_id=$1 AND infohash=$2 AND sub_key=$3`,
+		subjectID, infoHash, subKey).Scan(&t.OffsetMs, &t.Ratio)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Transform{}, false, nil
+		}
+		return Transform{}, false, err
+	}
+	return t, true, nil
+}
+
+// SaveSync stores a correction; the identity transform clears it
+func (s *SyncStore) SaveSync(ctx context.Context, subjectID, infoHash, subKey string, t Transform) error {
+	if t.IsIdentity() {
+		_, err := s.DB.ExecContext(ctx, `
+DELETE FROM subtitle_sync WHERE subject_id=$1 AND infohash=$2 AND sub_key=$3`,
+			subjectID, infoHash, subKey)
+		return err
+	}
+	if t.Ratio == 0 {
+		t.Ratio = 1
+	}
+	_, err := s.DB.ExecContext(ctx, `
+INSERT INTO subtitle_sync (subject_id, infohash, sub_key, offset_ms, ratio, created_at, updated_at)
+VALUES ($1,$2,$3,$4,$5, now(), now())
+ON CONFLICT (subject_id, infohash, sub_key) DO UPDATE
+SET offset_ms=EXCLUDED.offset_ms, ratio=EXCLUDED.ratio, updated_at=now()`,
+		subjectID, infoHash, subKey, t.OffsetMs, t.Ratio)
+	return err
+}
@@ -0,0 +1,72 @@
+package subtitles
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cue is a single timed subtitle entry
+type Cue struct {
+	Start    time.Duration
+	End      time.Duration
+	Text     string // may contain VTT markup (<i>, <b>, <u>) and newlines
+	Settings string // optional VTT cue settings, e.g. "line:10% align:start"
+}
+
+// WriteVTT renders cues as a WebVTT document. Cues are sorted by start time;
+// cues without an end time are closed at the next cue (capped at 5s).
+func WriteVTT(cues []Cue) string {
+	sorted := make([]Cue, len(cues))
+	copy(sorted, cues)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for i, c := range sorted {
+		text := strings.TrimSpace(c.Text)
+		if text == "" {
+			continue
+		}
+		end := c.End
+		if end <= c.Start {
+			end = c.Start + 5*time.Second
+			if i+1 < len(sorted) && sorted[i+1].Start > c.Start && sorted[i+1].Start < end {
+				end = sorted[i+1].Start
+			}
+		}
+		b.WriteString(formatVTTTime(c.Start))
+		b.WriteString(" --> ")
+		b.WriteString(formatVTTTime(end))
+		if c.Settings != "" {
+			b.WriteString(" ")
+			b.WriteString(c.Settings)
+		}
+		b.WriteString("\n")
+		// blank lines would terminate the cue early
+		for _, line := range strings.Split(text, "\n") {
+			if line = strings.TrimRight(line, " \t\r"); line != "" {
+				b.WriteString(line)
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatVTTTime formats a duration as HH:MM:SS.mmm
+func formatVTTTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	h := ms / 3600000
+	ms -= h * 3600000
+	m := ms / 60000
+	ms -= m * 60000
+	s := ms / 1000
+	ms -= s * 1000
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+}
@@ -0,0 +1,107 @@
+package torrentx
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"torrent-streamer/internal/scoring"
+	"torrent-streamer/pkg/types"
+)
+
+// confidence stops growing here, so a long-trusted group can still be
+// unseated after a few fallbacks
+const maxGroupConfidence = 10
+
+// GroupPreference is the release group a series is best served by
+type GroupPreference struct {
+	SeriesID   string `json:"seriesId"`
+	Group      string `json:"group"`
+	Confidence int    `json:"confidence"`
+}
+
+func (r *Repo) GetGroupPreference(ctx context.Context, seriesID string) (GroupPreference, bool, error) {
+	g := GroupPreference{SeriesID: seriesID}
+	err := r.DB.QueryRowContext(ctx, `
+SELECT preferred_group, confidence FROM group_preferences WHERE series_id=$1`, seriesID).Scan(&g.Group, &g.Confidence)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return GroupPreference{}, false, nil
+		}
+		return GroupPreference{}, false, err
+	}
+	return g, true, nil
+}
+
+// ReinforceGroup records a completed episode from group: the preferred group
+// gains confidence, another group takes its place once it has none left
+func (r *Repo) ReinforceGroup(ctx context.Context, seriesID, group string) error {
+	if group == "" {
+		return nil
+	}
+	_, err := r.DB.ExecContext(ctx, `
+INSERT INTO group_preferences AS gp (series_id, preferred_group, confidence, created_at, updated_at)
+VALUES ($1,$2,1, now(), now())
+ON CONFLICT (series_id) DO UPDATE
+SET preferred_group = CASE WHEN lower(gp.preferred_group)=lower(EXCLUDED.preferred_group) OR gp.confidence<=1
+                           THEN EXCLUDED.preferred_group ELSE gp.preferred_group END,
+    confidence = CASE WHEN lower(gp.preferred_group)=lower(EXCLUDED.preferred_group) THEN LEAST(gp.confidence+1, $3)
+                      WHEN gp.confidence<=1 THEN 1 ELSE gp.confidence-1 END,
+    updated_at = now()`, seriesID, group, maxGroupConfidence)
+	return err
+}
+
+// WeakenGroup records that group let the series down on season/episode: a
+// pick fell back to another group or was overridden. Each episode counts
+// once, however many profiles pick it.
+func (r *Repo) WeakenGroup(ctx context.Context, seriesID, group string, season, episode int) error {
+	_, err := r.DB.ExecContext(ctx, `
+UPDATE group_preferences
+SET confidence=GREATEST(confidence-1, 0), weakened_season=$3, weakened_episode=$4, updated_at=now()
+WHERE series_id=$1 AND lower(preferred_group)=lower($2) AND confidence > 0
+  AND (weakened_season, weakened_episode) IS DISTINCT FROM ($3, $4)`, seriesID, group, season, episode)
+	return err
+}
+
+// PreviousPick returns the pick for the episode before season/episode under
+// the same profile, if one was made
+func (r *Repo) PreviousPick(ctx context.Context, seriesID string, season, episode int, profileHash string) (PickRow, bool, error) {
+	var p PickRow
+	err := r.DB.QueryRowContext(ctx, `
+SELECT id, series_id, season, episode, profile_hash, infohash, magnet, release_group, resolution, codec, file_index,
+       source_kind, size_bytes, score, picked_at, replaces_pick_id
+FROM picks
+WHERE series_id=$1 AND (season, episode) < ($2, $3) AND profile_hash=$4 AND superseded_at IS NULL
+ORDER BY season DESC, episode DESC LIMIT 1`,
+		seriesID, season, episode, profileHash).
+		Scan(&p.ID, &p.SeriesID, &p.Season, &p.Episode, &p.ProfileHash, &p.InfoHash, &p.Magnet, &p.ReleaseGroup,
+			&p.Resolution, &p.Codec, &p.FileIndex, &p.SourceKind, &p.SizeBytes, &p.ScoreJSON, &p.PickedAt, &p.ReplacesPick)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PickRow{}, false, nil
+		}
+		return PickRow{}, false, err
+	}
+	return p, true, nil
+}
+
+// LoadHistory gathers the previous episode's pick and the series' preferred
+// group for scoring; lookups that fail only cost the consistency bonus
+func LoadHistory(ctx context.Context, repo *Repo, seriesID string, season, episode int, profileHash string) scoring.History {
+	var h scoring.History
+	if p, ok, err := repo.PreviousPick(ctx, seriesID, season, episode, profileHash); err != nil {
+		log.Printf("[search] previous pick %s: %v", seriesID, err)
+	} else if ok {
+		h.Prior = &types.Pick{
+			SeriesID: p.SeriesID, Season: p.Season, Episode: p.Episode, ProfileHash: p.ProfileHash,
+			InfoHash: p.InfoHash, Magnet: p.Magnet, ReleaseGroup: p.ReleaseGroup,
+			Resolution: p.Resolution, Codec: p.Codec, FileIndex: p.FileIndex, SourceKind: p.SourceKind, SizeBytes: p.SizeBytes,
+		}
+	}
+	if g, ok, err := repo.GetGroupPreference(ctx, seriesID); err != nil {
+		log.Printf("[search] group preference %s: %v", seriesID, err)
+	} else if ok && g.Confidence > 0 {
+		h.PreferredGroup, h.Confidence = g.Group, g.Confidence
+	}
+	return h
+}
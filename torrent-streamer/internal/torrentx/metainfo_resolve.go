@@ -0,0 +1,224 @@
+package torrentx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"torrent-streamer/internal/config"
+	"torrent-streamer/internal/releaseparse"
+	"torrent-streamer/pkg/types"
+)
+
+// ErrEpisodeNotInTorrent means a resolved torrent holds episodes, but not the one asked for
+var ErrEpisodeNotInTorrent = errors.New("episode not in torrent")
+
+// samples are short clips shipped next to the real video
+var reSample = regexp.MustCompile(`(?i)(^|[\\/ ._\-\[(])sample([\\/ ._\-\])]|$)`)
+
+var videoExts = map[string]bool{".mp4": true, ".webm": true, ".m4v": true, ".mov": true, ".mkv": true, ".avi": true, ".ts": true}
+
+// fetchTorrentFile downloads a .torrent from an indexer link
+func fetchTorrentFile(ctx context.Context, torrentURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", torrentURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+		// indexers sometimes redirect a download link to the magnet itself
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme == "magnet" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch torrent URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if loc := resp.Header.Get("Location"); strings.HasPrefix(strings.ToLower(loc), "magnet:") {
+		return nil, &magnetRedirect{Magnet: loc}
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("torrent URL returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Read the torrent file data
+	torrentData, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read torrent data: %w", err)
+	}
+
+	// Validate it looks like a torrent file (bencode starts with 'd')
+	if len(torrentData) < 2 || torrentData[0] != 'd' {
+		// Probably HTML or error page
+		preview := string(torrentData)
+		if len(preview) > 200 {
+			preview = preview[:200]
+		}
+		return nil, fmt.Errorf("response is not a valid torrent file (got %d bytes starting with: %q)", len(torrentData), preview)
+	}
+	return torrentData, nil
+}
+
+// magnetRedirect is returned when a download link redirects to a magnet URI
+type magnetRedirect struct{ Magnet string }
+
+func (m *magnetRedirect) Error() string { return "torrent URL redirects to magnet" }
+
+// metainfoPath is where fetched .torrent files are kept, by infohash
+func metainfoPath(ih metainfo.Hash) string {
+	return filepath.Join(config.MetainfoDir(), ih.HexString()+".torrent")
+}
+
+// storeMetainfo keeps the .torrent so later adds skip the metadata exchange
+// and don't depend on the (often expiring) indexer link
+func storeMetainfo(ih metainfo.Hash, data []byte) {
+	p := metainfoPath(ih)
+	if _, err := os.Stat(p); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		log.Printf("[torrent] store metainfo %s: %v", ih.HexString(), err)
+		return
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("[torrent] store metainfo %s: %v", ih.HexString(), err)
+		return
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+	}
+}
+
+// loadStoredMetainfo returns the stored .torrent for ih, if any
+func loadStoredMetainfo(ih metainfo.Hash) (*metainfo.MetaInfo, bool) {
+	mi, err := metainfo.LoadFromFile(metainfoPath(ih))
+	if err != nil {
+		return nil, false
+	}
+	return mi, true
+}
+
+// ResolveCandidate fetches the .torrent behind an HTTP indexer link, stores
+// it, and rewrites c with the real infohash, a magnet (with the torrent's
+// trackers) and what the file list says: the episode's file index and size,
+// the total size, and how many episode and sample files it holds. Magnet
+// candidates only get their infohash parsed.
+func ResolveCandidate(ctx context.Context, c *types.Candidate, season, episode int, abs *int) error {
+	link := c.Magnet
+	if strings.HasPrefix(strings.ToLower(link), "magnet:") {
+		// base32 btih and other forms parseLink doesn't read
+		if m, err := metainfo.ParseMagnetURI(link); err == nil && m.InfoHash != (metainfo.Hash{}) {
+			c.InfoHash = m.InfoHash.HexString()
+		}
+		return nil
+	}
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return nil
+	}
+	data, err := fetchTorrentFile(ctx, link)
+	var mr *magnetRedirect
+	if errors.As(err, &mr) {
+		if m, perr := metainfo.ParseMagnetURI(mr.Magnet); perr == nil {
+			c.InfoHash, c.Magnet = m.InfoHash.HexString(), mr.Magnet
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to parse torrent metainfo: %w", err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return fmt.Errorf("failed to parse torrent info: %w", err)
+	}
+	ih := mi.HashInfoBytes()
+	storeMetainfo(ih, data)
+
+	c.InfoHash = ih.HexString()
+	c.Magnet = mi.Magnet(&ih, &info).String()
+	applyFileList(c, &info, season, episode, abs)
+	if c.EpisodeFiles > 0 && c.FileIndex == nil && (episode > 0 || abs != nil) {
+		return ErrEpisodeNotInTorrent
+	}
+	return nil
+}
+
+// applyFileList fills file-level details from a torrent's info dictionary
+func applyFileList(c *types.Candidate, info *metainfo.Info, season, episode int, abs *int) {
+	files := info.UpvertedFiles()
+	c.Files = len(files)
+	c.TotalBytes = info.TotalLength()
+	c.EpisodeFiles, c.SampleFiles = 0, 0
+	c.FileIndex = nil
+
+	largest, match := -1, -1
+	for i, fi := range files {
+		name := fi.DisplayPath(info)
+		if !videoExts[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		if reSample.MatchString(name) && fi.Length < 300<<20 {
+			c.SampleFiles++
+			continue
+		}
+		if largest < 0 || fi.Length > files[largest].Length {
+			largest = i
+		}
+		rel := releaseparse.Parse(name)
+		var hit bool
+		switch {
+		case rel.Episode > 0:
+			hit = slices.Contains(rel.Episodes, episode) && (season == 0 || rel.Season == 0 || rel.Season == season)
+		case rel.AbsEpisode > 0:
+			// anime files number episodes absolutely: "Show - 05.mkv"
+			hit = abs != nil && rel.AbsEpisode == *abs || abs == nil && rel.AbsEpisode == episode
+		default:
+			continue
+		}
+		c.EpisodeFiles++
+		if hit && (match < 0 || fi.Length > files[match].Length) {
+			match = i
+		}
+	}
+
+	pick := match
+	if pick < 0 && (c.EpisodeFiles == 0 || episode <= 0 && abs == nil) {
+		// no episode numbering (a movie, or no episode asked for): the
+		// largest video is the one to play. A lone file numbered as another
+		// episode is left unpicked so the caller rejects it.
+		pick = largest
+	}
+	if pick >= 0 {
+		idx := pick
+		c.FileIndex = &idx
+		c.SizeBytes = files[pick].Length
+	}
+	if c.EpisodeFiles > 1 {
+		c.SourceKind = "season_pack"
+	} else {
+		c.SourceKind = "single"
+	}
+}
@@ -0,0 +1,117 @@
+package torrentx
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+
+	"torrent-streamer/internal/subtitles"
+)
+
+// maxMovieHashes bounds the hash cache; the oldest entries go first
+const maxMovieHashes = 2048
+
+var (
+	movieHashMu    sync.Mutex
+	movieHashes    = make(map[string]string) // infohash:fileIndex -> moviehash
+	movieHashOrder []string                  // keys of movieHashes, oldest first
+	movieHashIn    = make(map[string]bool)   // computations in flight
+)
+
+// CachedMovieHash returns a previously computed hash of file idx
+func CachedMovieHash(t *torrent.Torrent, idx int) (string, bool) {
+	movieHashMu.Lock()
+	defer movieHashMu.Unlock()
+	h, ok := movieHashes[movieHashKey(t, idx)]
+	return h, ok
+}
+
+// FileMovieHash computes the OpenSubtitles hash of file idx. Only its first
+// and last 64 KiB are needed; those pieces are raised to high priority and
+// waited for up to timeout. Results are cached per infohash+fileIndex.
+func FileMovieHash(t *torrent.Torrent, idx int, timeout time.Duration) (string, error) {
+	if h, ok := CachedMovieHash(t, idx); ok {
+		return h, nil
+	}
+	if t.Info() == nil || idx < 0 || idx >= len(t.Files()) {
+		return "", fmt.Errorf("no file %d", idx)
+	}
+	f := t.Files()[idx]
+	size := f.Length()
+	if size < subtitles.MovieHashChunk {
+		return "", subtitles.ErrFileTooSmall
+	}
+
+	tail := size - subtitles.MovieHashChunk
+	deadline := time.Now().Add(timeout)
+	for !FileRangeComplete(f, 0, subtitles.MovieHashChunk) || !FileRangeComplete(f, tail, subtitles.MovieHashChunk) {
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("moviehash: file ends not downloaded within %s", timeout)
+		}
+		PrioritizeFileRange(f, 0, subtitles.MovieHashChunk)
+		PrioritizeFileRange(f, tail, subtitles.MovieHashChunk)
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	rd := f.NewReader()
+	defer rd.Close()
+	rd.SetReadahead(0)
+	h, err := subtitles.MovieHash(readerAt{rd}, size)
+	if err != nil {
+		return "", err
+	}
+	storeMovieHash(movieHashKey(t, idx), h)
+	return h, nil
+}
+
+func storeMovieHash(k, h string) {
+	movieHashMu.Lock()
+	defer movieHashMu.Unlock()
+	if _, ok := movieHashes[k]; !ok {
+		if len(movieHashOrder) >= maxMovieHashes {
+			delete(movieHashes, movieHashOrder[0])
+			movieHashOrder = movieHashOrder[1:]
+		}
+		movieHashOrder = append(movieHashOrder, k)
+	}
+	movieHashes[k] = h
+}
+
+// WarmMovieHash computes the hash of file idx in the background so a later
+// CachedMovieHash finds it; concurrent calls for the same file are collapsed
+func WarmMovieHash(t *torrent.Torrent, idx int, timeout time.Duration) {
+	k := movieHashKey(t, idx)
+	movieHashMu.Lock()
+	if _, ok := movieHashes[k]; ok || movieHashIn[k] {
+		movieHashMu.Unlock()
+		return
+	}
+	movieHashIn[k] = true
+	movieHashMu.Unlock()
+
+	go func() {
+		defer func() {
+			movieHashMu.Lock()
+			delete(movieHashIn, k)
+			movieHashMu.Unlock()
+		}()
+		_, _ = FileMovieHash(t, idx, timeout)
+	}()
+}
+
+func movieHashKey(t *torrent.Torrent, idx int) string {
+	return fmt.Sprintf("%s:%d", t.InfoHash().HexString(), idx)
+}
+
+// readerAt adapts a seekable torrent reader for sequential ReadAt calls
+type readerAt struct{ r torrent.Reader }
+
+func (a readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := a.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(a.r, p)
+}
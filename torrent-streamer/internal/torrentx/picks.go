@@ -4,6 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"torrent-streamer/internal/scoring"
@@ -16,65 +20,66 @@ type EnsureInput struct {
 	SeriesID, SeriesTitle, Kind string
 	Season, Episode             int
 	AbsEpisode                  *int
+	IMDbID, TVDbID              string // optional: enable id-based indexer search
 	ProfileHash                 string
 	ProfileCaps                 scoring.ProfileCaps
 	EstRuntimeMin               float64
-	Prior                       *types.Pick // optional: to favor same release group
+	History                     *scoring.History // nil = load the series' own (previous pick, preferred group)
+	// IgnoreMiss searches again even when an empty result is cached: the
+	// feed watcher has just seen a release for the episode
+	IgnoreMiss bool
 }
 
 type EnsureDeps struct {
 	Repo   *Repo
-	Search interface {
-		Query(title string, season, episode int, abs *int) ([]types.Candidate, error)
-	}
+	Search Searcher
 }
 
 func EnsurePick(ctx context.Context, d EnsureDeps, in EnsureInput) (PickRow, error) {
+	// one profile for the whole decision, even if it is reloaded meanwhile
+	prof := scoring.Active()
+	in.ProfileHash = scoring.ProfileKey(in.ProfileHash)
 	if p, ok, err := d.Repo.GetPick(ctx, in.SeriesID, in.Season, in.Episode, in.ProfileHash); err != nil {
 		return PickRow{}, err
 	} else if ok {
 		return p, nil
 	}
 
+	var hist scoring.History
+	if in.History != nil {
+		hist = *in.History
+	} else {
+		hist = LoadHistory(ctx, d.Repo, in.SeriesID, in.Season, in.Episode, in.ProfileHash)
+	}
+
 	key := searchKey(in.SeriesID, in.Season, in.Episode, in.ProfileHash)
 	var cands []types.Candidate
-	if cached, ok, _ := d.Repo.GetSearchCache(ctx, key); ok && len(cached) > 0 {
-		cands = cached
+	if cached, ok, _ := d.Repo.GetSearchCache(ctx, key); ok && (len(cached) > 0 || !in.IgnoreMiss) {
+		cands = cached // may be a cached miss
 	} else {
-		found, err := d.Search.Query(in.SeriesTitle, in.Season, in.Episode, in.AbsEpisode)
+		found, err := d.Search.Search(ctx, in.query())
 		if err != nil {
 			return PickRow{}, err
 		}
-		_ = d.Repo.PutSearchCache(ctx, key, found)
+		_ = d.Repo.PutSearchCache(ctx, key, in.SeriesID, in.Kind, found)
 		cands = found
 	}
 
-	var best types.Candidate
-	var bestSB types.ScoreBreakdown
-	has := false
-	for _, c := range cands {
-		sb := scoring.Score(c, in.ProfileCaps, in.EstRuntimeMin, in.Prior, scoring.DefaultParams)
-		if sb.Total < 0 {
-			continue
-		}
-		if !has || sb.Total > bestSB.Total {
-			best, bestSB, has = c, sb, true
-		}
-	}
-	if !has {
+	ranked := Rank(cands, in.ProfileCaps, in.EstRuntimeMin, hist, prof)
+	best := chooseBest(ctx, ranked, in, hist, prof)
+	if best < 0 {
 		return PickRow{}, ErrNoCandidate
 	}
-
-	sbJSON, _ := json.Marshal(bestSB)
-	row := PickRow{
-		SeriesID: in.SeriesID, Season: in.Season, Episode: in.Episode,
-		ProfileHash: in.ProfileHash,
-		InfoHash:    best.InfoHash, Magnet: best.Magnet,
-		ReleaseGroup: nz(best.ReleaseGroup),
-		Resolution:   best.Resolution, Codec: best.Codec,
-		FileIndex: best.FileIndex, SourceKind: best.SourceKind,
-		SizeBytes: &best.SizeBytes, ScoreJSON: sbJSON, PickedAt: time.Now(),
+	if g := ranked[best].Candidate.ReleaseGroup; hist.PreferredGroup != "" && !strings.EqualFold(g, hist.PreferredGroup) &&
+		offersGroup(ranked, hist.PreferredGroup) {
+		// the preferred group's releases lost or were rejected: fell back to
+		// another. An episode it simply hasn't released says nothing about it.
+		if err := d.Repo.WeakenGroup(ctx, in.SeriesID, hist.PreferredGroup, in.Season, in.Episode); err != nil {
+			log.Printf("[search] group preference %s: %v", in.SeriesID, err)
+		}
 	}
+
+	row := pickRow(in, ranked, best, hist, prof)
 	id, err := d.Repo.InsertPick(ctx, row)
 	if err != nil {
 		return PickRow{}, err
@@ -83,6 +88,131 @@ func EnsurePick(ctx context.Context, d EnsureDeps, in EnsureInput) (PickRow, err
 	return row, nil
 }
 
+// offersGroup reports whether any candidate comes from group
+func offersGroup(ranked []Ranked, group string) bool {
+	for _, r := range ranked {
+		if strings.EqualFold(r.Candidate.ReleaseGroup, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (in EnsureInput) query() SearchQuery {
+	return SearchQuery{
+		Title: in.SeriesTitle, Kind: in.Kind,
+		Season: in.Season, Episode: in.Episode, AbsEpisode: in.AbsEpisode,
+		IMDbID: in.IMDbID, TVDbID: in.TVDbID,
+	}
+}
+
+// chooseBest returns the index of the best usable candidate in ranked, -1 if
+// there is none. Picks must carry a real infohash and magnet: the best
+// candidate behind an HTTP .torrent link is resolved and rescored with its
+// file list, and ranked is sorted again with its new score, until the best
+// candidate is one whose score is final. ranked is updated with what
+// resolving found.
+func chooseBest(ctx context.Context, ranked []Ranked, in EnsureInput, hist scoring.History, prof *scoring.Profile) int {
+	const maxResolve = 5
+	resolved := 0
+	for {
+		i := slices.IndexFunc(ranked, func(r Ranked) bool {
+			// links past the resolve budget can't be picked
+			return r.Score.HardReject == "" && (r.Candidate.InfoHash != "" || resolved < maxResolve)
+		})
+		if i < 0 {
+			return -1
+		}
+		r := &ranked[i]
+		if r.Candidate.InfoHash != "" {
+			return i
+		}
+		resolved++
+		switch err := ResolveCandidate(ctx, &r.Candidate, in.Season, in.Episode, in.AbsEpisode); {
+		case err != nil:
+			log.Printf("[search] resolve %q: %v", r.Candidate.Title, err)
+			r.Score = types.ScoreBreakdown{HardReject: "unresolvable", Total: -1}
+		case r.Candidate.InfoHash == "":
+			r.Score = types.ScoreBreakdown{HardReject: "unresolvable", Total: -1}
+		default:
+			r.Score = scoring.Score(r.Candidate, in.ProfileCaps, in.EstRuntimeMin, hist, prof)
+		}
+		sortRanked(ranked)
+	}
+}
+
+// pickRow makes ranked[best] the pick for in, explanation included
+func pickRow(in EnsureInput, ranked []Ranked, best int, hist scoring.History, prof *scoring.Profile) PickRow {
+	ranked[best].Picked = true
+	c := ranked[best].Candidate
+	sbJSON, _ := json.Marshal(ranked[best].Score)
+	exJSON, _ := json.Marshal(Explanation{
+		ProfileVersion: prof.Version, Weights: prof.Weights,
+		Query: in.query(), Caps: in.ProfileCaps, EstRuntimeMin: in.EstRuntimeMin, History: hist,
+		Candidates: ranked,
+	})
+	return PickRow{
+		SeriesID: in.SeriesID, Season: in.Season, Episode: in.Episode,
+		ProfileHash: in.ProfileHash,
+		InfoHash:    c.InfoHash, Magnet: c.Magnet,
+		ReleaseGroup: nz(c.ReleaseGroup),
+		Resolution:   c.Resolution, Codec: c.Codec,
+		FileIndex: c.FileIndex, SourceKind: c.SourceKind,
+		SizeBytes: &c.SizeBytes, ScoreJSON: sbJSON, ExplainJSON: exJSON, PickedAt: time.Now(),
+	}
+}
+
+// Ranked is one candidate and how it scored
+type Ranked struct {
+	Candidate types.Candidate      `json:"candidate"`
+	Score     types.ScoreBreakdown `json:"score"`
+	Picked    bool                 `json:"picked,omitempty"`
+}
+
+// Explanation is how a pick was chosen: every candidate with its score or
+// reject reason, and the rules and inputs they were scored with
+type Explanation struct {
+	ProfileVersion string              `json:"profileVersion"`
+	Weights        scoring.Params      `json:"weights"`
+	Query          SearchQuery         `json:"query"`
+	Caps           scoring.ProfileCaps `json:"caps"`
+	EstRuntimeMin  float64             `json:"estRuntimeMin"`
+	History        scoring.History     `json:"history"`
+	Candidates     []Ranked            `json:"candidates"`
+}
+
+// Rank scores cands with prof, best first; hard rejects are kept, last
+func Rank(cands []types.Candidate, caps scoring.ProfileCaps, estRuntimeMin float64, hist scoring.History, prof *scoring.Profile) []Ranked {
+	out := make([]Ranked, 0, len(cands))
+	for _, c := range cands {
+		out = append(out, Ranked{Candidate: c, Score: scoring.Score(c, caps, estRuntimeMin, hist, prof)})
+	}
+	sortRanked(out)
+	return out
+}
+
+// sortRanked orders ranked best first, keeping ties in place
+func sortRanked(ranked []Ranked) {
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score.Total > ranked[j].Score.Total })
+}
+
+// Rescore ranks the candidates cached for a pick key with the active rules.
+// Candidates behind .torrent links are scored as the indexer listed them,
+// without their file list.
+func Rescore(ctx context.Context, repo *Repo, seriesID string, season, episode int, profileHash string,
+	caps scoring.ProfileCaps, estRuntimeMin float64, hist scoring.History) (Explanation, bool, error) {
+	cands, ok, err := repo.LastSearch(ctx, searchKey(seriesID, season, episode, profileHash))
+	if err != nil || !ok {
+		return Explanation{}, false, err
+	}
+	prof := scoring.Active()
+	return Explanation{
+		ProfileVersion: prof.Version, Weights: prof.Weights,
+		Caps: caps, EstRuntimeMin: estRuntimeMin, History: hist,
+		Candidates: Rank(cands, caps, estRuntimeMin, hist, prof),
+	}, true, nil
+}
+
 func nz(s string) *string {
 	if s == "" {
 		return nil
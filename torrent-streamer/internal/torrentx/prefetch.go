@@ -0,0 +1,93 @@
+package torrentx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/anacrolix/torrent"
+
+	"torrent-streamer/internal/config"
+)
+
+// ErrMetadataTimeout is returned by Prefetch when the torrent's metadata
+// didn't arrive within config.WaitMetadata
+var ErrMetadataTimeout = errors.New("metadata timeout")
+
+// Prefetched is what Prefetch got ready of a torrent
+type Prefetched struct {
+	Torrent        *torrent.Torrent
+	File           *torrent.File // nil when the torrent has no playable file
+	FileIndex      int
+	MetadataMs     int64
+	PrebufferBytes int64
+	PrebufferMs    int64
+	Subtitles      []SubtitleFile
+}
+
+// Prefetch adds a torrent (or finds it loaded), waits for its metadata and
+// touches it so the janitor keeps it around. It then prebuffers the
+// subtitle files and the head of the video file: fileIndex, or the best
+// video file when it is out of range. A pct above zero also queues that
+// share of the file at high priority, which downloads in the background.
+func Prefetch(ctx context.Context, cat, src string, fileIndex, pct int) (Prefetched, error) {
+	t, err := AddOrGetTorrent(GetClientFor(cat), src)
+	if err != nil {
+		return Prefetched{}, err
+	}
+	res := Prefetched{Torrent: t, FileIndex: -1}
+
+	mctx, cancel := context.WithTimeout(ctx, config.WaitMetadata())
+	defer cancel()
+	metaStart := time.Now()
+	if err := WaitForInfo(mctx, t); err != nil {
+		res.MetadataMs = time.Since(metaStart).Milliseconds()
+		log.Printf("[prefetch] cat=%s name=%q metadata TIMEOUT after %s", cat, t.Name(), time.Since(metaStart))
+		return res, ErrMetadataTimeout
+	}
+	res.MetadataMs = time.Since(metaStart).Milliseconds()
+	SetLastTouch(cat, t.InfoHash())
+
+	// subtitle files come first: they're small, typically <500KB
+	res.Subtitles = FindSubtitleFiles(t)
+	for _, sub := range res.Subtitles {
+		if sub.Index < 0 || sub.Index >= len(t.Files()) {
+			continue
+		}
+		subFile := t.Files()[sub.Index]
+		// only prebuffer subtitles up to 2MB
+		if subFile.Length() <= 2<<20 {
+			subRd := subFile.NewReader()
+			subRd.SetResponsive()
+			got := Prebuffer(subRd, subFile.Length(), 10*time.Second)
+			subRd.Close()
+			log.Printf("[prefetch] subtitle %s (%s) prebuffered %d/%d bytes",
+				sub.Name, sub.Lang, got, subFile.Length())
+		}
+	}
+
+	f, fidx := ChooseBestVideoFile(t)
+	if fileIndex >= 0 && fileIndex < len(t.Files()) {
+		f, fidx = t.Files()[fileIndex], fileIndex
+	}
+	if f == nil {
+		return res, nil
+	}
+	res.File, res.FileIndex = f, fidx
+
+	rd := f.NewReader()
+	defer rd.Close()
+	_, _ = rd.Seek(0, io.SeekStart)
+	readStart := time.Now()
+	res.PrebufferBytes = Prebuffer(rd, min(config.PrebufferBytes(), 512<<10), config.PrebufferTimeout())
+	res.PrebufferMs = time.Since(readStart).Milliseconds()
+	log.Printf("[prefetch] cat=%s ih=%s file=%d bytes=%d in %s",
+		cat, t.InfoHash().HexString(), fidx, res.PrebufferBytes, time.Since(readStart))
+
+	if pct > 0 {
+		PrioritizeFileRange(f, 0, f.Length()*int64(min(pct, 100))/100)
+	}
+	return res, nil
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"strconv"
 	"time"
 
+	"torrent-streamer/internal/config"
 	"torrent-streamer/pkg/types"
 )
 
@@ -27,6 +30,7 @@ type PickRow struct {
 	SourceKind   string
 	SizeBytes    *int64
 	ScoreJSON    []byte
+	ExplainJSON  []byte `json:"-"` // Explanation; see GetExplanation
 	PickedAt     time.Time
 	ReplacesPick *int64
 }
@@ -37,7 +41,7 @@ func (r *Repo) GetPick(ctx context.Context, seriesID string, season, episode int
 SELECT id, series_id, season, episode, profile_hash, infohash, magnet, release_group, resolution, codec, file_index,
        source_kind, size_bytes, score, picked_at, replaces_pick_id
 FROM picks
-WHERE series_id=$1 AND season=$2 AND episode=$3 AND profile_hash=$4`,
+WHERE series_id=$1 AND season=$2 AND episode=$3 AND profile_hash=$4 AND superseded_at IS NULL`,
 		seriesID, season, episode, profileHash).
 		Scan(&p.ID, &p.SeriesID, &p.Season, &p.Episode, &p.ProfileHash, &p.InfoHash, &p.Magnet, &p.ReleaseGroup,
 			&p.Resolution, &p.Codec, &p.FileIndex, &p.SourceKind, &p.SizeBytes, &p.ScoreJSON, &p.PickedAt, &p.ReplacesPick)
@@ -50,31 +54,173 @@ WHERE series_id=$1 AND season=$2 AND episode=$3 AND profile_hash=$4`,
 	return p, true, nil
 }
 
+// LatestPick returns the most recent pick for an episode across all profiles
+func (r *Repo) LatestPick(ctx context.Context, seriesID string, season, episode int) (PickRow, bool, error) {
+	var p PickRow
+	err := r.DB.QueryRowContext(ctx, `
+SELECT id, series_id, season, episode, profile_hash, infohash, magnet, release_group, resolution, codec, file_index,
+       source_kind, size_bytes, score, picked_at, replaces_pick_id
+FROM picks
+WHERE series_id=$1 AND season=$2 AND episode=$3 AND superseded_at IS NULL
+ORDER BY picked_at DESC LIMIT 1`,
+		seriesID, season, episode).
+		Scan(&p.ID, &p.SeriesID, &p.Season, &p.Episode, &p.ProfileHash, &p.InfoHash, &p.Magnet, &p.ReleaseGroup,
+			&p.Resolution, &p.Codec, &p.FileIndex, &p.SourceKind, &p.SizeBytes, &p.ScoreJSON, &p.PickedAt, &p.ReplacesPick)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PickRow{}, false, nil
+		}
+		return PickRow{}, false, err
+	}
+	return p, true, nil
+}
+
 func (r *Repo) InsertPick(ctx context.Context, p PickRow) (int64, error) {
+	return insertPick(ctx, r.DB, p)
+}
+
+// ErrPickChanged means the pick to replace was replaced (or re-made) meanwhile
+var ErrPickChanged = errors.New("pick changed")
+
+// ReplacePick retires old and stores p as its successor
+func (r *Repo) ReplacePick(ctx context.Context, old PickRow, p PickRow) (int64, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+UPDATE picks SET superseded_at=now(), updated_at=now()
+WHERE id=$1 AND infohash=$2 AND superseded_at IS NULL`, old.ID, old.InfoHash)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, ErrPickChanged
+	}
+	p.ReplacesPick = &old.ID
+	id, err := insertPick(ctx, tx, p)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// StalePicks returns current picks not checked for olderThan whose episode
+// someone is watching or is next up, leaving out episodes with progress
+// reported within quietFor (a session is playing them). Next up rolls over
+// to the next season's first episode after the last one the catalog lists.
+func (r *Repo) StalePicks(ctx context.Context, olderThan, quietFor time.Duration, limit int) ([]PickRow, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+SELECT p.id, p.series_id, p.season, p.episode, p.profile_hash, p.infohash, p.magnet, p.release_group, p.resolution,
+       p.codec, p.file_index, p.source_kind, p.size_bytes, p.score, p.picked_at, p.replaces_pick_id
+FROM picks p
+WHERE p.superseded_at IS NULL
+  AND COALESCE(p.checked_at, p.picked_at) < now() - $1 * interval '1 second'
+  AND EXISTS (SELECT 1 FROM watch_progress wp
+              WHERE wp.series_id=p.series_id AND wp.updated_at > now() - interval '30 days'
+                AND (wp.season=p.season AND (wp.episode=p.episode AND wp.percent < 95 OR wp.episode=p.episode-1)
+                     OR p.season=wp.season+1 AND p.episode=1
+                        AND EXISTS (SELECT 1 FROM episodes e
+                                    WHERE e.series_id=wp.series_id AND e.season=wp.season AND e.episode=wp.episode)
+                        AND NOT EXISTS (SELECT 1 FROM episodes e
+                                        WHERE e.series_id=wp.series_id AND e.season=wp.season AND e.episode>wp.episode)))
+  AND NOT EXISTS (SELECT 1 FROM watch_progress wp
+                  WHERE wp.series_id=p.series_id AND wp.season=p.season AND wp.episode=p.episode
+                    AND wp.updated_at > now() - $2 * interval '1 second')
+ORDER BY COALESCE(p.checked_at, p.picked_at)
+LIMIT $3`, int64(olderThan.Seconds()), int64(quietFor.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PickRow
+	for rows.Next() {
+		var p PickRow
+		if err := rows.Scan(&p.ID, &p.SeriesID, &p.Season, &p.Episode, &p.ProfileHash, &p.InfoHash, &p.Magnet, &p.ReleaseGroup,
+			&p.Resolution, &p.Codec, &p.FileIndex, &p.SourceKind, &p.SizeBytes, &p.ScoreJSON, &p.PickedAt, &p.ReplacesPick); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// MarkChecked records that a pick was revalidated and kept
+func (r *Repo) MarkChecked(ctx context.Context, id int64) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE picks SET checked_at=now() WHERE id=$1`, id)
+	return err
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertPick(ctx context.Context, db queryRower, p PickRow) (int64, error) {
 	var id int64
-	err := r.DB.QueryRowContext(ctx, `
+	err := db.QueryRowContext(ctx, `
 INSERT INTO picks (series_id, season, episode, profile_hash, infohash, magnet, release_group, resolution, codec,
-                   file_index, source_kind, size_bytes, score, picked_at, replaces_pick_id, created_at, updated_at)
-VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15, now(), now())
-ON CONFLICT (series_id, season, episode, profile_hash) DO UPDATE
+                   file_index, source_kind, size_bytes, score, explanation, picked_at, replaces_pick_id, created_at, updated_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16, now(), now())
+ON CONFLICT (series_id, season, episode, profile_hash) WHERE superseded_at IS NULL DO UPDATE
 SET infohash=EXCLUDED.infohash, magnet=EXCLUDED.magnet, release_group=EXCLUDED.release_group,
     resolution=EXCLUDED.resolution, codec=EXCLUDED.codec, file_index=EXCLUDED.file_index,
-    source_kind=EXCLUDED.source_kind, size_bytes=EXCLUDED.size_bytes, score=EXCLUDED.score,
-    picked_at=EXCLUDED.picked_at, replaces_pick_id=EXCLUDED.replaces_pick_id, updated_at=now()
+    source_kind=EXCLUDED.source_kind, size_bytes=EXCLUDED.size_bytes, score=EXCLUDED.score, explanation=EXCLUDED.explanation,
+    picked_at=EXCLUDED.picked_at, replaces_pick_id=EXCLUDED.replaces_pick_id, checked_at=NULL, updated_at=now()
 RETURNING id;`,
 		p.SeriesID, p.Season, p.Episode, p.ProfileHash, p.InfoHash, p.Magnet, p.ReleaseGroup, p.Resolution, p.Codec,
-		p.FileIndex, p.SourceKind, p.SizeBytes, p.ScoreJSON, p.PickedAt, p.ReplacesPick).
+		p.FileIndex, p.SourceKind, p.SizeBytes, p.ScoreJSON, nullJSON(p.ExplainJSON), p.PickedAt, p.ReplacesPick).
 		Scan(&id)
 	return id, err
 }
 
+// GetExplanation returns how a pick was chosen, if that was recorded
+func (r *Repo) GetExplanation(ctx context.Context, pickID int64) (Explanation, bool, error) {
+	var raw []byte
+	err := r.DB.QueryRowContext(ctx, `SELECT explanation FROM picks WHERE id=$1`, pickID).Scan(&raw)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Explanation{}, false, nil
+		}
+		return Explanation{}, false, err
+	}
+	if raw == nil {
+		return Explanation{}, false, nil
+	}
+	var ex Explanation
+	if err := json.Unmarshal(raw, &ex); err != nil {
+		return Explanation{}, false, err
+	}
+	return ex, true, nil
+}
+
+// nullJSON stores an empty document as NULL
+func nullJSON(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
 func searchKey(seriesID string, season, episode int, profileHash string) string {
 	return seriesID + "|S" + strconv.Itoa(season) + "E" + strconv.Itoa(episode) + "|" + profileHash
 }
 
+// GetSearchCache returns unexpired search results for key. An empty hit is
+// a cached miss: the episode was searched recently and nothing was found.
 func (r *Repo) GetSearchCache(ctx context.Context, key string) ([]types.Candidate, bool, error) {
+	return r.getSearchCache(ctx, key, true)
+}
+
+// LastSearch returns the latest search results for key, expired or not
+func (r *Repo) LastSearch(ctx context.Context, key string) ([]types.Candidate, bool, error) {
+	return r.getSearchCache(ctx, key, false)
+}
+
+func (r *Repo) getSearchCache(ctx context.Context, key string, fresh bool) ([]types.Candidate, bool, error) {
 	var raw []byte
-	err := r.DB.QueryRowContext(ctx, `SELECT candidates FROM search_cache WHERE key=$1`, key).Scan(&raw)
+	err := r.DB.QueryRowContext(ctx, `
+SELECT candidates FROM search_cache WHERE key=$1 AND (NOT $2 OR expires_at > now())`, key, fresh).Scan(&raw)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, false, nil
@@ -86,10 +232,68 @@ func (r *Repo) GetSearchCache(ctx context.Context, key string) ([]types.Candidat
 	return out, true, nil
 }
 
-func (r *Repo) PutSearchCache(ctx context.Context, key string, cands []types.Candidate) error {
+// PutSearchCache stores search results for the kind's TTL. Empty results
+// are kept for the miss TTL, doubled for every miss in a row, so episodes
+// that haven't aired are not searched on every request.
+func (r *Repo) PutSearchCache(ctx context.Context, key, seriesID, kind string, cands []types.Candidate) error {
+	if cands == nil {
+		cands = []types.Candidate{}
+	}
 	raw, _ := json.Marshal(cands)
+	miss := len(cands) == 0
+	ttl := config.SearchCacheTTL(kind)
+	if miss {
+		ttl = config.SearchMissTTL()
+	}
 	_, err := r.DB.ExecContext(ctx, `
-INSERT INTO search_cache (key, candidates, fetched_at) VALUES ($1,$2,now())
-ON CONFLICT (key) DO UPDATE SET candidates=EXCLUDED.candidates, fetched_at=now()`, key, raw)
+INSERT INTO search_cache AS sc (key, series_id, kind, candidates, fetched_at, misses, expires_at)
+VALUES ($1,$2,$3,$4, now(), CASE WHEN $5 THEN 1 ELSE 0 END, now() + $6 * interval '1 second')
+ON CONFLICT (key) DO UPDATE
+SET series_id=EXCLUDED.series_id, kind=EXCLUDED.kind, candidates=EXCLUDED.candidates, fetched_at=now(),
+    misses = CASE WHEN $5 THEN sc.misses+1 ELSE 0 END,
+    expires_at = now() + CASE WHEN $5 THEN LEAST($6 * power(2, sc.misses), $7) ELSE $6 END * interval '1 second'`,
+		key, seriesID, kind, raw, miss, int64(ttl.Seconds()), int64(config.SearchMissMax().Seconds()))
 	return err
 }
+
+// SweepSearchCache deletes results expired for longer than keep; misses are
+// kept that long so their backoff survives
+func (r *Repo) SweepSearchCache(ctx context.Context, keep time.Duration) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+DELETE FROM search_cache WHERE expires_at < now() - $1 * interval '1 second'`, int64(keep.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PurgeSearchCache drops every cached search for a series
+func (r *Repo) PurgeSearchCache(ctx context.Context, seriesID string) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM search_cache WHERE series_id=$1`, seriesID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunSearchCacheSweeper sweeps the search cache every interval until ctx ends
+func (r *Repo) RunSearchCacheSweeper(ctx context.Context, every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := r.SweepSearchCache(ctx, config.SearchMissMax())
+			if err != nil {
+				log.Printf("[search] cache sweep: %v", err)
+			} else if n > 0 {
+				log.Printf("[search] cache sweep removed %d entries", n)
+			}
+		}
+	}
+}
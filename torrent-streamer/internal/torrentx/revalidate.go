@@ -0,0 +1,197 @@
+package torrentx
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"torrent-streamer/internal/scoring"
+	"torrent-streamer/pkg/types"
+)
+
+// a fresh candidate must beat the pick's current score by this much to
+// replace it; smaller differences are seeder counts moving about
+const replaceMargin = 0.1
+
+// Revalidator re-checks the picks of episodes being watched or up next: once
+// a pick is TTL old it is compared against a fresh search and replaced when
+// its swarm died, a PROPER of it came out or something markedly better did.
+// Episodes that are playing are left alone.
+type Revalidator struct {
+	Deps  EnsureDeps
+	TTL   time.Duration
+	Quiet time.Duration // progress reported this recently means a session is on the episode
+	Batch int           // picks checked per round
+	// Active reports whether a session holds the torrent (optional)
+	Active func(infohash string) bool
+	// Swarm checks a pick's swarm before it is called dead (see SwarmSeeders)
+	Swarm func(ctx context.Context, magnet string) (seeders int, known bool)
+}
+
+func NewRevalidator(d EnsureDeps, ttl time.Duration, active func(infohash string) bool) *Revalidator {
+	return &Revalidator{Deps: d, TTL: ttl, Quiet: 10 * time.Minute, Batch: 20, Active: active, Swarm: SwarmSeeders}
+}
+
+// Run checks a batch of stale picks every interval until ctx ends
+func (v *Revalidator) Run(ctx context.Context, every time.Duration) {
+	if every <= 0 || v.TTL <= 0 {
+		return
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			v.Once(ctx)
+		}
+	}
+}
+
+// Once checks one batch of stale picks
+func (v *Revalidator) Once(ctx context.Context) {
+	picks, err := v.Deps.Repo.StalePicks(ctx, v.TTL, v.Quiet, v.Batch)
+	if err != nil {
+		log.Printf("[picks] stale picks: %v", err)
+		return
+	}
+	for _, p := range picks {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := v.check(ctx, p); err != nil {
+			log.Printf("[picks] revalidate %s S%02dE%02d: %v", p.SeriesID, p.Season, p.Episode, err)
+		}
+	}
+}
+
+// busy reports whether the pick's torrent is being played
+func (v *Revalidator) busy(p PickRow) bool {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(p.InfoHash); err == nil && Streaming(ih) {
+		return true
+	}
+	return v.Active != nil && v.Active(p.InfoHash)
+}
+
+// swarm asks v.Swarm, if set, for the seeders of a pick's torrent
+func (v *Revalidator) swarm(ctx context.Context, magnet string) (int, bool) {
+	if v.Swarm == nil {
+		return 0, false
+	}
+	return v.Swarm(ctx, magnet)
+}
+
+func (v *Revalidator) check(ctx context.Context, p PickRow) error {
+	repo := v.Deps.Repo
+	// made under older scoring rules: EnsurePick makes a new pick anyway
+	if scoring.ProfileKey(p.ProfileHash) != p.ProfileHash {
+		return repo.MarkChecked(ctx, p.ID)
+	}
+	if v.busy(p) {
+		return nil
+	}
+	ex, ok, err := repo.GetExplanation(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if !ok || ex.Query.Title == "" && ex.Query.IMDbID == "" && ex.Query.TVDbID == "" {
+		// picked before queries were recorded; nothing to search with
+		return repo.MarkChecked(ctx, p.ID)
+	}
+	var picked types.Candidate
+	for _, r := range ex.Candidates {
+		if r.Picked {
+			picked = r.Candidate
+		}
+	}
+
+	q := ex.Query
+	in := EnsureInput{
+		SeriesID: p.SeriesID, SeriesTitle: q.Title, Kind: q.Kind,
+		Season: p.Season, Episode: p.Episode, AbsEpisode: q.AbsEpisode,
+		IMDbID: q.IMDbID, TVDbID: q.TVDbID,
+		ProfileHash: p.ProfileHash, ProfileCaps: ex.Caps, EstRuntimeMin: ex.EstRuntimeMin,
+	}
+	prof := scoring.Active()
+	hist := LoadHistory(ctx, repo, p.SeriesID, p.Season, p.Episode, p.ProfileHash)
+	found, err := v.Deps.Search.Search(ctx, in.query())
+	if err != nil {
+		return err
+	}
+	_ = repo.PutSearchCache(ctx, searchKey(p.SeriesID, p.Season, p.Episode, p.ProfileHash), p.SeriesID, q.Kind, found)
+	ranked := Rank(found, in.ProfileCaps, in.EstRuntimeMin, hist, prof)
+
+	// the pick as the indexers list it now; links only match by name
+	cur := -1
+	for i, r := range ranked {
+		if strings.EqualFold(r.Candidate.InfoHash, p.InfoHash) || r.Candidate.InfoHash == "" && picked.Title != "" && r.Candidate.Title == picked.Title {
+			cur = i
+			break
+		}
+	}
+	// indexers lag and drop listings: the swarm itself decides whether the
+	// pick is dead, and a pick that is no longer listed is only dead when
+	// the swarm confirms it
+	var curScore types.ScoreBreakdown
+	dead := false
+	switch {
+	case cur >= 0:
+		picked, curScore = ranked[cur].Candidate, ranked[cur].Score
+		if picked.Seeders == 0 {
+			n, known := v.swarm(ctx, p.Magnet)
+			dead = !known || n == 0
+		}
+	case picked.Title != "":
+		if n, known := v.swarm(ctx, p.Magnet); known {
+			picked.Seeders, dead = n, n == 0
+		}
+		curScore = scoring.Score(picked, in.ProfileCaps, in.EstRuntimeMin, hist, prof)
+	}
+
+	// chooseBest reorders ranked, so the listing matched by name is found by name again
+	best := chooseBest(ctx, ranked, in, hist, prof)
+	if best < 0 || strings.EqualFold(ranked[best].Candidate.InfoHash, p.InfoHash) ||
+		cur >= 0 && picked.InfoHash == "" && ranked[best].Candidate.Title == picked.Title {
+		return repo.MarkChecked(ctx, p.ID)
+	}
+	b := ranked[best]
+	var why string
+	switch {
+	case b.Candidate.Proper && !picked.Proper && picked.ReleaseGroup != "" &&
+		strings.EqualFold(b.Candidate.ReleaseGroup, picked.ReleaseGroup) && b.Candidate.Resolution == picked.Resolution:
+		why = "proper"
+	case dead && b.Candidate.Seeders > 0:
+		why = "dead swarm"
+	case b.Score.Total >= curScore.Total+replaceMargin:
+		why = "better candidate"
+	default:
+		return repo.MarkChecked(ctx, p.ID)
+	}
+	// a session may have started while searching
+	if v.busy(p) {
+		return nil
+	}
+
+	row := pickRow(in, ranked, best, hist, prof)
+	id, err := repo.ReplacePick(ctx, p, row)
+	if errors.Is(err, ErrPickChanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[picks] replaced %s S%02dE%02d pick %d with %d (%s): %q %.3f → %q %.3f",
+		p.SeriesID, p.Season, p.Episode, p.ID, id, why, picked.Title, curScore.Total, b.Candidate.Title, b.Score.Total)
+	if p.ReleaseGroup != nil && !strings.EqualFold(*p.ReleaseGroup, b.Candidate.ReleaseGroup) {
+		if err := repo.WeakenGroup(ctx, p.SeriesID, *p.ReleaseGroup, p.Season, p.Episode); err != nil {
+			log.Printf("[picks] group preference %s: %v", p.SeriesID, err)
+		}
+	}
+	return nil
+}
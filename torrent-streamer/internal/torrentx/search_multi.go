@@ -0,0 +1,243 @@
+package torrentx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"torrent-streamer/pkg/types"
+)
+
+// Searcher finds release candidates for an episode or movie
+type Searcher interface {
+	Search(ctx context.Context, q SearchQuery) ([]types.Candidate, error)
+}
+
+// ErrAllIndexersFailed is returned when no indexer could be queried
+var ErrAllIndexersFailed = errors.New("all indexers failed or are circuit-broken")
+
+// circuit breaker: after breakerFails consecutive failures an indexer is
+// skipped for breakerCooldown, doubling per failed retry up to breakerMaxCooldown
+const (
+	breakerFails       = 5
+	breakerCooldown    = time.Minute
+	breakerMaxCooldown = 30 * time.Minute
+)
+
+// IndexerHealth is the running record of one indexer
+type IndexerHealth struct {
+	Name             string    `json:"name"`
+	Requests         int64     `json:"requests"`
+	Errors           int64     `json:"errors"`
+	ErrorRate        float64   `json:"errorRate"`
+	AvgLatencyMs     float64   `json:"avgLatencyMs"` // moving average
+	LastLatencyMs    int64     `json:"lastLatencyMs"`
+	LastError        string    `json:"lastError,omitempty"`
+	ConsecutiveFails int       `json:"consecutiveFails"`
+	OpenUntil        time.Time `json:"openUntil,omitzero"` // circuit open (skipped) until
+}
+
+type indexer struct {
+	name    string
+	s       Searcher
+	timeout time.Duration
+
+	mu       sync.Mutex
+	h        IndexerHealth
+	cooldown time.Duration
+	trial    bool // a half-open probe is in flight
+}
+
+// allow reports whether the indexer may be queried now; once the cooldown
+// has passed a single probe request is let through
+func (ix *indexer) allow(now time.Time) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.h.OpenUntil.IsZero() {
+		return true
+	}
+	if now.Before(ix.h.OpenUntil) || ix.trial {
+		return false
+	}
+	ix.trial = true
+	return true
+}
+
+func (ix *indexer) record(latency time.Duration, err error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.trial = false
+	ms := latency.Milliseconds()
+	ix.h.Requests++
+	ix.h.LastLatencyMs = ms
+	if ix.h.AvgLatencyMs == 0 {
+		ix.h.AvgLatencyMs = float64(ms)
+	} else {
+		ix.h.AvgLatencyMs = 0.8*ix.h.AvgLatencyMs + 0.2*float64(ms)
+	}
+	if err == nil {
+		ix.h.ConsecutiveFails = 0
+		ix.h.OpenUntil = time.Time{}
+		ix.cooldown = 0
+	} else {
+		ix.h.Errors++
+		ix.h.LastError = err.Error()
+		ix.h.ConsecutiveFails++
+		if ix.h.ConsecutiveFails >= breakerFails {
+			switch {
+			case ix.cooldown == 0:
+				ix.cooldown = breakerCooldown
+			case ix.cooldown < breakerMaxCooldown:
+				ix.cooldown = min(2*ix.cooldown, breakerMaxCooldown)
+			}
+			ix.h.OpenUntil = time.Now().Add(ix.cooldown)
+			log.Printf("[search] indexer %s circuit open for %s after %d failures: %v", ix.name, ix.cooldown, ix.h.ConsecutiveFails, err)
+		}
+	}
+	ix.h.ErrorRate = float64(ix.h.Errors) / float64(ix.h.Requests)
+}
+
+func (ix *indexer) health() IndexerHealth {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.h
+}
+
+// MultiSearcher fans a search out to several indexers in parallel and merges
+// the results, deduplicated by infohash
+type MultiSearcher struct {
+	mu       sync.RWMutex
+	indexers []*indexer
+}
+
+func NewMultiSearcher() *MultiSearcher { return &MultiSearcher{} }
+
+// Add registers an indexer; each query to it is bounded by timeout (0 = caller's context only)
+func (m *MultiSearcher) Add(name string, s Searcher, timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indexers = append(m.indexers, &indexer{name: name, s: s, timeout: timeout, h: IndexerHealth{Name: name}})
+}
+
+// Len is the number of registered indexers
+func (m *MultiSearcher) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.indexers)
+}
+
+// Health returns every indexer's record in registration order
+func (m *MultiSearcher) Health() []IndexerHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]IndexerHealth, len(m.indexers))
+	for i, ix := range m.indexers {
+		out[i] = ix.health()
+	}
+	return out
+}
+
+// Search queries all indexers whose circuit is closed. It fails only when
+// none of them answered.
+func (m *MultiSearcher) Search(ctx context.Context, q SearchQuery) ([]types.Candidate, error) {
+	m.mu.RLock()
+	indexers := append([]*indexer(nil), m.indexers...)
+	m.mu.RUnlock()
+
+	results := make([][]types.Candidate, len(indexers))
+	errs := make([]error, len(indexers))
+	now := time.Now()
+	var wg sync.WaitGroup
+	for i, ix := range indexers {
+		if !ix.allow(now) {
+			errs[i] = fmt.Errorf("%s: circuit open", ix.name)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, ix *indexer) {
+			defer wg.Done()
+			ictx := ctx
+			if ix.timeout > 0 {
+				var cancel context.CancelFunc
+				ictx, cancel = context.WithTimeout(ctx, ix.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			res, err := ix.s.Search(ictx, q)
+			// the caller giving up says nothing about the indexer
+			if ctx.Err() == nil {
+				ix.record(time.Since(start), err)
+			} else {
+				ix.mu.Lock()
+				ix.trial = false
+				ix.mu.Unlock()
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", ix.name, err)
+				return
+			}
+			results[i] = res
+		}(i, ix)
+	}
+	wg.Wait()
+
+	ok := false
+	for i := range indexers {
+		if errs[i] == nil {
+			ok = true
+		}
+	}
+	if !ok {
+		if len(indexers) == 0 {
+			return nil, ErrAllIndexersFailed
+		}
+		return nil, fmt.Errorf("%w: %w", ErrAllIndexersFailed, errors.Join(errs...))
+	}
+	return dedupCandidates(results), nil
+}
+
+// dedupCandidates merges per-indexer results. The same torrent listed by
+// several indexers is kept once, with the highest seeder count seen and any
+// details the first listing lacked.
+func dedupCandidates(results [][]types.Candidate) []types.Candidate {
+	var out []types.Candidate
+	seen := map[string]int{}
+	for _, res := range results {
+		for _, c := range res {
+			c.InfoHash = strings.ToLower(c.InfoHash)
+			key := c.InfoHash
+			if key == "" {
+				// HTTP .torrent links have no hash yet; the link is the identity
+				key = "link:" + c.Magnet
+			}
+			i, dup := seen[key]
+			if !dup {
+				seen[key] = len(out)
+				out = append(out, c)
+				continue
+			}
+			have := &out[i]
+			if c.Seeders > have.Seeders {
+				have.Seeders, have.Leechers = c.Seeders, c.Leechers
+			}
+			if !strings.HasPrefix(strings.ToLower(have.Magnet), "magnet:") && strings.HasPrefix(strings.ToLower(c.Magnet), "magnet:") {
+				have.Magnet = c.Magnet
+			}
+			if have.SizeBytes <= 0 {
+				have.SizeBytes = c.SizeBytes
+			}
+			if have.Files == 0 {
+				have.Files = c.Files
+			}
+			have.Grabs = max(have.Grabs, c.Grabs)
+			if have.TVDbID == "" {
+				have.TVDbID = c.TVDbID
+			}
+		}
+	}
+	return out
+}
@@ -1,7 +1,10 @@
 package torrentx
 
 import (
+	"context"
 	"encoding/xml"
+	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -10,68 +13,194 @@ import (
 	"torrent-streamer/pkg/types"
 )
 
+// TorznabClient searches a Torznab endpoint. BaseURL is either a Prowlarr
+// root (the all-indexers aggregate path is appended) or a full Torznab API
+// URL such as Jackett's .../api/v2.0/indexers/all/results/torznab/api.
 type TorznabClient struct {
 	BaseURL string // e.g. http://localhost:9696
 	APIKey  string
 	HTTP    *http.Client
+
+	caps capsCache
+}
+
+// SearchQuery is what EnsurePick searches for. The ids let indexers that
+// support t=tvsearch / t=movie match exactly instead of by title.
+type SearchQuery struct {
+	Title           string
+	Kind            string // movie|tv|anime
+	Season, Episode int
+	AbsEpisode      *int
+	IMDbID          string // tt1234567
+	TVDbID          string
 }
 
+// torznabFeed is a results document, or an <error code description> one
+// when the indexer refused the query
 type torznabFeed struct {
-	Channel struct {
-		Items []struct {
-			Title   string `xml:"title"`
-			Link    string `xml:"link"`
-			Size    int64  `xml:"size"`
-			Seeders int    `xml:"seeders"`
-			Peers   int    `xml:"peers"`
-		} `xml:"item"`
+	XMLName     xml.Name
+	Code        string `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+	Channel     struct {
+		Items []torznabItem `xml:"item"`
 	} `xml:"channel"`
 }
 
-func (c *TorznabClient) Query(title string, season, episode int, abs *int) ([]types.Candidate, error) {
-	q := title
-	if abs != nil {
-		q = title + " " + pad2(*abs)
-	} else if season == 0 && episode == 0 {
-		q = title
-	} else {
-		q = title + " S" + pad2(season) + "E" + pad2(episode)
+// Search picks the most specific search function the indexer supports:
+// t=tvsearch with season/ep and tvdbid/imdbid for episodes, t=movie with
+// imdbid for movies, else t=search with a "Title SxxEyy" text query. Results
+// are limited to the kind's categories. A structured search that finds
+// nothing is retried as text, since indexers don't know every id.
+func (c *TorznabClient) Search(ctx context.Context, sq SearchQuery) ([]types.Candidate, error) {
+	caps, err := c.Caps(ctx)
+	if err != nil && caps == nil {
+		log.Printf("[search] torznab caps unavailable, using text search: %v", err)
+	}
+
+	params, structured := c.structuredParams(caps, sq)
+	if structured {
+		out, err := c.query(ctx, params, sq)
+		if err == nil && len(out) > 0 {
+			return out, nil
+		}
+		if err != nil {
+			log.Printf("[search] %s failed, falling back to text: %v", params.Get("t"), err)
+		}
+	}
+	return c.query(ctx, c.textParams(caps, sq), sq)
+}
+
+// structuredParams builds a t=tvsearch / t=movie request when caps allow one
+func (c *TorznabClient) structuredParams(caps *TorznabCaps, sq SearchQuery) (url.Values, bool) {
+	if caps == nil {
+		return nil, false
+	}
+	v := url.Values{}
+	if cats := caps.CategoriesFor(sq.Kind); len(cats) > 0 {
+		v.Set("cat", joinInts(cats))
+	}
+	imdb := strings.TrimPrefix(strings.ToLower(sq.IMDbID), "tt")
+
+	if sq.Kind == "movie" {
+		m := caps.MovieSearch
+		if !m.Available {
+			return nil, false
+		}
+		v.Set("t", "movie")
+		switch {
+		case imdb != "" && m.Supports("imdbid"):
+			v.Set("imdbid", imdb)
+		case m.Supports("q"):
+			v.Set("q", sq.Title)
+		default:
+			return nil, false
+		}
+		return v, true
+	}
+
+	m := caps.TVSearch
+	// absolute anime numbering has no tvsearch equivalent
+	if !m.Available || sq.AbsEpisode != nil {
+		return nil, false
+	}
+	v.Set("t", "tvsearch")
+	hasID := false
+	if sq.TVDbID != "" && m.Supports("tvdbid") {
+		v.Set("tvdbid", sq.TVDbID)
+		hasID = true
+	}
+	if imdb != "" && m.Supports("imdbid") {
+		v.Set("imdbid", imdb)
+		hasID = true
+	}
+	q := ""
+	if !hasID {
+		if !m.Supports("q") {
+			return nil, false
+		}
+		q = sq.Title
+	}
+	if sq.Season > 0 || sq.Episode > 0 {
+		if m.Supports("season") {
+			v.Set("season", strconv.Itoa(sq.Season))
+			if m.Supports("ep") && sq.Episode > 0 {
+				v.Set("ep", strconv.Itoa(sq.Episode))
+			}
+		} else {
+			if !m.Supports("q") {
+				return nil, false
+			}
+			q = strings.TrimSpace(q + " S" + pad2(sq.Season) + "E" + pad2(sq.Episode))
+		}
+	}
+	if q != "" {
+		v.Set("q", q)
+	}
+	return v, true
+}
+
+// textParams is the t=search fallback
+func (c *TorznabClient) textParams(caps *TorznabCaps, sq SearchQuery) url.Values {
+	q := sq.Title
+	if sq.AbsEpisode != nil {
+		q = sq.Title + " " + pad2(*sq.AbsEpisode)
+	} else if sq.Season != 0 || sq.Episode != 0 {
+		q = sq.Title + " S" + pad2(sq.Season) + "E" + pad2(sq.Episode)
 	}
-	u, _ := url.Parse(c.BaseURL)
-	u.Path = "/api/v1/indexers/all/results/torznab/api"
 	v := url.Values{}
-	v.Set("apikey", c.APIKey)
 	v.Set("t", "search")
 	v.Set("q", q)
+	if cats := caps.CategoriesFor(sq.Kind); len(cats) > 0 {
+		v.Set("cat", joinInts(cats))
+	}
+	return v
+}
+
+func (c *TorznabClient) endpoint(v url.Values) string {
+	u, _ := url.Parse(c.BaseURL)
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/api/v1/indexers/all/results/torznab/api"
+	}
+	v.Set("apikey", c.APIKey)
 	u.RawQuery = v.Encode()
+	return u.String()
+}
 
-	req, _ := http.NewRequest("GET", u.String(), nil)
+func (c *TorznabClient) query(ctx context.Context, v url.Values, sq SearchQuery) ([]types.Candidate, error) {
+	items, err := c.fetch(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]types.Candidate, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.candidate(sq))
+	}
+	return out, nil
+}
+
+func (c *TorznabClient) fetch(ctx context.Context, v url.Values) ([]torznabItem, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint(v), nil)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	// errors must not pass for an empty result, which gets cached as a miss
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("torznab: HTTP %d", resp.StatusCode)
+	}
 
 	var feed torznabFeed
 	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
 		return nil, err
 	}
-
-	var out []types.Candidate
-	for _, it := range feed.Channel.Items {
-		ih, magnet := parseLink(it.Link)
-		out = append(out, types.Candidate{
-			InfoHash: ih, Magnet: magnet, Title: it.Title,
-			ReleaseGroup: pickGroup(it.Title),
-			Resolution:   pickRes(it.Title),
-			Codec:        pickCodec(it.Title),
-			Source:       pickSource(it.Title),
-			Seeders:      it.Seeders, Leechers: it.Peers, SizeBytes: it.Size,
-			ParsedSeason: season, ParsedEpisode: episode,
-			SourceKind: "single",
-		})
+	if feed.XMLName.Local == "error" {
+		return nil, fmt.Errorf("torznab error %s: %s", feed.Code, feed.Description)
 	}
-	return out, nil
+	return feed.Channel.Items, nil
 }
 
 func pad2(n int) string {
@@ -80,54 +209,6 @@ func pad2(n int) string {
 	}
 	return strconv.Itoa(n)
 }
-func pickRes(t string) string {
-	t = strings.ToLower(t)
-	for _, k := range []string{"2160p", "1080p", "720p", "480p"} {
-		if strings.Contains(t, k) {
-			return k
-		}
-	}
-	return "1080p"
-}
-func pickCodec(t string) string {
-	t = strings.ToLower(t)
-	for _, k := range []string{"av1", "x265", "hevc", "x264", "h264", "hi10p"} {
-		if strings.Contains(t, k) {
-			if k == "x265" {
-				return "hevc"
-			}
-			if k == "x264" {
-				return "h264"
-			}
-			return k
-		}
-	}
-	return "h264"
-}
-func pickSource(t string) string {
-	t = strings.ToLower(t)
-	if strings.Contains(t, "web-dl") {
-		return "WEB-DL"
-	}
-	if strings.Contains(t, "webrip") {
-		return "WEBRip"
-	}
-	if strings.Contains(t, "hdtv") {
-		return "HDTV"
-	}
-	if strings.Contains(t, "bluray") {
-		return "BluRay"
-	}
-	return "WEBRip"
-}
-func pickGroup(t string) string {
-	parts := strings.Split(t, "-")
-	if len(parts) > 1 {
-		return strings.TrimSpace(parts[len(parts)-1])
-	}
-	return ""
-}
-
 func parseLink(link string) (string, string) {
 	l := strings.ToLower(link)
 	if strings.HasPrefix(l, "magnet:") {
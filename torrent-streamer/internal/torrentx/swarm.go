@@ -0,0 +1,74 @@
+package torrentx
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// trackers asked per swarm check, and how long each may take
+const (
+	maxScrapeTrackers = 6
+	scrapeTimeout     = 10 * time.Second
+)
+
+// SwarmSeeders reports how many seeders a torrent has right now: the peers
+// connected to it when a client has it loaded, else the most any of its
+// trackers (and the configured ones) report on scrape. known is false when
+// nothing answered, which says nothing about the swarm either way.
+func SwarmSeeders(ctx context.Context, magnet string) (seeders int, known bool) {
+	m, err := metainfo.ParseMagnetURI(magnet)
+	if err != nil || m.InfoHash == (metainfo.Hash{}) {
+		return 0, false
+	}
+	if n := connectedSeeders(m.InfoHash); n > 0 {
+		return n, true
+	}
+
+	urls := slices.Clone(m.Trackers)
+	for _, tier := range buildTrackerTiers() {
+		urls = append(urls, tier...)
+	}
+	asked := 0
+	for _, u := range urls {
+		if asked >= maxScrapeTrackers || ctx.Err() != nil {
+			break
+		}
+		cl, err := tracker.NewClient(u, tracker.NewClientOpts{})
+		if err != nil {
+			continue
+		}
+		asked++
+		sctx, cancel := context.WithTimeout(ctx, scrapeTimeout)
+		res, err := cl.Scrape(sctx, []metainfo.Hash{m.InfoHash})
+		cancel()
+		_ = cl.Close()
+		if err != nil || len(res) == 0 {
+			continue
+		}
+		seeders, known = max(seeders, int(res[0].Seeders)), true
+		if seeders > 0 {
+			break
+		}
+	}
+	return seeders, known
+}
+
+// connectedSeeders counts seeders connected to the torrent in any client
+func connectedSeeders(ih metainfo.Hash) int {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	n := 0
+	for _, cl := range clients {
+		if cl == nil {
+			continue
+		}
+		if t, ok := cl.Torrent(ih); ok {
+			n += t.Stats().ConnectedSeeders
+		}
+	}
+	return n
+}
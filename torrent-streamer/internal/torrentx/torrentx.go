@@ -5,11 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"mime"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -83,6 +81,19 @@ func DecActive(cat string, ih metainfo.Hash) {
 	activeMu.Unlock()
 }
 
+// Streaming reports whether a reader is open on the torrent in any category
+func Streaming(ih metainfo.Hash) bool {
+	suffix := ":" + ih.HexString()
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	for k, n := range activeStreams {
+		if n > 0 && strings.HasSuffix(k, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
 func mayDrop(cat string, ih metainfo.Hash) bool {
 	k := key(cat, ih)
 
@@ -275,6 +286,15 @@ func AddOrGetTorrent(cl *torrent.Client, src string) (*torrent.Torrent, error) {
 		}
 	}
 	if strings.HasPrefix(src, "magnet:") {
+		// a stored .torrent (from resolving an indexer link) skips the metadata exchange
+		if mi, ok := loadStoredMetainfo(mustParseMagnet(src)); ok {
+			if t, err := cl.AddTorrent(mi); err == nil {
+				if tiers := buildTrackerTiers(); len(tiers) != 0 {
+					t.AddTrackers(tiers)
+				}
+				return t, nil
+			}
+		}
 		t, err := cl.AddMagnet(src)
 		if err != nil {
 			return nil, err
@@ -295,35 +315,13 @@ func AddOrGetTorrent(cl *torrent.Client, src string) (*torrent.Torrent, error) {
 func addTorrentFromURL(cl *torrent.Client, torrentURL string) (*torrent.Torrent, error) {
 	log.Printf("[torrent] fetching torrent from URL: %s", torrentURL)
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
+	torrentData, err := fetchTorrentFile(context.Background(), torrentURL)
+	var mr *magnetRedirect
+	if errors.As(err, &mr) {
+		return AddOrGetTorrent(cl, mr.Magnet)
 	}
-
-	resp, err := httpClient.Get(torrentURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch torrent URL: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("torrent URL returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Read the torrent file data
-	torrentData, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read torrent data: %w", err)
-	}
-
-	// Validate it looks like a torrent file (bencode starts with 'd')
-	if len(torrentData) < 2 || torrentData[0] != 'd' {
-		// Probably HTML or error page
-		preview := string(torrentData)
-		if len(preview) > 200 {
-			preview = preview[:200]
-		}
-		return nil, fmt.Errorf("response is not a valid torrent file (got %d bytes starting with: %q)", len(torrentData), preview)
+		return nil, err
 	}
 
 	// Parse the metainfo
@@ -334,6 +332,7 @@ func addTorrentFromURL(cl *torrent.Client, torrentURL string) (*torrent.Torrent,
 
 	// Check if torrent already exists
 	ih := mi.HashInfoBytes()
+	storeMetainfo(ih, torrentData)
 	if t, ok := cl.Torrent(ih); ok {
 		log.Printf("[torrent] torrent already exists: %s", ih.HexString())
 		return t, nil
@@ -602,7 +601,8 @@ type SubtitleFile struct {
 	Name     string `json:"name"`
 	Length   int64  `json:"length"`
 	Lang     string `json:"lang"`
-	Ext      string `json:"ext"` // "srt", "vtt", "ass", "ssa"
+	Ext      string `json:"ext"`                // "srt", "vtt", "ass", "ssa"
+	Encoding string `json:"encoding,omitempty"` // detected charset, set once the file is downloaded
 }
 
 // FindSubtitleFiles returns all subtitle files found in the torrent
@@ -680,3 +680,39 @@ func DetectLanguage(filename string) string {
 	// Default to unknown
 	return "und"
 }
+
+// FileRangeComplete reports whether bytes [off, off+n) of f are fully downloaded
+func FileRangeComplete(f *torrent.File, off, n int64) bool {
+	t := f.Torrent()
+	info := t.Info()
+	if info == nil || info.PieceLength <= 0 {
+		return false
+	}
+	if n <= 0 {
+		return true
+	}
+	start := f.Offset() + off
+	end := start + n - 1
+	for p := int(start / info.PieceLength); p <= int(end/info.PieceLength); p++ {
+		if p >= t.NumPieces() || t.PieceBytesMissing(p) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// PrioritizeFileRange raises the pieces covering bytes [off, off+n) of f to high priority
+func PrioritizeFileRange(f *torrent.File, off, n int64) {
+	t := f.Torrent()
+	info := t.Info()
+	if info == nil || info.PieceLength <= 0 || n <= 0 {
+		return
+	}
+	start := f.Offset() + off
+	end := start + n - 1
+	for p := int(start / info.PieceLength); p <= int(end/info.PieceLength) && p < t.NumPieces(); p++ {
+		if t.PieceBytesMissing(p) != 0 {
+			t.Piece(p).SetPriority(torrent.PiecePriorityHigh)
+		}
+	}
+}
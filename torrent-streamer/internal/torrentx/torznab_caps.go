@@ -0,0 +1,195 @@
+package torrentx
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long discovered capabilities are trusted; failures are retried sooner
+const (
+	capsTTL      = 6 * time.Hour
+	capsRetryTTL = 5 * time.Minute
+)
+
+// Newznab standard categories, used when an indexer's caps don't list any
+const (
+	catMovies = 2000
+	catTV     = 5000
+	catAnime  = 5070
+)
+
+// SearchMode is one of the t= functions an indexer supports, with the
+// parameters it accepts
+type SearchMode struct {
+	Available bool
+	Params    map[string]bool // q, season, ep, imdbid, tvdbid, ...
+}
+
+func (m SearchMode) Supports(param string) bool { return m.Available && m.Params[param] }
+
+// TorznabCaps is the parsed t=caps response
+type TorznabCaps struct {
+	Search      SearchMode
+	TVSearch    SearchMode
+	MovieSearch SearchMode
+	// category ids per kind (movie|tv|anime), subcategories included
+	Categories map[string][]int
+	FetchedAt  time.Time
+}
+
+type capsDoc struct {
+	Searching struct {
+		Search      capsMode `xml:"search"`
+		TVSearch    capsMode `xml:"tv-search"`
+		MovieSearch capsMode `xml:"movie-search"`
+	} `xml:"searching"`
+	Categories struct {
+		Category []struct {
+			ID     int    `xml:"id,attr"`
+			Name   string `xml:"name,attr"`
+			Subcat []struct {
+				ID   int    `xml:"id,attr"`
+				Name string `xml:"name,attr"`
+			} `xml:"subcat"`
+		} `xml:"category"`
+	} `xml:"categories"`
+}
+
+type capsMode struct {
+	Available       string `xml:"available,attr"`
+	SupportedParams string `xml:"supportedParams,attr"`
+}
+
+func (m capsMode) mode() SearchMode {
+	out := SearchMode{Available: strings.EqualFold(m.Available, "yes"), Params: map[string]bool{}}
+	for _, p := range strings.Split(m.SupportedParams, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			out.Params[p] = true
+		}
+	}
+	// servers that omit supportedParams accept at least a text query
+	if out.Available && len(out.Params) == 0 {
+		out.Params["q"] = true
+	}
+	return out
+}
+
+func parseCaps(doc capsDoc) *TorznabCaps {
+	caps := &TorznabCaps{
+		Search:      doc.Searching.Search.mode(),
+		TVSearch:    doc.Searching.TVSearch.mode(),
+		MovieSearch: doc.Searching.MovieSearch.mode(),
+		Categories:  map[string][]int{},
+		FetchedAt:   time.Now(),
+	}
+	add := func(kind string, id int) { caps.Categories[kind] = append(caps.Categories[kind], id) }
+	for _, c := range doc.Categories.Category {
+		switch {
+		case c.ID >= 2000 && c.ID < 3000:
+			add("movie", c.ID)
+		case c.ID >= 5000 && c.ID < 6000:
+			add("tv", c.ID)
+		}
+		for _, s := range c.Subcat {
+			if s.ID == catAnime || strings.Contains(strings.ToLower(s.Name), "anime") {
+				add("anime", s.ID)
+			}
+		}
+		// custom (100000+) indexer categories are only recognisable by name
+		if c.ID >= 100000 {
+			name := strings.ToLower(c.Name)
+			switch {
+			case strings.Contains(name, "anime"):
+				add("anime", c.ID)
+			case strings.Contains(name, "movie") || strings.Contains(name, "film"):
+				add("movie", c.ID)
+			case strings.Contains(name, "tv") || strings.Contains(name, "series"):
+				add("tv", c.ID)
+			}
+		}
+	}
+	return caps
+}
+
+// CategoriesFor returns the category filter for kind (movie|tv|anime)
+func (c *TorznabCaps) CategoriesFor(kind string) []int {
+	if c != nil {
+		if ids := c.Categories[kind]; len(ids) > 0 {
+			return ids
+		}
+	}
+	switch kind {
+	case "movie":
+		return []int{catMovies}
+	case "anime":
+		return []int{catAnime}
+	case "tv":
+		return []int{catTV}
+	}
+	return nil
+}
+
+// capsCache holds one client's discovered capabilities
+type capsCache struct {
+	mu      sync.Mutex
+	caps    *TorznabCaps
+	err     error
+	expires time.Time
+}
+
+// Caps returns the indexer capabilities, fetching t=caps at most once per
+// capsTTL. On failure it returns the error and callers fall back to text search.
+func (c *TorznabClient) Caps(ctx context.Context) (*TorznabCaps, error) {
+	c.caps.mu.Lock()
+	defer c.caps.mu.Unlock()
+	if time.Now().Before(c.caps.expires) {
+		return c.caps.caps, c.caps.err
+	}
+	caps, err := c.fetchCaps(ctx)
+	if err != nil {
+		c.caps.err = err
+		c.caps.expires = time.Now().Add(capsRetryTTL)
+		// keep serving the last good caps until the indexer is back
+		return c.caps.caps, err
+	}
+	c.caps.caps, c.caps.err = caps, nil
+	c.caps.expires = time.Now().Add(capsTTL)
+	return caps, nil
+}
+
+func (c *TorznabClient) fetchCaps(ctx context.Context) (*TorznabCaps, error) {
+	v := url.Values{}
+	v.Set("t", "caps")
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint(v), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("torznab caps: HTTP %d", resp.StatusCode)
+	}
+	var doc capsDoc
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("torznab caps: %w", err)
+	}
+	return parseCaps(doc), nil
+}
+
+func joinInts(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,47 @@
+package torrentx
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"torrent-streamer/pkg/types"
+)
+
+// FeedItem is one entry of an indexer's recent-releases feed
+type FeedItem struct {
+	GUID      string
+	Published time.Time // zero when the indexer doesn't say
+	Candidate types.Candidate
+}
+
+// Recent returns the indexer's newest releases in the TV, anime and movie
+// categories, newest first. This is Torznab's RSS mode: t=search without a query.
+func (c *TorznabClient) Recent(ctx context.Context) ([]FeedItem, error) {
+	caps, _ := c.Caps(ctx)
+	var cats []int
+	for _, kind := range []string{"tv", "anime", "movie"} {
+		cats = append(cats, caps.CategoriesFor(kind)...)
+	}
+	v := url.Values{}
+	v.Set("t", "search")
+	v.Set("cat", joinInts(cats))
+	items, err := c.fetch(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]FeedItem, 0, len(items))
+	for _, it := range items {
+		fi := FeedItem{GUID: it.GUID, Candidate: it.candidate(SearchQuery{})}
+		if fi.GUID == "" {
+			fi.GUID = fi.Candidate.Magnet
+		}
+		if t, err := time.Parse(time.RFC1123Z, it.PubDate); err == nil {
+			fi.Published = t
+		} else if t, err := time.Parse(time.RFC1123, it.PubDate); err == nil {
+			fi.Published = t
+		}
+		out = append(out, fi)
+	}
+	return out, nil
+}
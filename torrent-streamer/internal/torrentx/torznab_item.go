@@ -0,0 +1,163 @@
+package torrentx
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"torrent-streamer/internal/releaseparse"
+	"torrent-streamer/pkg/types"
+)
+
+// torznabItem is one <item> of a Torznab feed. Prowlarr and Jackett put most
+// of the useful data in <torznab:attr name=".." value=".."/> elements (some
+// indexers emit newznab:attr); the namespace is ignored so both match.
+type torznabItem struct {
+	Title     string `xml:"title"`
+	GUID      string `xml:"guid"`
+	Link      string `xml:"link"`
+	PubDate   string `xml:"pubDate"`
+	Size      int64  `xml:"size"`
+	Seeders   int    `xml:"seeders"`
+	Peers     int    `xml:"peers"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+// attr returns the first torznab:attr named name
+func (it torznabItem) attr(name string) (string, bool) {
+	for _, a := range it.Attrs {
+		if strings.EqualFold(a.Name, name) && strings.TrimSpace(a.Value) != "" {
+			return strings.TrimSpace(a.Value), true
+		}
+	}
+	return "", false
+}
+
+func (it torznabItem) attrInt(name string) (int, bool) {
+	v, ok := it.attr(name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+// candidate converts the item, preferring indexer-provided attributes over
+// guesses from the title and the query
+func (it torznabItem) candidate(sq SearchQuery) types.Candidate {
+	rel := releaseparse.Parse(it.Title)
+	c := types.Candidate{
+		Title:         it.Title,
+		ReleaseGroup:  rel.Group,
+		Resolution:    rel.Resolution,
+		Codec:         rel.Codec,
+		Source:        rel.Source,
+		BitDepth:      rel.BitDepth,
+		HDR:           rel.HDR,
+		AudioCodec:    rel.AudioCodec,
+		AudioChannels: rel.AudioChannels,
+		Languages:     rel.Languages,
+		DualAudio:     rel.DualAudio,
+		MultiAudio:    rel.Multi,
+		SubLanguages:  rel.SubLanguages,
+		MultiSubs:     rel.MultiSubs,
+		Proper:        rel.Proper || rel.Repack,
+		SizeBytes:     it.Size,
+		Seeders:       it.Seeders,
+		Leechers:      it.Peers,
+		SourceKind:    "single",
+	}
+	// anime releases rarely name languages: fansubs are Japanese with English
+	// subs, and dual audio adds the English dub
+	if sq.Kind == "anime" && len(c.Languages) == 0 {
+		switch {
+		case rel.DualAudio:
+			c.Languages = []string{"ja", "en"}
+		case rel.Fansub:
+			c.Languages = []string{"ja"}
+		}
+		if rel.Fansub && len(c.SubLanguages) == 0 {
+			c.SubLanguages = []string{"en"}
+		}
+	}
+	// 10-bit h264 is the profile most TVs can't decode
+	if c.Codec == "h264" && c.BitDepth == 10 {
+		c.Codec = "hi10p"
+	}
+	if c.SizeBytes <= 0 {
+		if n, ok := it.attr("size"); ok {
+			c.SizeBytes, _ = strconv.ParseInt(n, 10, 64)
+		}
+	}
+	if c.SizeBytes <= 0 {
+		c.SizeBytes = it.Enclosure.Length
+	}
+
+	// torznab "peers" counts seeders and leechers together
+	seeders, hasSeeders := it.attrInt("seeders")
+	if hasSeeders {
+		c.Seeders = seeders
+	}
+	if peers, ok := it.attrInt("peers"); ok {
+		c.Leechers = peers
+		if hasSeeders && peers >= seeders {
+			c.Leechers = peers - seeders
+		}
+	}
+	c.Files, _ = it.attrInt("files")
+	c.Grabs, _ = it.attrInt("grabs")
+	c.TVDbID, _ = it.attr("tvdbid")
+
+	// link: magneturl attr, else a magnet link/guid, else the .torrent URL
+	link := it.Link
+	if link == "" {
+		link = it.Enclosure.URL
+	}
+	c.InfoHash, c.Magnet = parseLink(link)
+	if m, ok := it.attr("magneturl"); ok {
+		c.InfoHash, c.Magnet = parseLink(m)
+	} else if c.InfoHash == "" && strings.HasPrefix(strings.ToLower(it.GUID), "magnet:") {
+		c.InfoHash, c.Magnet = parseLink(it.GUID)
+	}
+	if ih, ok := it.attr("infohash"); ok && len(ih) == 40 {
+		c.InfoHash = strings.ToLower(ih)
+		if !strings.HasPrefix(strings.ToLower(c.Magnet), "magnet:") {
+			c.Magnet = "magnet:?xt=urn:btih:" + c.InfoHash + "&dn=" + url.QueryEscape(it.Title)
+		}
+	}
+
+	// season/episode: indexer attrs, then the title, then what was asked for
+	season, hasSeason := it.attrInt("season")
+	episode, hasEpisode := it.attrInt("episode")
+	if !hasSeason && rel.Season > 0 {
+		season, hasSeason = rel.Season, true
+	}
+	if !hasEpisode && rel.Episode > 0 && !rel.SeasonPack {
+		episode, hasEpisode = rel.Episode, true
+	}
+	switch {
+	case hasSeason && hasEpisode:
+		c.ParsedSeason, c.ParsedEpisode = season, episode
+	case hasSeason && sq.Episode > 0:
+		// a whole season matched an episode query
+		c.ParsedSeason = season
+		c.SourceKind = "season_pack"
+	default:
+		c.ParsedSeason, c.ParsedEpisode = sq.Season, sq.Episode
+	}
+	if c.SourceKind == "single" && c.Files > 1 && !hasEpisode && sq.Episode > 0 {
+		c.SourceKind = "season_pack"
+	}
+	// anime batches ("Show 01-12") carry no season marker
+	if len(rel.AbsEpisodes) > 1 && !hasEpisode {
+		c.SourceKind = "season_pack"
+	}
+	return c
+}
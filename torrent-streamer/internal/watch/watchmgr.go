@@ -63,6 +63,18 @@ func NewManager(staleAfter, tickerIntv time.Duration, ensure func(Key) error, st
 
 func (m *Manager) Shutdown() { close(m.stopCh) }
 
+// Active reports whether any live lease holds the torrent id (an infohash)
+func (m *Manager) Active(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if strings.EqualFold(e.key.ID, id) && len(e.leases) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Manager) reaper() {
 	t := time.NewTicker(m.tickerIntv)
 	defer t.Stop()
@@ -0,0 +1,13 @@
+-- per-user subtitle timing corrections (offset + framerate ratio)
+CREATE TABLE IF NOT EXISTS subtitle_sync (
+  subject_id TEXT NOT NULL,
+  infohash TEXT NOT NULL,        -- video the subtitle was synced against ('' if unknown)
+  sub_key TEXT NOT NULL,         -- torrent:<ih>:<fileIndex> | subdl:<id> | opensub:<id>
+  offset_ms BIGINT NOT NULL DEFAULT 0,
+  ratio DOUBLE PRECISION NOT NULL DEFAULT 1,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (subject_id, infohash, sub_key)
+);
+DROP TRIGGER IF EXISTS trg_subtitle_sync_upd ON subtitle_sync;
+CREATE TRIGGER trg_subtitle_sync_upd BEFORE UPDATE ON subtitle_sync FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
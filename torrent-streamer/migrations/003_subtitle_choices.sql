@@ -0,0 +1,17 @@
+-- subtitle a subject picked for an episode (reused by /subtitles/:episodeKey.vtt)
+CREATE TABLE IF NOT EXISTS subtitle_choices (
+  subject_id TEXT NOT NULL,
+  series_id TEXT NOT NULL,
+  season INT NOT NULL,
+  episode INT NOT NULL,
+  source TEXT NOT NULL,          -- torrent|embedded|<provider>
+  ref TEXT NOT NULL,             -- file index, track number or provider id
+  lang TEXT NOT NULL DEFAULT '',
+  infohash TEXT NOT NULL DEFAULT '', -- torrent the ref belongs to (torrent/embedded)
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (subject_id, series_id, season, episode)
+);
+CREATE INDEX IF NOT EXISTS idx_sc_subject_series ON subtitle_choices(subject_id, series_id, updated_at DESC);
+DROP TRIGGER IF EXISTS trg_subtitle_choices_upd ON subtitle_choices;
+CREATE TRIGGER trg_subtitle_choices_upd BEFORE UPDATE ON subtitle_choices FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
@@ -0,0 +1,27 @@
+-- series a subject follows; the feed watcher grabs their new episodes
+CREATE TABLE IF NOT EXISTS watchlist (
+  subject_id TEXT NOT NULL,
+  series_id TEXT NOT NULL,
+  series_title TEXT NOT NULL,      -- matched against release titles in the feed
+  kind TEXT NOT NULL DEFAULT 'tv', -- tv|anime|movie
+  profile_hash TEXT NOT NULL,
+  imdb_id TEXT NOT NULL DEFAULT '',
+  tvdb_id TEXT NOT NULL DEFAULT '',
+  est_runtime_min INT NOT NULL DEFAULT 0,
+  prefetch_pct INT NULL,           -- NULL = FEED_PREFETCH_PCT
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (subject_id, series_id)
+);
+DROP TRIGGER IF EXISTS trg_watchlist_upd ON watchlist;
+CREATE TRIGGER trg_watchlist_upd BEFORE UPDATE ON watchlist FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
+
+-- newest item seen per indexer feed
+CREATE TABLE IF NOT EXISTS feed_checkpoints (
+  feed TEXT PRIMARY KEY,           -- indexer name
+  last_guid TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+DROP TRIGGER IF EXISTS trg_feed_checkpoints_upd ON feed_checkpoints;
+CREATE TRIGGER trg_feed_checkpoints_upd BEFORE UPDATE ON feed_checkpoints FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
@@ -0,0 +1,2 @@
+-- how each pick was chosen: every candidate's score and the rules in effect
+ALTER TABLE picks ADD COLUMN IF NOT EXISTS explanation JSONB NULL;
@@ -0,0 +1,10 @@
+-- release group a series is best served by, learnt from watched episodes
+CREATE TABLE IF NOT EXISTS group_preferences (
+  series_id TEXT PRIMARY KEY,
+  preferred_group TEXT NOT NULL,
+  confidence INT NOT NULL DEFAULT 0, -- grows with completed episodes, shrinks on fallbacks and overrides
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+DROP TRIGGER IF EXISTS trg_group_preferences_upd ON group_preferences;
+CREATE TRIGGER trg_group_preferences_upd BEFORE UPDATE ON group_preferences FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
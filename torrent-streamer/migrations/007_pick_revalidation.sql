@@ -0,0 +1,6 @@
+-- picks are revalidated after a while; a replaced pick stays as the audit
+-- trail of its successor (replaces_pick_id) instead of being overwritten
+ALTER TABLE picks ADD COLUMN IF NOT EXISTS checked_at TIMESTAMPTZ NULL;
+ALTER TABLE picks ADD COLUMN IF NOT EXISTS superseded_at TIMESTAMPTZ NULL;
+ALTER TABLE picks DROP CONSTRAINT IF EXISTS picks_series_id_season_episode_profile_hash_key;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_picks_current ON picks(series_id, season, episode, profile_hash) WHERE superseded_at IS NULL;
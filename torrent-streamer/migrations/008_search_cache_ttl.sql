@@ -0,0 +1,9 @@
+-- search results expire by kind; empty results are cached too, with backoff
+ALTER TABLE search_cache ADD COLUMN IF NOT EXISTS series_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE search_cache ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT '';
+ALTER TABLE search_cache ADD COLUMN IF NOT EXISTS misses INT NOT NULL DEFAULT 0; -- empty results in a row
+ALTER TABLE search_cache ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NOT NULL DEFAULT now();
+-- rows from before this migration: series id is the key's first part
+UPDATE search_cache SET series_id=split_part(key, '|', 1) WHERE series_id='';
+CREATE INDEX IF NOT EXISTS idx_search_cache_series ON search_cache(series_id);
+CREATE INDEX IF NOT EXISTS idx_search_cache_expires ON search_cache(expires_at);
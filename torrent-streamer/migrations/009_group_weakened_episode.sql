@@ -0,0 +1,4 @@
+-- a fallback or override weakens the preferred group once per episode, not
+-- once per device profile picking it
+ALTER TABLE group_preferences ADD COLUMN IF NOT EXISTS weakened_season INT NULL;
+ALTER TABLE group_preferences ADD COLUMN IF NOT EXISTS weakened_episode INT NULL;
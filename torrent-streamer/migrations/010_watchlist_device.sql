@@ -0,0 +1,3 @@
+-- the feed watcher picks with the entry's device capabilities; '' = the
+-- default caps (profile_hash must then be theirs)
+ALTER TABLE watchlist ADD COLUMN IF NOT EXISTS device_id TEXT NOT NULL DEFAULT '';
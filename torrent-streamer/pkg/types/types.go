@@ -5,12 +5,28 @@ type Candidate struct {
 	Magnet        string
 	Title         string
 	ReleaseGroup  string
-	Resolution    string // "2160p","1080p","720p","480p"
-	Codec         string // "h264","hevc","av1","hi10p",...
-	Source        string // "WEB-DL","WEBRip","HDTV","BluRay",...
+	Resolution    string // "2160p","1080p","720p","480p"; "" = not stated
+	Codec         string // "h264","hevc","av1","hi10p",...; "" = not stated
+	Source        string // "REMUX","BluRay","WEB-DL","WEBRip","HDTV",...
+	BitDepth      int
+	HDR           []string // "DV","HDR10+","HDR10","HDR","HLG"
+	AudioCodec    string
+	AudioChannels string
+	Languages     []string // audio languages named in the title (ISO 639-1)
+	DualAudio     bool
+	MultiAudio    bool     // "MULTi": several audio languages, not all named
+	SubLanguages  []string // subtitle languages named in the title
+	MultiSubs     bool
+	Proper        bool // PROPER/REPACK
 	Seeders       int
 	Leechers      int
-	SizeBytes     int64
+	SizeBytes     int64 // the episode's file once the file list is known, else the whole torrent
+	TotalBytes    int64 // whole torrent, when the file list is known
+	Files         int   // file count (0 = unknown)
+	EpisodeFiles  int   // video files that look like episodes (from the file list)
+	SampleFiles   int
+	Grabs         int
+	TVDbID        string
 	FileIndex     *int
 	SourceKind    string // "single"|"season_pack"
 	ParsedSeason  int
@@ -20,6 +36,7 @@ type Candidate struct {
 
 type ScoreBreakdown struct {
 	Health, Quality, Size, Consistency float64
+	Bonus                              float64 // preferred languages and groups, added to Total
 	HardReject                         string
 	Total                              float64
 }